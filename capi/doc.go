@@ -0,0 +1,14 @@
+// Package capi is the runtime of the code generated by forgec. The exports.go written by
+// forgec stays small and calls into it for everything that does not depend on the scanned
+// packages:
+//
+//   - status codes (StatusOK .. StatusInvalidArgument; capi:errcode adds codes from 100 up)
+//   - panic recovery (Recover) and the per-thread last error (SetLastError, LastErrorJSON)
+//   - handle registries (NewHandle, HandleValue, ReleaseHandle)
+//   - reporters (Register), which receive every error and panic
+//   - the C helpers declared in forgec.h: capi_free, capi_last_error_json,
+//     capi_clear_last_error, capi_reporter_configure and capi_flush
+//
+// Generated code references SupportPackageIsVersion1, so code generated for an incompatible
+// version of this package fails to compile instead of misbehaving.
+package capi
@@ -0,0 +1,41 @@
+package capi
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+#include <stdbool.h>
+*/
+import "C"
+
+import (
+	"time"
+	"unsafe"
+)
+
+// The C helpers declared in forgec.h. They are exported from here, so every library built
+// with this package has them, whatever its packages export.
+
+//export capi_free
+func capi_free(p unsafe.Pointer) { C.free(p) }
+
+//export capi_last_error_json
+func capi_last_error_json() *C.char {
+	return C.CString(LastErrorJSON())
+}
+
+//export capi_clear_last_error
+func capi_clear_last_error() { ClearLastError() }
+
+//export capi_reporter_configure
+func capi_reporter_configure(name *C.char, config *C.char) C.int32_t {
+	if err := Configure(C.GoString(name), C.GoString(config)); err != nil {
+		SetLastError(Call{Function: "capi_reporter_configure"}, StatusInvalidArgument, err)
+		return C.int32_t(StatusInvalidArgument)
+	}
+	return C.int32_t(StatusOK)
+}
+
+//export capi_flush
+func capi_flush(timeoutMs C.uint32_t) C.bool {
+	return C.bool(Flush(time.Duration(timeoutMs) * time.Millisecond))
+}
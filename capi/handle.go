@@ -0,0 +1,57 @@
+package capi
+
+import (
+	"errors"
+	"runtime/cgo"
+)
+
+// Errors returned for handles passed in from C.
+var (
+	ErrInvalidHandle = errors.New("invalid handle")
+	ErrHandleType    = errors.New("handle has wrong type")
+)
+
+// NewHandle registers v and returns the handle handed out to C; nil gets the zero handle.
+// v stays alive until the handle is released with ReleaseHandle.
+func NewHandle(v any) uintptr {
+	if v == nil {
+		return 0
+	}
+	return uintptr(cgo.NewHandle(v))
+}
+
+// HandleValue resolves a handle created by NewHandle back to its *T.
+func HandleValue[T any](h uintptr) (v *T, err error) {
+	if h == 0 {
+		return nil, ErrInvalidHandle
+	}
+	// cgo.Handle.Value panics on handles that were never issued or already released
+	defer func() {
+		if recover() != nil {
+			v, err = nil, ErrInvalidHandle
+		}
+	}()
+	v, ok := cgo.Handle(h).Value().(*T)
+	if !ok {
+		return nil, ErrHandleType
+	}
+	return v, nil
+}
+
+// ReleaseHandle releases a handle holding a *T. The zero handle is ignored.
+func ReleaseHandle[T any](h uintptr) (err error) {
+	if h == 0 {
+		return nil
+	}
+	if _, err := HandleValue[T](h); err != nil {
+		return err
+	}
+	// a concurrent release of the same handle may have won
+	defer func() {
+		if recover() != nil {
+			err = ErrInvalidHandle
+		}
+	}()
+	cgo.Handle(h).Delete()
+	return nil
+}
@@ -0,0 +1,119 @@
+package capi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JSONLines is the JSON-lines reporter registered as "jsonl"; it is idle until configured.
+var JSONLines = &JSONLinesReporter{}
+
+func init() {
+	Register("jsonl", JSONLines)
+}
+
+// JSONLinesReporter writes one JSON object per error or panic to a writer:
+//
+//	{"time":"...","event":"error","function":"PM_Find","status":100,"error":"not found","type":"*errors.errorString","args":{...}}
+//
+// Panics have "event":"panic", the panic value's type and the goroutine "stack". It is
+// registered as "jsonl" (JSONLines) and does nothing until it has a writer, either from Go
+// with JSONLines.SetWriter or from C with capi_reporter_configure("jsonl", "{\"path\": \"...\"}"),
+// which appends to the file.
+type JSONLinesReporter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File // set when opened by Configure, closed when replaced
+}
+
+// NewJSONLinesReporter returns another reporter writing to w; register it under a name of its own.
+func NewJSONLinesReporter(w io.Writer) *JSONLinesReporter {
+	return &JSONLinesReporter{w: w}
+}
+
+// SetWriter makes r write to w (nil stops it).
+func (r *JSONLinesReporter) SetWriter(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeFile()
+	r.w = w
+}
+
+// Configure accepts {"path": "..."}; an empty path stops the reporter.
+func (r *JSONLinesReporter) Configure(configJSON string) error {
+	var cfg struct {
+		Path string `json:"path"`
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(configJSON)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return fmt.Errorf("jsonl config: %w", err)
+	}
+	var f *os.File
+	if cfg.Path != "" {
+		var err error
+		if f, err = os.OpenFile(cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+			return fmt.Errorf("jsonl config: %w", err)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeFile()
+	r.w, r.file = nil, f
+	if f != nil {
+		r.w = f
+	}
+	return nil
+}
+
+func (r *JSONLinesReporter) closeFile() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+type jsonLine struct {
+	Time     string         `json:"time"`
+	Event    string         `json:"event"`
+	Function string         `json:"function"`
+	Status   int32          `json:"status"`
+	Error    string         `json:"error"`
+	Type     string         `json:"type"`
+	Args     map[string]any `json:"args,omitempty"`
+	Stack    string         `json:"stack,omitempty"`
+}
+
+func (r *JSONLinesReporter) OnError(call Call, status int32, err error) {
+	r.write(call, jsonLine{Event: "error", Status: status, Error: err.Error(), Type: fmt.Sprintf("%T", err)})
+}
+
+func (r *JSONLinesReporter) OnPanic(call Call, value any, stack []byte) {
+	r.write(call, jsonLine{Event: "panic", Status: StatusPanic, Error: fmt.Sprint(value), Type: fmt.Sprintf("%T", value), Stack: string(stack)})
+}
+
+// Lines are written unbuffered, so there is never anything to flush.
+func (r *JSONLinesReporter) Flush(time.Duration) bool { return true }
+
+func (r *JSONLinesReporter) write(call Call, line jsonLine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return
+	}
+	line.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	line.Function = call.Function
+	if call.Args != nil {
+		line.Args = call.Args()
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	r.w.Write(append(b, '\n'))
+}
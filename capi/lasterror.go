@@ -0,0 +1,135 @@
+package capi
+
+/*
+#include <stdlib.h>
+
+// The last error is kept per calling C thread, like errno: an export runs on the thread
+// that called it, so one thread never reads another thread's error.
+static _Thread_local char* capi_last_err;
+
+static inline void capi_set_last_error(char* s) {
+    free(capi_last_err);
+    capi_last_err = s;
+}
+
+static inline const char* capi_last_error(void) { return capi_last_err; }
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// SchemaVersion is the schema_version of the JSON returned by LastErrorJSON
+// (capi_last_error_json), described by forgec.error.schema.json.
+const SchemaVersion = 1
+
+// ErrorNode describes an error and, recursively, the errors it wraps (Unwrap() error or []error).
+type ErrorNode struct {
+	Error   string      `json:"error"`
+	Type    string      `json:"type"`
+	Wrapped []ErrorNode `json:"wrapped,omitempty"`
+}
+
+// ErrorRecord is the JSON returned by LastErrorJSON.
+type ErrorRecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	Function      string `json:"function"`
+	Status        int32  `json:"status"`
+	ErrorNode
+	Stack string `json:"stack,omitempty"`
+	Time  string `json:"time"`
+}
+
+// SetLastError records err, returned by an export with the given status, as the last error
+// of the calling C thread and passes it to the registered reporters. It must be called from
+// the export, which runs on the thread that called it.
+func SetLastError(call Call, status int32, err error) {
+	record(call.Function, status, err, "", nil)
+	ReportError(call, status, err)
+}
+
+// Recover runs an export. A panic is recorded as the last error, with the panic value's type
+// and the goroutine stack, passed to the registered reporters, and StatusPanic is returned.
+func Recover(call Call, f func()) (status int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			status = StatusPanic
+			stack := debug.Stack()
+			record(call.Function, status, errFromRecover(r), fmt.Sprintf("%T", r), stack)
+			ReportPanic(call, r, stack)
+		}
+	}()
+	f()
+	return StatusOK
+}
+
+// ClearLastError clears the last error of the calling C thread.
+func ClearLastError() {
+	C.capi_set_last_error(nil)
+}
+
+// LastErrorJSON returns the last error recorded on the calling C thread, or "{}".
+func LastErrorJSON() string {
+	s := C.capi_last_error()
+	if s == nil {
+		return "{}"
+	}
+	return C.GoString(s)
+}
+
+func record(fn string, status int32, err error, typ string, stack []byte) {
+	rec := ErrorRecord{
+		SchemaVersion: SchemaVersion,
+		Function:      fn,
+		Status:        status,
+		ErrorNode:     newErrorNode(err, 0),
+		Stack:         string(stack),
+		Time:          time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if typ != "" {
+		rec.Type = typ
+	}
+	b, _ := json.Marshal(rec)
+	C.capi_set_last_error(C.CString(string(b)))
+}
+
+func newErrorNode(err error, depth int) ErrorNode {
+	n := ErrorNode{Error: err.Error(), Type: fmt.Sprintf("%T", err)}
+	if depth >= 32 {
+		return n
+	}
+	var wrapped []error
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		if e := x.Unwrap(); e != nil {
+			wrapped = []error{e}
+		}
+	case interface{ Unwrap() []error }:
+		wrapped = x.Unwrap()
+	}
+	for _, e := range wrapped {
+		if e != nil {
+			n.Wrapped = append(n.Wrapped, newErrorNode(e, depth+1))
+		}
+	}
+	return n
+}
+
+type simpleError string
+
+func (e simpleError) Error() string { return string(e) }
+
+func errFromRecover(r any) error {
+	switch x := r.(type) {
+	case error:
+		return x
+	case string:
+		return simpleError(x)
+	default:
+		return simpleError(fmt.Sprint(x))
+	}
+}
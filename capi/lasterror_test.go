@@ -0,0 +1,200 @@
+package capi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+	"unsafe"
+
+	forgectemplate "github.com/aarondu-sudo/forgec/template"
+)
+
+// cString copies the NUL-terminated string returned by capi_last_error_json and frees it.
+func cString(p unsafe.Pointer) string {
+	defer capi_free(p)
+	n := 0
+	for *(*byte)(unsafe.Add(p, n)) != 0 {
+		n++
+	}
+	return string(unsafe.Slice((*byte)(p), n))
+}
+
+// TestLastErrorPerThread sets and reads errors from goroutines locked to their own OS threads
+// at the same time; each must only ever see its own record.
+func TestLastErrorPerThread(t *testing.T) {
+	const goroutines, iterations = 8, 2000
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			<-start
+			fn := fmt.Sprintf("PM_G%d", g)
+			for i := 0; i < iterations; i++ {
+				msg := fmt.Sprintf("g%d: %d", g, i)
+				SetLastError(Call{Function: fn}, 100+int32(g), errors.New(msg))
+				runtime.Gosched()
+				var rec ErrorRecord
+				js := LastErrorJSON()
+				if i%2 == 1 {
+					js = cString(unsafe.Pointer(capi_last_error_json()))
+				}
+				if err := json.Unmarshal([]byte(js), &rec); err != nil {
+					errs <- fmt.Errorf("goroutine %d: %v: %s", g, err, js)
+					return
+				}
+				if rec.Function != fn || rec.Status != 100+int32(g) || rec.Error != msg {
+					errs <- fmt.Errorf("goroutine %d, iteration %d: read %s", g, i, js)
+					return
+				}
+				if i%100 == 99 {
+					capi_clear_last_error()
+					runtime.Gosched()
+					if js := LastErrorJSON(); js != "{}" {
+						errs <- fmt.Errorf("goroutine %d: after capi_clear_last_error: %s", g, js)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestClearLastError(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	SetLastError(Call{Function: "PM_Find"}, 100, errors.New("not found"))
+	if js := cString(unsafe.Pointer(capi_last_error_json())); js == "{}" {
+		t.Fatal("no last error after SetLastError")
+	}
+	capi_clear_last_error()
+	if js := cString(unsafe.Pointer(capi_last_error_json())); js != "{}" {
+		t.Errorf("capi_last_error_json after capi_clear_last_error = %s, want {}", js)
+	}
+	ClearLastError() // clearing twice is fine
+	if js := LastErrorJSON(); js != "{}" {
+		t.Errorf("LastErrorJSON after ClearLastError = %s, want {}", js)
+	}
+}
+
+// errorSchema renders the schema written by forgec next to the header.
+func errorSchema(t *testing.T) map[string]any {
+	t.Helper()
+	tmpl, err := template.ParseFS(forgectemplate.FS, "error.schema.json.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, map[string]any{"Version": SchemaVersion}); err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(b.Bytes(), &schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// checkSchema reports the required properties of def missing from v and the properties of v
+// the schema does not describe, then checks the wrapped nodes against the node definition.
+func checkSchema(t *testing.T, defs map[string]any, def, path string, v map[string]any) {
+	t.Helper()
+	d := defs[def].(map[string]any)
+	for _, name := range d["required"].([]any) {
+		if _, ok := v[name.(string)]; !ok {
+			t.Errorf("%s: missing required %s", path, name)
+		}
+	}
+	props := d["properties"].(map[string]any)
+	for name := range v {
+		if _, ok := props[name]; !ok {
+			t.Errorf("%s: %s is not in the schema", path, name)
+		}
+	}
+	wrapped, _ := v["wrapped"].([]any)
+	for i, w := range wrapped {
+		checkSchema(t, defs, "node", fmt.Sprintf("%s.wrapped[%d]", path, i), w.(map[string]any))
+	}
+}
+
+func TestLastErrorJSONMatchesSchema(t *testing.T) {
+	schema := errorSchema(t)
+	defs := schema["$defs"].(map[string]any)
+	version := defs["record"].(map[string]any)["properties"].(map[string]any)["schema_version"].(map[string]any)["const"]
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer ClearLastError()
+	base := errors.New("not found")
+	wrapped := fmt.Errorf("load config: %w", fmt.Errorf("open file: %w", base))
+	tests := []struct {
+		name      string
+		fail      func()
+		status    int32
+		typ       string
+		withStack bool
+	}{
+		{"error", func() { SetLastError(Call{Function: "PM_Load"}, 100, wrapped) }, 100, "*fmt.wrapError", false},
+		{"panic", func() { Recover(Call{Function: "PM_Load"}, func() { panic(wrapped) }) }, StatusPanic, "*fmt.wrapError", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fail()
+			js := LastErrorJSON()
+			var v map[string]any
+			if err := json.Unmarshal([]byte(js), &v); err != nil {
+				t.Fatalf("%v: %s", err, js)
+			}
+			checkSchema(t, defs, "record", "record", v)
+			if v["schema_version"] != version {
+				t.Errorf("schema_version = %v, want %v", v["schema_version"], version)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(v["time"])); err != nil {
+				t.Errorf("time: %v", err)
+			}
+
+			var rec ErrorRecord
+			if err := json.Unmarshal([]byte(js), &rec); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Function != "PM_Load" || rec.Status != tt.status || rec.Type != tt.typ {
+				t.Errorf("function, status, type = %s, %d, %s", rec.Function, rec.Status, rec.Type)
+			}
+			// The chain goes down to the errors.New at its end.
+			var chain []string
+			for n := rec.ErrorNode; ; n = n.Wrapped[0] {
+				chain = append(chain, n.Error)
+				if len(n.Wrapped) != 1 {
+					break
+				}
+			}
+			want := []string{"load config: open file: not found", "open file: not found", "not found"}
+			if strings.Join(chain, "|") != strings.Join(want, "|") {
+				t.Errorf("chain = %q, want %q", chain, want)
+			}
+			if rec.Wrapped[0].Wrapped[0].Type != "*errors.errorString" {
+				t.Errorf("innermost type = %s, want *errors.errorString", rec.Wrapped[0].Wrapped[0].Type)
+			}
+			if got := strings.Contains(rec.Stack, "TestLastErrorJSONMatchesSchema"); got != tt.withStack {
+				t.Errorf("stack holds the panicking test = %v, want %v:\n%s", got, tt.withStack, rec.Stack)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package capi
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Call identifies the export being run. Args is only evaluated when a reporter asks for it,
+// and only while the export runs (string args are copied from C memory).
+type Call struct {
+	Function string
+	Args     func() map[string]any
+}
+
+// Reporter receives the errors and panics of exports. OnError and OnPanic are called on the
+// thread running the export, after the error is recorded as the thread's last error; they must
+// be safe for concurrent use. Flush waits up to timeout for buffered reports and reports
+// whether everything was delivered.
+type Reporter interface {
+	OnError(call Call, status int32, err error)
+	OnPanic(call Call, value any, stack []byte)
+	Flush(timeout time.Duration) bool
+}
+
+// Configurer is implemented by reporters that can be configured at runtime from C, through
+// capi_reporter_configure(name, config_json).
+type Configurer interface {
+	Configure(configJSON string) error
+}
+
+var (
+	mu        sync.RWMutex
+	reporters = map[string]Reporter{}
+)
+
+// Register makes a reporter available under name, typically from the init function of the
+// package providing it. It panics if name is empty, r is nil or name is already registered.
+func Register(name string, r Reporter) {
+	mu.Lock()
+	defer mu.Unlock()
+	if name == "" || r == nil {
+		panic("capi: Register with empty name or nil reporter")
+	}
+	if _, dup := reporters[name]; dup {
+		panic("capi: Register called twice for reporter " + name)
+	}
+	reporters[name] = r
+}
+
+// Reporters returns the names of the registered reporters, sorted.
+func Reporters() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(reporters))
+	for name := range reporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Configure passes configJSON to the reporter registered under name.
+func Configure(name, configJSON string) error {
+	mu.RLock()
+	r, ok := reporters[name]
+	mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown reporter %q (registered: %v)", name, Reporters())
+	}
+	c, ok := r.(Configurer)
+	if !ok {
+		return fmt.Errorf("reporter %q cannot be configured", name)
+	}
+	return c.Configure(configJSON)
+}
+
+// ReportError passes an error returned by an export with the given status to every reporter.
+func ReportError(call Call, status int32, err error) {
+	each(func(r Reporter) { r.OnError(call, status, err) })
+}
+
+// ReportPanic passes a panic recovered in an export, with the goroutine stack, to every reporter.
+func ReportPanic(call Call, value any, stack []byte) {
+	each(func(r Reporter) { r.OnPanic(call, value, stack) })
+}
+
+// Flush flushes every reporter, waiting up to timeout in total, and reports whether all of
+// them delivered everything.
+func Flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	ok := true
+	each(func(r Reporter) {
+		if !r.Flush(time.Until(deadline)) {
+			ok = false
+		}
+	})
+	return ok
+}
+
+// each calls f for the registered reporters in name order. A panicking reporter is skipped:
+// reporting runs inside the exports' panic recovery and must not take the process down.
+func each(f func(Reporter)) {
+	names := Reporters()
+	rs := make([]Reporter, 0, len(names))
+	mu.RLock()
+	for _, name := range names {
+		if r, ok := reporters[name]; ok {
+			rs = append(rs, r)
+		}
+	}
+	mu.RUnlock()
+	for _, r := range rs {
+		func() {
+			defer func() { _ = recover() }()
+			f(r)
+		}()
+	}
+}
@@ -0,0 +1,199 @@
+// Package sentryreporter reports the errors and panics of exports to Sentry. Importing it
+// registers the "sentry" capi reporter (forgec -sentry adds the import to exports.go);
+// configure it from C with capi_reporter_configure("sentry", config) (see Config). It also
+// exports the deprecated capi_sentry_init and capi_sentry_flush of earlier versions.
+package sentryreporter
+
+/*
+#include <stdint.h>
+#include <stdbool.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aarondu-sudo/forgec/capi"
+	"github.com/getsentry/sentry-go"
+)
+
+func init() {
+	capi.Register("sentry", Reporter{})
+}
+
+// Config is the JSON accepted by Init (capi_reporter_configure("sentry", ...)). Unknown keys are rejected.
+type Config struct {
+	DSN         string            `json:"dsn"`
+	Release     string            `json:"release"`
+	Environment string            `json:"environment"`
+	Debug       bool              `json:"debug"`
+	SampleRate  *float64          `json:"sample_rate"`
+	Tags        map[string]string `json:"tags"`
+	// OfflineDir makes events go to <OfflineDir>/<event_id>.envelope instead of the network;
+	// the files can be sent later, e.g., with `sentry-cli send-envelope`.
+	OfflineDir string `json:"offline_dir"`
+}
+
+var (
+	initMu sync.Mutex
+	tags   map[string]string
+)
+
+// Init configures the Sentry client from a JSON Config. Until it is called, nothing is reported.
+func Init(configJSON string) error {
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader([]byte(configJSON)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return fmt.Errorf("sentry config: %w", err)
+	}
+	opts := sentry.ClientOptions{
+		Dsn:              cfg.DSN,
+		Release:          cfg.Release,
+		Environment:      cfg.Environment,
+		Debug:            cfg.Debug,
+		AttachStacktrace: true,
+	}
+	if cfg.SampleRate != nil {
+		opts.SampleRate = *cfg.SampleRate
+	}
+	if cfg.OfflineDir != "" {
+		if err := os.MkdirAll(cfg.OfflineDir, 0o755); err != nil {
+			return fmt.Errorf("sentry offline_dir: %w", err)
+		}
+		opts.Transport = &FileTransport{Dir: cfg.OfflineDir}
+	}
+	initMu.Lock()
+	defer initMu.Unlock()
+	if err := sentry.Init(opts); err != nil {
+		return fmt.Errorf("sentry init: %w", err)
+	}
+	tags = cfg.Tags
+	return nil
+}
+
+// capi_sentry_init is kept for C callers of earlier versions; it is
+// capi_reporter_configure("sentry", config).
+//
+//export capi_sentry_init
+func capi_sentry_init(config *C.char) C.int32_t {
+	if err := capi.Configure("sentry", C.GoString(config)); err != nil {
+		capi.SetLastError(capi.Call{Function: "capi_sentry_init"}, capi.StatusInvalidArgument, err)
+		return C.int32_t(capi.StatusInvalidArgument)
+	}
+	return C.int32_t(capi.StatusOK)
+}
+
+// capi_sentry_flush is kept for C callers of earlier versions; it is capi_flush, which
+// flushes every reporter.
+//
+//export capi_sentry_flush
+func capi_sentry_flush(timeoutMs C.uint32_t) C.bool {
+	return C.bool(capi.Flush(time.Duration(timeoutMs) * time.Millisecond))
+}
+
+// Reporter is the capi.Reporter registered as "sentry": errors returned by exports become
+// error events and panics fatal events.
+type Reporter struct{}
+
+// Configure implements capi.Configurer with Init.
+func (Reporter) Configure(configJSON string) error { return Init(configJSON) }
+
+func (Reporter) OnError(call capi.Call, status int32, err error) {
+	newHub(call, status, sentry.LevelError).CaptureException(err)
+}
+
+// OnPanic is called from the export's deferred recovery, so the event's stacktrace is still
+// the one of the panicking goroutine.
+func (Reporter) OnPanic(call capi.Call, value any, stack []byte) {
+	newHub(call, capi.StatusPanic, sentry.LevelFatal).Recover(value)
+}
+
+// Flush waits up to timeout for queued events to be sent and reports whether all were. Without
+// a client (Init was never called) nothing is queued, so it succeeds.
+func (Reporter) Flush(timeout time.Duration) bool {
+	if sentry.CurrentHub().Client() == nil {
+		return true
+	}
+	return sentry.Flush(timeout)
+}
+
+// newHub returns a hub of its own for one event, so that concurrent exports do not share scope.
+func newHub(call capi.Call, status int32, level sentry.Level) *sentry.Hub {
+	hub := sentry.CurrentHub().Clone()
+	scope := hub.Scope()
+	scope.SetLevel(level)
+	initMu.Lock()
+	for k, v := range tags {
+		scope.SetTag(k, v)
+	}
+	initMu.Unlock()
+	scope.SetTag("export", call.Function)
+	ctx := sentry.Context{"function": call.Function, "status": status}
+	if call.Args != nil && hub.Client() != nil {
+		ctx["args"] = call.Args()
+	}
+	scope.SetContext("export", ctx)
+	return hub
+}
+
+// FileTransport is a sentry.Transport that writes each event as an envelope file to Dir
+// (<event_id>.envelope) instead of sending it.
+type FileTransport struct {
+	Dir string
+	dsn string
+}
+
+func (t *FileTransport) Configure(options sentry.ClientOptions) { t.dsn = options.Dsn }
+
+func (t *FileTransport) SendEvent(event *sentry.Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	typ := event.Type
+	if typ == "" {
+		typ = "event"
+	}
+	var b bytes.Buffer
+	header := map[string]any{"event_id": event.EventID, "sent_at": time.Now().UTC().Format(time.RFC3339Nano)}
+	if t.dsn != "" {
+		header["dsn"] = t.dsn
+	}
+	h, _ := json.Marshal(header)
+	item, _ := json.Marshal(map[string]any{"type": typ, "length": len(body)})
+	b.Write(h)
+	b.WriteByte('\n')
+	b.Write(item)
+	b.WriteByte('\n')
+	b.Write(body)
+	b.WriteByte('\n')
+	// write then rename, so readers never see a partial envelope
+	tmp, err := os.CreateTemp(t.Dir, ".envelope-*")
+	if err != nil {
+		return
+	}
+	_, werr := tmp.Write(b.Bytes())
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(t.Dir, string(event.EventID)+".envelope")); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Events are written synchronously, so there is never anything to flush.
+func (t *FileTransport) Flush(time.Duration) bool { return true }
+
+func (t *FileTransport) FlushWithContext(context.Context) bool { return true }
+
+func (t *FileTransport) Close() {}
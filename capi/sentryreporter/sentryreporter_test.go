@@ -0,0 +1,162 @@
+package sentryreporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aarondu-sudo/forgec/capi"
+	"github.com/getsentry/sentry-go"
+)
+
+const testDSN = "https://public@example.com/1"
+
+// envelope is an <event_id>.envelope written by FileTransport: the envelope header, the item
+// header and the event.
+type envelope struct {
+	header map[string]any
+	item   struct {
+		Type   string `json:"type"`
+		Length int    `json:"length"`
+	}
+	body  []byte
+	event struct {
+		EventID     string                    `json:"event_id"`
+		Level       string                    `json:"level"`
+		Release     string                    `json:"release"`
+		Environment string                    `json:"environment"`
+		Tags        map[string]string         `json:"tags"`
+		Contexts    map[string]map[string]any `json:"contexts"`
+	}
+}
+
+// readEnvelope parses the only envelope in dir.
+func readEnvelope(t *testing.T, dir string) *envelope {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.envelope"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("%s: got %d envelopes, want 1", dir, len(paths))
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitN(data, []byte("\n"), 3)
+	if len(lines) != 3 {
+		t.Fatalf("envelope has %d lines, want 3: %s", len(lines), data)
+	}
+	env := &envelope{body: bytes.TrimSuffix(lines[2], []byte("\n"))}
+	if err := json.Unmarshal(lines[0], &env.header); err != nil {
+		t.Fatalf("envelope header: %v", err)
+	}
+	if err := json.Unmarshal(lines[1], &env.item); err != nil {
+		t.Fatalf("item header: %v", err)
+	}
+	if err := json.Unmarshal(env.body, &env.event); err != nil {
+		t.Fatalf("event: %v", err)
+	}
+	if name := strings.TrimSuffix(filepath.Base(paths[0]), ".envelope"); name != env.event.EventID {
+		t.Errorf("envelope file %s, want %s.envelope", filepath.Base(paths[0]), env.event.EventID)
+	}
+	return env
+}
+
+func configure(t *testing.T, dsn string) string {
+	t.Helper()
+	dir := t.TempDir()
+	cfg, _ := json.Marshal(Config{
+		DSN:         dsn,
+		Release:     "app@1.2.0",
+		Environment: "test",
+		Tags:        map[string]string{"team": "audio"},
+		OfflineDir:  dir,
+	})
+	if err := capi.Configure("sentry", string(cfg)); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestOfflineEnvelopes(t *testing.T) {
+	call := capi.Call{Function: "PM_Open", Args: func() map[string]any { return map[string]any{"path": "a.wav"} }}
+	tests := []struct {
+		name   string
+		dsn    string
+		report func()
+		level  string
+		status float64
+	}{
+		{"error", "", func() { capi.ReportError(call, 1, errors.New("open a.wav: no such file")) }, "error", 1},
+		{"error with dsn", testDSN, func() { capi.ReportError(call, 1, errors.New("open a.wav: no such file")) }, "error", 1},
+		{"panic", "", func() { capi.ReportPanic(call, "index out of range", nil) }, "fatal", float64(capi.StatusPanic)},
+		{"panic with dsn", testDSN, func() { capi.ReportPanic(call, "index out of range", nil) }, "fatal", float64(capi.StatusPanic)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := configure(t, tt.dsn)
+			tt.report()
+			if !capi.Flush(time.Second) {
+				t.Error("Flush = false")
+			}
+			env := readEnvelope(t, dir)
+
+			if env.header["event_id"] != env.event.EventID {
+				t.Errorf("header event_id = %v, want %s", env.header["event_id"], env.event.EventID)
+			}
+			if _, ok := env.header["sent_at"]; !ok {
+				t.Error("header has no sent_at")
+			}
+			if dsn, ok := env.header["dsn"]; tt.dsn == "" && ok {
+				t.Errorf("header dsn = %v, want none", dsn)
+			} else if tt.dsn != "" && dsn != tt.dsn {
+				t.Errorf("header dsn = %v, want %s", dsn, tt.dsn)
+			}
+			if env.item.Type != "event" || env.item.Length != len(env.body) {
+				t.Errorf("item header = %+v, want type event, length %d", env.item, len(env.body))
+			}
+
+			ev := env.event
+			if ev.Level != tt.level {
+				t.Errorf("level = %q, want %q", ev.Level, tt.level)
+			}
+			if ev.Release != "app@1.2.0" || ev.Environment != "test" {
+				t.Errorf("release, environment = %q, %q", ev.Release, ev.Environment)
+			}
+			if ev.Tags["export"] != "PM_Open" || ev.Tags["team"] != "audio" {
+				t.Errorf("tags = %v", ev.Tags)
+			}
+			ctx := ev.Contexts["export"]
+			if ctx["function"] != "PM_Open" || ctx["status"] != tt.status {
+				t.Errorf("export context = %v", ctx)
+			}
+			if args, _ := ctx["args"].(map[string]any); args["path"] != "a.wav" {
+				t.Errorf("export context args = %v", ctx["args"])
+			}
+		})
+	}
+}
+
+func TestFlushWithoutInit(t *testing.T) {
+	hub := sentry.CurrentHub()
+	client := hub.Client()
+	hub.BindClient(nil)
+	t.Cleanup(func() { hub.BindClient(client) })
+	if !capi.Flush(time.Millisecond) {
+		t.Error("Flush = false without a client, want true")
+	}
+}
+
+func TestInitRejectsUnknownKeys(t *testing.T) {
+	err := capi.Configure("sentry", `{"dsn": "", "offline": "/tmp"}`)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "offline"`) {
+		t.Errorf("err = %v, want unknown field", err)
+	}
+}
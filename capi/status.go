@@ -0,0 +1,14 @@
+package capi
+
+// SupportPackageIsVersion1 is referenced by generated code to assert that it is compatible
+// with this version of the package. It is renamed when generated code has to change.
+const SupportPackageIsVersion1 = true
+
+// Built-in status codes returned by exports; they match <prefix>Status_OK .. _INVALID_ARGUMENT
+// in the generated header. Codes from 100 up are declared with capi:errcode.
+const (
+	StatusOK              int32 = 0
+	StatusError           int32 = 1
+	StatusPanic           int32 = 2
+	StatusInvalidArgument int32 = 3
+)
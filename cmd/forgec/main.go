@@ -22,20 +22,42 @@ func main() {
 		outH           string
 		modPath        string
 		cPrefix        string
+		reporterSpec   string
+		outPy          string
+		outCS          string
+		outRust        string
+		outNode        string
+		outJava        string
+		javaPkg        string
+		outDart        string
+		outLua         string
+		outSwift       string
+		outHPP         string
 		withSentryFlag bool
 		withSentryLong bool
 		showVersion    bool
 	)
 
 	flag.StringVar(&initName, "init", "", "initialize a new DLL project (e.g., -init gamedl)")
-	flag.StringVar(&pkgPath, "pkg", "./internal", "path to the Go package to scan (e.g., ./internal)")
+	flag.StringVar(&pkgPath, "pkg", "./internal", "comma-separated Go packages or patterns to scan, each with an optional =PREFIX overriding -cprefix (e.g., ./internal/...,./audio=AUDIO_)")
 	flag.StringVar(&outGo, "o", "./exports.go", "output path for generated exports.go")
 	flag.StringVar(&outH, "hout", "./forgec.h", "output path for generated C header")
 	flag.StringVar(&modPath, "mod", "", "Go module path of the target project (e.g., example.com/myapi)")
 	flag.StringVar(&cPrefix, "cprefix", "PM_", "C export symbol prefix (e.g., PM_)")
+	flag.StringVar(&reporterSpec, "reporter", "", "comma-separated import paths of packages registering capi reporters, imported by exports.go (e.g., example.com/myapi/otelreport)")
+	flag.StringVar(&outPy, "py", "", "output path for Python ctypes bindings and their .pyi stub (e.g., ./bindings/mylib.py)")
+	flag.StringVar(&outCS, "cs", "", "output path for C# P/Invoke bindings (e.g., ./bindings/MyLib.cs)")
+	flag.StringVar(&outRust, "rust", "", "output path for Rust FFI bindings (e.g., ./bindings/mylib.rs)")
+	flag.StringVar(&outNode, "node", "", "output directory for Node.js bindings using koffi: index.js and index.d.ts (e.g., ./bindings/node)")
+	flag.StringVar(&outJava, "java", "", "output directory for Java JNA and Panama bindings, as a source root (e.g., ./bindings/java)")
+	flag.StringVar(&javaPkg, "javapkg", "", "Java package of the -java bindings (default: the library name)")
+	flag.StringVar(&outDart, "dart", "", "output path for Dart FFI bindings (e.g., ./bindings/mylib.dart)")
+	flag.StringVar(&outLua, "lua", "", "output path for a LuaJIT FFI module (e.g., ./bindings/mylib.lua)")
+	flag.StringVar(&outSwift, "swift", "", "output directory for a Swift package with a module map for forgec.h (e.g., ./bindings/swift)")
+	flag.StringVar(&outHPP, "hpp", "", "output path for C++ wrappers of the header (e.g., ./forgec.hpp)")
 	// Sentry integration toggle (short and long forms)
-	flag.BoolVar(&withSentryFlag, "sentry", false, "include sentrywrap helpers and reporting")
-	flag.BoolVar(&withSentryLong, "withsentry", false, "include sentrywrap helpers and reporting")
+	flag.BoolVar(&withSentryFlag, "sentry", false, "add the Sentry reporter (github.com/aarondu-sudo/forgec/capi/sentryreporter) to -reporter")
+	flag.BoolVar(&withSentryLong, "withsentry", false, "add the Sentry reporter (github.com/aarondu-sudo/forgec/capi/sentryreporter) to -reporter")
 	flag.BoolVar(&showVersion, "version", false, "print forgec version and exit")
 	flag.Parse()
 
@@ -64,22 +86,27 @@ func main() {
 		modPath = detected
 	}
 
-	absPkg, err := filepath.Abs(pkgPath)
-	if err != nil {
-		log.Fatalf("resolve pkg path: %v", err)
-	}
-
-	funcs, structs, err := scanner.ScanExported(absPkg)
+	apis, err := scanPackages(pkgPath)
 	if err != nil {
 		log.Fatalf("scan failed: %v", err)
 	}
+	var nFuncs, nStructs, nHandles, nEnums int
+	for _, api := range apis {
+		nFuncs += len(api.Funcs)
+		nStructs += len(api.Structs)
+		nHandles += len(api.Handles)
+		nEnums += len(api.Enums)
+	}
 
-	if len(funcs) == 0 {
+	if nFuncs == 0 {
 		log.Println("no capi:export functions found; nothing to generate")
 	}
 
 	// Ensure output directories exist
-	for _, p := range []string{outGo, outH} {
+	for _, p := range []string{outGo, outH, outPy, outCS, outRust, outDart, outLua, outHPP} {
+		if p == "" {
+			continue
+		}
 		dir := filepath.Dir(p)
 		if dir != "." && dir != "" {
 			if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -88,36 +115,125 @@ func main() {
 		}
 	}
 
-	if err := writer.WriteExportsGo(outGo, modPath, cPrefix, funcs, withSentry); err != nil {
+	var reporters []string
+	for _, r := range strings.Split(reporterSpec, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			reporters = append(reporters, r)
+		}
+	}
+	if withSentry {
+		reporters = append(reporters, writer.SentryReporterPath)
+	}
+
+	if err := writer.WriteExportsGo(outGo, cPrefix, apis, reporters); err != nil {
 		log.Fatalf("write exports.go: %v", err)
 	}
-	if err := writer.WriteHeader(outH, cPrefix, funcs, structs); err != nil {
+	if err := writer.WriteHeader(outH, cPrefix, apis, reporters); err != nil {
 		log.Fatalf("write header: %v", err)
 	}
-
-	// Optionally generate sentrywrap package into the target module directory
-	if withSentry {
-		// Use the directory of exports.go as the module root for generation
-		modRoot := filepath.Dir(outGo)
-		if err := writer.WriteSentryWrap(modRoot); err != nil {
-			log.Fatalf("write sentrywrap: %v", err)
+	outSchema := filepath.Join(filepath.Dir(outH), writer.ErrorSchemaFile)
+	if err := writer.WriteErrorSchema(outSchema); err != nil {
+		log.Fatalf("write error schema: %v", err)
+	}
+	generated := []string{outGo, outH, outSchema}
+	if outPy != "" {
+		if err := writer.WritePython(outPy, filepath.Base(modPath), cPrefix, apis); err != nil {
+			log.Fatalf("write python bindings: %v", err)
+		}
+		generated = append(generated, outPy)
+	}
+	if outCS != "" {
+		if err := writer.WriteCSharp(outCS, filepath.Base(modPath), cPrefix, apis); err != nil {
+			log.Fatalf("write C# bindings: %v", err)
+		}
+		generated = append(generated, outCS)
+	}
+	if outRust != "" {
+		if err := writer.WriteRust(outRust, filepath.Base(modPath), cPrefix, apis); err != nil {
+			log.Fatalf("write Rust bindings: %v", err)
 		}
+		generated = append(generated, outRust)
+	}
+	if outNode != "" {
+		if err := os.MkdirAll(outNode, 0o755); err != nil {
+			log.Fatalf("mkdir %s: %v", outNode, err)
+		}
+		if err := writer.WriteNode(outNode, filepath.Base(modPath), cPrefix, apis); err != nil {
+			log.Fatalf("write Node.js bindings: %v", err)
+		}
+		generated = append(generated, filepath.Join(outNode, "index.js"))
+	}
+	if outJava != "" {
+		if err := writer.WriteJava(outJava, javaPkg, filepath.Base(modPath), cPrefix, apis); err != nil {
+			log.Fatalf("write Java bindings: %v", err)
+		}
+		generated = append(generated, outJava)
+	}
+	if outDart != "" {
+		if err := writer.WriteDart(outDart, filepath.Base(modPath), cPrefix, apis); err != nil {
+			log.Fatalf("write Dart bindings: %v", err)
+		}
+		generated = append(generated, outDart)
+	}
+	if outLua != "" {
+		if err := writer.WriteLua(outLua, filepath.Base(modPath), cPrefix, apis); err != nil {
+			log.Fatalf("write LuaJIT bindings: %v", err)
+		}
+		generated = append(generated, outLua)
+	}
+	if outSwift != "" {
+		if err := writer.WriteSwift(outSwift, filepath.Base(modPath), cPrefix, apis); err != nil {
+			log.Fatalf("write Swift bindings: %v", err)
+		}
+		generated = append(generated, outSwift)
+	}
+	if outHPP != "" {
+		if err := writer.WriteCPP(outHPP, outH, cPrefix, apis); err != nil {
+			log.Fatalf("write C++ header: %v", err)
+		}
+		generated = append(generated, outHPP)
+	}
+
+	// exports.go imports the capi runtime package (and with -sentry, its sentry-go reporter),
+	// which the target module has to require
+	modRoot := filepath.Dir(outGo)
+	if gm, err := os.ReadFile(filepath.Join(modRoot, "go.mod")); err == nil && !strings.Contains(string(gm), "github.com/aarondu-sudo/forgec") {
+		log.Printf("exports.go imports %s; add it with: go get github.com/aarondu-sudo/forgec@v%s && go mod tidy", writer.CapiImportPath, version.Version)
 	}
 
 	// Always generate build scripts into the target module dir
-	{
-		modRoot := filepath.Dir(outGo)
-		modName := filepath.Base(modPath)
-		if err := writer.WriteBuildScripts(modRoot, modName); err != nil {
-			log.Fatalf("write build scripts: %v", err)
-		}
+	if err := writer.WriteBuildScripts(modRoot, filepath.Base(modPath)); err != nil {
+		log.Fatalf("write build scripts: %v", err)
 	}
 
-	if withSentry {
-		fmt.Printf("Generated %s, %s, sentrywrap/, and build scripts (functions: %d, structs: %d)\n", outGo, outH, len(funcs), len(structs))
-	} else {
-		fmt.Printf("Generated %s, %s, and build scripts (functions: %d, structs: %d)\n", outGo, outH, len(funcs), len(structs))
+	fmt.Printf("Generated %s, and build scripts (packages: %d, functions: %d, structs: %d, handles: %d, enums: %d)\n", strings.Join(generated, ", "), len(apis), nFuncs, nStructs, nHandles, nEnums)
+}
+
+// scanPackages scans the packages matched by the -pkg entries; see parseEntries.
+func scanPackages(spec string) ([]*scanner.API, error) {
+	return scanner.ScanEntries("", parseEntries(spec))
+}
+
+// parseEntries splits -pkg on commas. An entry is a directory, import path or pattern
+// (./internal/...), optionally followed by =PREFIX to give the packages it matches their own
+// C prefix. A package matched by more than one entry is an error.
+func parseEntries(spec string) []scanner.Entry {
+	var entries []scanner.Entry
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, prefix, _ := strings.Cut(entry, "=")
+		// A bare relative directory (internal) would otherwise be taken as an import path.
+		if !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, ".") {
+			if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+				pattern = "./" + filepath.ToSlash(pattern)
+			}
+		}
+		entries = append(entries, scanner.Entry{Pattern: pattern, Prefix: prefix})
 	}
+	return entries
 }
 
 // detectModulePath tries to find a go.mod (starting from startDir and up) and parse its module path.
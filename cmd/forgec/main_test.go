@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEntries(t *testing.T) {
+	tmp, err := os.MkdirTemp(".", "pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmp) })
+	dir := filepath.Base(tmp)
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"./internal/...", "[{./internal/... }]"},
+		{"./a=A_, ./b=B_", "[{./a A_} {./b B_}]"},
+		{"./a=A_,,./b", "[{./a A_} {./b }]"},
+		// An import path is kept; a bare directory is made relative.
+		{"example.com/x=X_", "[{example.com/x X_}]"},
+		{dir + "=D_", "[{./" + dir + " D_}]"},
+		{"./a=", "[{./a }]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(parseEntries(tt.spec)); got != tt.want {
+			t.Errorf("parseEntries(%q) = %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
@@ -1,3 +1,15 @@
 module github.com/aarondu-sudo/forgec
 
-go 1.22
+go 1.22.0
+
+require (
+	github.com/getsentry/sentry-go v0.35.3
+	golang.org/x/tools v0.30.0
+)
+
+require (
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
@@ -0,0 +1,154 @@
+package scanner
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// directive is one parsed `capi:<name> key=value flag key="quoted value"` comment line.
+type directive struct {
+	Name string // without the capi: prefix, e.g., export
+	Args map[string]string
+	Pos  token.Pos
+}
+
+// directiveOptions lists the options accepted by each directive, per kind of declaration.
+var directiveOptions = map[string]map[string][]string{
+	"export": {
+		"func": {"deprecated", "name", "prefix"},
+		"type": nil,
+	},
+	"errcode": {"var": {"code", "name"}},
+	"handle":  {"type": nil},
+	"skip":    {"field": nil},
+}
+
+var cIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// directives parses the capi: directives of the given comment groups (nil groups are skipped).
+// Only lines starting with the directive match (`//capi:export` or `// capi:export ...`), so
+// prose that mentions capi:export does not; unknown directives and options are errors.
+func (s *scan) directives(kind string, groups ...*ast.CommentGroup) (map[string]directive, error) {
+	ds := map[string]directive{}
+	for _, g := range groups {
+		if g == nil {
+			continue
+		}
+		for _, c := range g.List {
+			d, ok, err := parseDirective(c.Text)
+			if err != nil {
+				return nil, s.errorf(c.Pos(), "%v", err)
+			}
+			if !ok {
+				continue
+			}
+			d.Pos = c.Pos()
+			byKind, known := directiveOptions[d.Name]
+			if !known {
+				return nil, s.errorf(c.Pos(), "unknown directive capi:%s", d.Name)
+			}
+			allowed, ok := byKind[kind]
+			if !ok {
+				return nil, s.errorf(c.Pos(), "capi:%s is not allowed on a %s", d.Name, kind)
+			}
+			for k := range d.Args {
+				if !slices.Contains(allowed, k) {
+					return nil, s.errorf(c.Pos(), "capi:%s: unknown option %q on a %s (allowed: %s)", d.Name, k, kind, optionList(allowed))
+				}
+			}
+			if _, dup := ds[d.Name]; dup {
+				return nil, s.errorf(c.Pos(), "duplicate capi:%s directive", d.Name)
+			}
+			ds[d.Name] = d
+		}
+	}
+	return ds, nil
+}
+
+// parseDirective parses a comment line; ok is false if it is not a capi: directive.
+func parseDirective(text string) (d directive, ok bool, err error) {
+	if !strings.HasPrefix(text, "//") {
+		return directive{}, false, nil
+	}
+	text = strings.TrimSpace(strings.TrimPrefix(text, "//"))
+	if !strings.HasPrefix(text, "capi:") {
+		return directive{}, false, nil
+	}
+	head, rest, _ := strings.Cut(text, " ")
+	d = directive{Name: strings.TrimPrefix(head, "capi:"), Args: map[string]string{}}
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		end := strings.IndexAny(rest, "= \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		key := rest[:end]
+		if key == "" {
+			return directive{}, false, fmt.Errorf("%s: missing option name before %q", head, rest)
+		}
+		if _, dup := d.Args[key]; dup {
+			return directive{}, false, fmt.Errorf("%s: option %q given twice", head, key)
+		}
+		rest = rest[end:]
+		if !strings.HasPrefix(rest, "=") {
+			// a flag without a value
+			d.Args[key] = ""
+			continue
+		}
+		rest = rest[1:]
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			q, qerr := strconv.QuotedPrefix(rest)
+			if qerr != nil {
+				return directive{}, false, fmt.Errorf("%s: option %s: unterminated quoted value", head, key)
+			}
+			val, _ = strconv.Unquote(q)
+			rest = rest[len(q):]
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			val, rest = rest[:end], rest[end:]
+		}
+		d.Args[key] = val
+	}
+	return d, true, nil
+}
+
+// applyExportOptions sets the C name, prefix and deprecation of fn from its capi:export options.
+func (s *scan) applyExportOptions(fn *Func, d directive) error {
+	if name, ok := d.Args["name"]; ok {
+		if !cIdent.MatchString(name) {
+			return s.errorf(d.Pos, "capi:export: name %q is not a valid C identifier", name)
+		}
+		fn.CName = name
+	}
+	if prefix, ok := d.Args["prefix"]; ok {
+		if prefix != "" && !cIdent.MatchString(prefix) {
+			return s.errorf(d.Pos, "capi:export: prefix %q is not a valid C identifier", prefix)
+		}
+		fn.Prefix = &prefix
+	}
+	if msg, ok := d.Args["deprecated"]; ok {
+		if msg == "" {
+			msg = "deprecated"
+		}
+		fn.Deprecated = msg
+	}
+	return nil
+}
+
+func optionList(list []string) string {
+	if len(list) == 0 {
+		return "none"
+	}
+	l := append([]string(nil), list...)
+	sort.Strings(l)
+	return strings.Join(l, ", ")
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestParseDirective(t *testing.T) {
+	tests := []struct {
+		text    string
+		ok      bool
+		name    string
+		args    map[string]string
+		wantErr string
+	}{
+		{text: "//capi:export", ok: true, name: "export", args: map[string]string{}},
+		{text: "// capi:export", ok: true, name: "export", args: map[string]string{}},
+		{text: "// capi:export name=add_ints prefix=pm_", ok: true, name: "export",
+			args: map[string]string{"name": "add_ints", "prefix": "pm_"}},
+		// quoted values keep spaces and unescape Go escapes
+		{text: `// capi:export deprecated="use AddV2 instead"`, ok: true, name: "export",
+			args: map[string]string{"deprecated": "use AddV2 instead"}},
+		{text: `// capi:export deprecated="say \"hi\"\tthen\\leave"`, ok: true, name: "export",
+			args: map[string]string{"deprecated": "say \"hi\"\tthen\\leave"}},
+		// bare flags and empty values
+		{text: "// capi:export deprecated", ok: true, name: "export", args: map[string]string{"deprecated": ""}},
+		{text: "// capi:export prefix=", ok: true, name: "export", args: map[string]string{"prefix": ""}},
+		{text: "// capi:errcode code=100 name=QUOTA", ok: true, name: "errcode",
+			args: map[string]string{"code": "100", "name": "QUOTA"}},
+		// prose mentioning a directive is not one
+		{text: "// do not capi:export this", ok: false},
+		{text: "// Add is exported with capi:export.", ok: false},
+		{text: "/* capi:export */", ok: false},
+		// malformed options
+		{text: "// capi:export name=a name=b", wantErr: `option "name" given twice`},
+		{text: "// capi:export deprecated deprecated", wantErr: `option "deprecated" given twice`},
+		{text: `// capi:export deprecated="open`, wantErr: "unterminated quoted value"},
+		{text: "// capi:export =x", wantErr: "missing option name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			d, ok, err := parseDirective(tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if d.Name != tt.name || !reflect.DeepEqual(d.Args, tt.args) {
+				t.Errorf("got %s %v, want %s %v", d.Name, d.Args, tt.name, tt.args)
+			}
+		})
+	}
+}
+
+func TestDirectivesValidateOptions(t *testing.T) {
+	s := &scan{pkg: &packages.Package{Fset: token.NewFileSet()}}
+	group := func(lines ...string) *ast.CommentGroup {
+		g := &ast.CommentGroup{}
+		for _, l := range lines {
+			g.List = append(g.List, &ast.Comment{Text: l})
+		}
+		return g
+	}
+	tests := []struct {
+		kind    string
+		lines   []string
+		wantErr string // empty if the directives are valid
+	}{
+		{"func", []string{`// capi:export name=f prefix= deprecated="use G"`}, ""},
+		{"func", []string{"// Add adds.", "// do not capi:export this"}, ""},
+		{"func", []string{"// capi:export color=red"}, `capi:export: unknown option "color" on a func (allowed: deprecated, name, prefix)`},
+		{"type", []string{"// capi:export name=T"}, `capi:export: unknown option "name" on a type (allowed: none)`},
+		{"var", []string{"// capi:errcode code=100 msg=x"}, `unknown option "msg" on a var (allowed: code, name)`},
+		{"func", []string{"// capi:exprot"}, "unknown directive capi:exprot"},
+		{"func", []string{"// capi:handle"}, "capi:handle is not allowed on a func"},
+		{"func", []string{"// capi:export", "// capi:export name=f"}, "duplicate capi:export directive"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.lines, " | "), func(t *testing.T) {
+			_, err := s.directives(tt.kind, group(tt.lines...))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,264 +1,756 @@
 package scanner
 
 import (
-    "errors"
-    "fmt"
-    "go/ast"
-    "go/parser"
-    "go/token"
-    "os"
-    "path/filepath"
-    "strings"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
 )
 
+// API is everything scanned from a package that the writers emit.
+type API struct {
+	PkgPath string // import path of the scanned package
+	Name    string // package name
+	Prefix  string // C symbol prefix for this package; empty means the default (-cprefix)
+	// Alias is the local name exports.go imports the package under: p when a single package
+	// is scanned, p_<Name> otherwise (with a numeric suffix if package names repeat).
+	Alias    string
+	Funcs    []Func
+	Structs  []Struct
+	Handles  []Handle
+	Enums    []Enum
+	ErrCodes []ErrCode
+}
+
 // Func describes a function to be exported.
 type Func struct {
-    Name       string   // Go name, e.g., Add
-    CName      string   // C name without prefix, same as Name
-    Params     []string // parameter names
-    ParamTypes []string // Go types (int32|int64)
-    HasValue   bool     // true if function returns a value before error
-    RetType    string   // value type ("int32"|"int64") when HasValue=true
+	Name   string   // Go name, e.g., Add
+	CName  string   // C name without prefix: Name, <Recv>_<Name> for methods, or capi:export name=...
+	Recv   string   // handle type name for methods (e.g., Session), empty for functions
+	Params []string // parameter names
+	// ParamTypes are canonical type keys: LookupType keys (e.g., int32, string, []byte), exported
+	// structs (User, *User), handles (*Session), enums (Mode) or callbacks (func(string) int32).
+	// Named types are resolved to their underlying key (type UserID int64 -> int64).
+	ParamTypes []string
+	HasValue   bool       // true if function returns a value before error
+	RetType    string     // value type (as in ParamTypes) when HasValue=true
+	Callbacks  []Callback // func-typed params, in param order
+	// Prefix overrides the package C prefix (capi:export prefix=...); nil if not set, may point to "".
+	Prefix     *string
+	Deprecated string // capi:export deprecated="..." message, empty if not deprecated
+
+	// ParamGoTypes and RetGoType are the declared Go types, used to spell conversions in exports.go.
+	ParamGoTypes []types.Type
+	RetGoType    types.Type
+}
+
+// Callback describes a func-typed param, exposed to C as a function pointer
+// (typedef <prefix><CName>_<Param>_fn) followed by a `void* <Param>_user_data`.
+type Callback struct {
+	Param        string   // name of the func-typed param in the exported function
+	Params       []string // callback parameter names
+	ParamTypes   []string // LookupType keys
+	RetType      string   // scalar LookupType key, empty if the callback returns nothing
+	ParamGoTypes []types.Type
+	RetGoType    types.Type // nil if the callback returns nothing
+}
+
+// CallbackFor returns the callback description of the named param, if it is func-typed.
+func (f Func) CallbackFor(param string) (Callback, bool) {
+	for _, cb := range f.Callbacks {
+		if cb.Param == param {
+			return cb, true
+		}
+	}
+	return Callback{}, false
 }
 
 // Struct represents a struct to export to C.
 type Struct struct {
-    Name   string
-    Fields []Field
+	Name   string
+	Fields []Field
+}
+
+// Handle is a Go type annotated with `capi:handle`, exposed to C as an opaque
+// PM_<Name>Handle backed by runtime/cgo.Handle.
+type Handle struct {
+	Name string
+}
+
+// Enum is a named integer type annotated with `capi:export`, emitted as a C enum
+// (PM_<Name>) together with the package-level constants declared with that type.
+type Enum struct {
+	Name   string // Go type name, e.g., Mode
+	GoType string // underlying integer type, e.g., int32
+	Values []EnumValue
+}
+
+// EnumValue is one constant of an exported enum.
+type EnumValue struct {
+	Name  string // Go const name, e.g., ModeFast
+	CName string // C enumerator suffix with the type name trimmed, e.g., Fast (emitted as PM_Mode_Fast)
+	Value int64
+}
+
+// ErrCode is a package-level error variable annotated with `capi:errcode code=N`. Exports
+// returning an error that matches it (errors.Is) return N, declared as PM_Status_<CName>.
+type ErrCode struct {
+	Name  string // Go var name, e.g., ErrNotFound
+	CName string // enumerator suffix: name=, or the var name without Err in upper snake case (NOT_FOUND)
+	Code  int32
 }
 
 type Field struct {
-    Name       string // original Go field name
-    GoType     string // e.g., string, int32, int64, time.Time, map[string]int64
-    CType      string // e.g., const char*, int32_t, int64_t, double
-    ExportName string // C field name (may add suffix like JSON/Unix)
-}
-
-// ScanExported scans a package directory for top-level functions annotated with `capi:export`.
-// Enforces signature: func(...int32) (int32, error)
-func ScanExported(pkgDir string) ([]Func, []Struct, error) {
-    info, err := os.Stat(pkgDir)
-    if err != nil {
-        return nil, nil, err
-    }
-    if !info.IsDir() {
-        return nil, nil, fmt.Errorf("pkg path is not a directory: %s", pkgDir)
-    }
-
-    fset := token.NewFileSet()
-    pkgs, err := parser.ParseDir(fset, pkgDir, nil, parser.ParseComments)
-    if err != nil {
-        return nil, nil, err
-    }
-
-    var out []Func
-    var structs []Struct
-    for _, pkg := range pkgs {
-        for _, f := range pkg.Files {
-            // Only consider files within the provided dir (avoid vendor, etc.)
-            if !strings.HasPrefix(fset.Position(f.Package).Filename, filepath.Clean(pkgDir)) {
-                continue
-            }
-            for _, decl := range f.Decls {
-                switch d := decl.(type) {
-                case *ast.FuncDecl:
-                    fn := d
-                    if fn.Recv != nil || fn.Name == nil {
-                        continue
-                    }
-                    if fn.Doc == nil || !hasExportTag(fn.Doc.List) {
-                        continue
-                    }
-                    hasVal, retType, err := validateSignature(fn.Type)
-                    if err != nil {
-                        return nil, nil, fmt.Errorf("%s: %w", fn.Name.Name, err)
-                    }
-                    pnames, ptypes := collectParams(fn.Type)
-                    out = append(out, Func{
-                        Name:       fn.Name.Name,
-                        CName:      fn.Name.Name,
-                        Params:     pnames,
-                        ParamTypes: ptypes,
-                        HasValue:   hasVal,
-                        RetType:    retType,
-                    })
-                case *ast.GenDecl:
-                    if d.Tok != token.TYPE {
-                        continue
-                    }
-                    if d.Doc == nil || !hasExportTag(d.Doc.List) {
-                        // allow per-spec doc too
-                        // we will also check TypeSpec.Doc below
-                    }
-                    for _, spec := range d.Specs {
-                        ts, ok := spec.(*ast.TypeSpec)
-                        if !ok {
-                            continue
-                        }
-                        var hasTag bool
-                        if d.Doc != nil && hasExportTag(d.Doc.List) {
-                            hasTag = true
-                        }
-                        if ts.Doc != nil && hasExportTag(ts.Doc.List) {
-                            hasTag = true
-                        }
-                        st, ok := ts.Type.(*ast.StructType)
-                        if !ok || !hasTag {
-                            continue
-                        }
-                        s, err := collectStruct(ts.Name.Name, st)
-                        if err != nil {
-                            return nil, nil, fmt.Errorf("struct %s: %w", ts.Name.Name, err)
-                        }
-                        structs = append(structs, s)
-                    }
-                }
-            }
-        }
-    }
-    return out, structs, nil
-}
-
-func hasExportTag(list []*ast.Comment) bool {
-    for _, c := range list {
-        if strings.Contains(c.Text, "capi:export") {
-            return true
-        }
-    }
-    return false
-}
-
-// validateSignature now supports:
-// - params: any number, each int32 or int64
-// - results: either `error` only, or `(int32|int64, error)`
-// returns (hasValue, retType, error)
-func validateSignature(t *ast.FuncType) (bool, string, error) {
-    if t.Params != nil {
-        for _, f := range t.Params.List {
-            if !(isIdentType(f.Type, "int32") || isIdentType(f.Type, "int64")) {
-                return false, "", fmt.Errorf("param must be int32 or int64: %s", exprString(f.Type))
-            }
-        }
-    }
-    if t.Results == nil || len(t.Results.List) == 0 || len(t.Results.List) > 2 {
-        return false, "", errors.New("result must be error or (int32|int64, error)")
-    }
-    if len(t.Results.List) == 1 {
-        if !isIdentType(t.Results.List[0].Type, "error") {
-            return false, "", errors.New("single result must be error")
-        }
-        return false, "", nil
-    }
-    // two results
-    // first result must be int32 or int64
-    rt := t.Results.List[0].Type
-    if !(isIdentType(rt, "int32") || isIdentType(rt, "int64")) {
-        return false, "", fmt.Errorf("first result must be int32 or int64: %s", exprString(rt))
-    }
-    if !isIdentType(t.Results.List[1].Type, "error") {
-        return false, "", fmt.Errorf("second result must be error: %s", exprString(t.Results.List[1].Type))
-    }
-    r := "int32"
-    if isIdentType(rt, "int64") { r = "int64" }
-    return true, r, nil
-}
-
-func collectParams(t *ast.FuncType) ([]string, []string) {
-    var names []string
-    var types []string
-    if t.Params == nil {
-        return names, types
-    }
-    idx := 0
-    for _, f := range t.Params.List {
-        tname := exprString(f.Type)
-        if len(f.Names) == 0 {
-            names = append(names, fmt.Sprintf("p%d", idx))
-            types = append(types, tname)
-            idx++
-            continue
-        }
-        for _, n := range f.Names {
-            names = append(names, n.Name)
-            types = append(types, tname)
-            idx++
-        }
-    }
-    return names, types
-}
-
-func isIdentType(e ast.Expr, want string) bool {
-    id, ok := e.(*ast.Ident)
-    return ok && id.Name == want
-}
-
-func exprString(e ast.Expr) string {
-    switch x := e.(type) {
-    case *ast.Ident:
-        return x.Name
-    case *ast.SelectorExpr:
-        // e.g., time.Time
-        if pkg, ok := x.X.(*ast.Ident); ok {
-            return pkg.Name + "." + x.Sel.Name
-        }
-        return x.Sel.Name
-    case *ast.MapType:
-        return "map"
-    default:
-        return fmt.Sprintf("%T", e)
-    }
-}
-
-func collectStruct(name string, st *ast.StructType) (Struct, error) {
-    var fields []Field
-    for _, f := range st.Fields.List {
-        // skip embedded/anonymous
-        if len(f.Names) == 0 {
-            continue
-        }
-        gt := exprString(f.Type)
-        ctype, exportName, ok := mapGoToCField(f.Names[0].Name, f.Type)
-        if !ok {
-            return Struct{}, fmt.Errorf("unsupported field type: %s", gt)
-        }
-        fields = append(fields, Field{ Name: f.Names[0].Name, GoType: gt, CType: ctype, ExportName: exportName })
-    }
-    return Struct{ Name: name, Fields: fields }, nil
-}
-
-func mapGoToCField(base string, t ast.Expr) (ctype string, exportName string, ok bool) {
-    exportName = base
-    switch tt := t.(type) {
-    case *ast.Ident:
-        switch tt.Name {
-        case "string":
-            return "const char*", exportName, true
-        case "int32":
-            return "int32_t", exportName, true
-        case "int64":
-            return "int64_t", exportName, true
-        case "bool":
-            return "int32_t", exportName, true
-        case "float64":
-            return "double", exportName, true
-        default:
-            return "", "", false
-        }
-    case *ast.SelectorExpr:
-        // e.g., time.Time -> int64 unix
-        if id, ok := tt.X.(*ast.Ident); ok && id.Name == "time" && tt.Sel.Name == "Time" {
-            return "int64_t", base + "Unix", true
-        }
-        return "", "", false
-    case *ast.MapType:
-        // map[string]int64 -> JSON string
-        if k, ok := tt.Key.(*ast.Ident); ok && k.Name == "string" {
-            if v, ok := tt.Value.(*ast.Ident); ok && v.Name == "int64" {
-                return "const char*", base + "JSON", true
-            }
-        }
-        return "", "", false
-    default:
-        return "", "", false
-    }
+	Name       string     // original Go field name
+	GoType     string     // canonical key, e.g., string, int32, int64, time.Time, map[string]int64
+	CType      string     // e.g., const char*, int32_t, int64_t, double
+	ExportName string     // C field name (may add suffix like JSON/Unix)
+	Type       types.Type // declared Go type, used to spell conversions in exports.go
+}
+
+// ScanExported type-checks the packages matched by patterns and collects top-level functions
+// annotated with `capi:export`, plus `capi:export` methods of `capi:handle` types.
+// Patterns are resolved relative to dir (the current directory if empty) like `go list` does:
+// directories (./internal), import paths and recursive patterns (./internal/...) are accepted.
+// One API is returned per package with annotated declarations, sorted by import path;
+// main packages are skipped, since they cannot be imported by exports.go.
+//
+// Enforces signature: func(...T) ([T,] error) where T is a type known to LookupType,
+// an exported struct (by value or pointer), a pointer to a handle type, an exported enum
+// or a callback. Named types and aliases resolve to their underlying type.
+//
+// Loading goes through golang.org/x/tools/go/packages, so build constraints, GOOS/GOARCH
+// and GOFLAGS (e.g., -tags) apply, and _test.go files are not scanned.
+func ScanExported(dir string, patterns ...string) ([]*API, error) {
+	found, err := load(dir, patterns)
+	if err != nil {
+		return nil, err
+	}
+	return assignAliases(found)
+}
+
+// Entry is one -pkg entry: a pattern and the C prefix of the packages it matches (empty for
+// the default prefix).
+type Entry struct {
+	Pattern string
+	Prefix  string
+}
+
+// ScanEntries scans the packages matched by each entry like ScanExported and sets their
+// Prefix to the one of the entry. A package matched by two entries is an error. Aliases are
+// assigned over the packages of all entries, which are returned sorted by import path.
+func ScanEntries(dir string, entries []Entry) ([]*API, error) {
+	var all []scanned
+	seen := map[string]string{}
+	for _, e := range entries {
+		found, err := load(dir, []string{e.Pattern})
+		if err != nil {
+			return nil, err
+		}
+		for _, sc := range found {
+			if prev, ok := seen[sc.api.PkgPath]; ok {
+				return nil, fmt.Errorf("package %s matched by both -pkg entries %q and %q", sc.api.PkgPath, prev, e.Pattern)
+			}
+			seen[sc.api.PkgPath] = e.Pattern
+			sc.api.Prefix = e.Prefix
+			all = append(all, sc)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].api.PkgPath < all[j].api.PkgPath })
+	return assignAliases(all)
+}
+
+// scanned is a package with annotated declarations and the state it was scanned with.
+type scanned struct {
+	api *API
+	s   *scan
+}
+
+// load type-checks the packages matched by patterns and scans those with annotated
+// declarations, sorted by import path.
+func load(dir string, patterns []string) ([]scanned, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Dir:  dir,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", strings.Join(patterns, " "), err)
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("load %s: no packages matched", strings.Join(patterns, " "))
+	}
+	var errs []error
+	for _, pkg := range pkgs {
+		for _, e := range pkg.Errors {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].PkgPath < pkgs[j].PkgPath })
+	var out []scanned
+	for _, pkg := range pkgs {
+		if pkg.Name == "main" {
+			continue
+		}
+		api, s, err := scanPackage(pkg)
+		if err != nil {
+			return nil, err
+		}
+		if len(api.Funcs)+len(api.Structs)+len(api.Handles)+len(api.Enums)+len(api.ErrCodes) > 0 {
+			out = append(out, scanned{api, s})
+		}
+	}
+	return out, nil
+}
+
+// assignAliases sets the Alias of every package and checks params against all of them; aliases
+// depend on how many packages are exported, so this runs once all of them are scanned.
+func assignAliases(all []scanned) ([]*API, error) {
+	apis := make([]*API, 0, len(all))
+	taken := map[string]bool{}
+	for _, sc := range all {
+		alias := "p"
+		if len(all) > 1 {
+			alias = "p_" + sc.api.Name
+		}
+		for base, n := alias, 2; taken[alias]; n++ {
+			alias = fmt.Sprintf("%s%d", base, n)
+		}
+		taken[alias] = true
+		sc.api.Alias = alias
+		apis = append(apis, sc.api)
+	}
+	for _, sc := range all {
+		if err := sc.s.checkAliases(sc.api, taken); err != nil {
+			return nil, err
+		}
+	}
+	return apis, nil
+}
+
+// scan holds the state of scanning one type-checked package.
+type scan struct {
+	pkg      *packages.Package
+	structs  map[string]bool
+	handles  map[string]bool
+	enums    map[string]bool
+	paramPos [][]token.Pos // param positions of each collected func, in API.Funcs order
+}
+
+func scanPackage(pkg *packages.Package) (*API, *scan, error) {
+	s := &scan{pkg: pkg, structs: map[string]bool{}, handles: map[string]bool{}, enums: map[string]bool{}}
+	api := &API{PkgPath: pkg.PkgPath, Name: pkg.Name}
+
+	// Functions are validated after all annotated types are known, since signatures may reference them.
+	type fnDecl struct {
+		decl   *ast.FuncDecl
+		export directive
+	}
+	var fnDecls []fnDecl
+	var structDecls []*ast.TypeSpec
+	for _, f := range pkg.Syntax {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				ds, err := s.directives("func", d.Doc)
+				if err != nil {
+					return nil, nil, err
+				}
+				if ex, ok := ds["export"]; ok {
+					fnDecls = append(fnDecls, fnDecl{d, ex})
+				}
+			case *ast.GenDecl:
+				if d.Tok == token.VAR {
+					if err := s.collectErrCodes(api, d); err != nil {
+						return nil, nil, err
+					}
+					continue
+				}
+				if d.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range d.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					ds, err := s.directives("type", d.Doc, ts.Doc)
+					if err != nil {
+						return nil, nil, err
+					}
+					if _, ok := ds["handle"]; ok {
+						s.handles[ts.Name.Name] = true
+						api.Handles = append(api.Handles, Handle{Name: ts.Name.Name})
+						continue
+					}
+					if _, ok := ds["export"]; !ok {
+						continue
+					}
+					obj := pkg.TypesInfo.Defs[ts.Name]
+					if obj == nil {
+						continue
+					}
+					switch u := obj.Type().Underlying().(type) {
+					case *types.Struct:
+						s.structs[ts.Name.Name] = true
+						structDecls = append(structDecls, ts)
+					case *types.Basic:
+						if !isIntegerType(types.Typ[u.Kind()].Name()) {
+							return nil, nil, s.errorf(ts.Pos(), "enum %s: underlying type must be a sized integer type (int8..int64, uint8..uint64, uintptr), got %s", ts.Name.Name, u)
+						}
+						s.enums[ts.Name.Name] = true
+						api.Enums = append(api.Enums, Enum{Name: ts.Name.Name, GoType: types.Typ[u.Kind()].Name()})
+					}
+				}
+			}
+		}
+	}
+
+	for _, ts := range structDecls {
+		st, err := s.collectStruct(ts)
+		if err != nil {
+			return nil, nil, err
+		}
+		api.Structs = append(api.Structs, st)
+	}
+	for i := range api.Enums {
+		if err := s.collectEnumValues(&api.Enums[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, fn := range fnDecls {
+		f, err := s.collectFunc(fn.decl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.applyExportOptions(&f, fn.export); err != nil {
+			return nil, nil, err
+		}
+		api.Funcs = append(api.Funcs, f)
+		params := pkg.TypesInfo.Defs[fn.decl.Name].Type().(*types.Signature).Params()
+		pos := make([]token.Pos, params.Len())
+		for i := range pos {
+			pos[i] = params.At(i).Pos()
+		}
+		s.paramPos = append(s.paramPos, pos)
+	}
+	return api, s, nil
+}
+
+// collectErrCodes collects the capi:errcode variables of a var declaration.
+func (s *scan) collectErrCodes(api *API, d *ast.GenDecl) error {
+	for _, spec := range d.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		ds, err := s.directives("var", d.Doc, vs.Doc)
+		if err != nil {
+			return err
+		}
+		dir, ok := ds["errcode"]
+		if !ok {
+			continue
+		}
+		if len(vs.Names) != 1 {
+			return s.errorf(vs.Pos(), "capi:errcode: declare one variable per code")
+		}
+		name := vs.Names[0].Name
+		obj := s.pkg.TypesInfo.Defs[vs.Names[0]]
+		if !ast.IsExported(name) {
+			return s.errorf(vs.Pos(), "capi:errcode: %s must be exported", name)
+		}
+		if obj == nil || !types.Implements(obj.Type(), errorInterface) {
+			return s.errorf(vs.Pos(), "capi:errcode: %s must be an error", name)
+		}
+		raw, ok := dir.Args["code"]
+		if !ok {
+			return s.errorf(dir.Pos, "capi:errcode: %s: missing code=N", name)
+		}
+		code, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || code < MinErrCode {
+			return s.errorf(dir.Pos, "capi:errcode: %s: code must be an integer >= %d (lower codes are reserved), got %q", name, MinErrCode, raw)
+		}
+		ec := ErrCode{Name: name, CName: upperSnake(strings.TrimPrefix(name, "Err")), Code: int32(code)}
+		if n, ok := dir.Args["name"]; ok {
+			if !cIdent.MatchString(n) {
+				return s.errorf(dir.Pos, "capi:errcode: name %q is not a valid C identifier", n)
+			}
+			ec.CName = n
+		}
+		api.ErrCodes = append(api.ErrCodes, ec)
+	}
+	return nil
+}
+
+// MinErrCode is the lowest status code capi:errcode may use; lower codes are reserved for forgec.
+const MinErrCode = 100
+
+var errorInterface = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// upperSnake converts a Go identifier to UPPER_SNAKE_CASE: NotFound -> NOT_FOUND, HTTPStatus -> HTTP_STATUS.
+func upperSnake(name string) string {
+	rs := []rune(name)
+	var b strings.Builder
+	for i, r := range rs {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// errorf reports an error at pos as file:line:col.
+func (s *scan) errorf(pos token.Pos, format string, args ...any) error {
+	return fmt.Errorf("%s: %s", s.pkg.Fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+func (s *scan) collectFunc(fn *ast.FuncDecl) (Func, error) {
+	obj, ok := s.pkg.TypesInfo.Defs[fn.Name].(*types.Func)
+	if !ok {
+		return Func{}, s.errorf(fn.Pos(), "%s: not a function", fn.Name.Name)
+	}
+	sig := obj.Type().(*types.Signature)
+	f := Func{Name: fn.Name.Name, CName: fn.Name.Name}
+	if recv := sig.Recv(); recv != nil {
+		rt := recv.Type()
+		if ptr, ok := rt.(*types.Pointer); ok {
+			rt = ptr.Elem()
+		}
+		f.Recv = s.localName(rt)
+		if !s.handles[f.Recv] {
+			return Func{}, s.errorf(fn.Pos(), "%s.%s: receiver must be a capi:handle type", s.typeString(rt), fn.Name.Name)
+		}
+		f.CName = f.Recv + "_" + fn.Name.Name
+	}
+	if sig.TypeParams().Len() > 0 || sig.RecvTypeParams().Len() > 0 {
+		return Func{}, s.errorf(fn.Pos(), "%s: generic functions cannot be exported", f.CName)
+	}
+	if sig.Variadic() {
+		return Func{}, s.errorf(fn.Pos(), "%s: variadic functions cannot be exported", f.CName)
+	}
+
+	params := sig.Params()
+	for i := 0; i < params.Len(); i++ {
+		p := params.At(i)
+		name := paramName(p, i)
+		f.Params = append(f.Params, name)
+		f.ParamGoTypes = append(f.ParamGoTypes, p.Type())
+		if cbSig, ok := p.Type().Underlying().(*types.Signature); ok {
+			cb, err := s.collectCallback(name, cbSig)
+			if err != nil {
+				return Func{}, s.errorf(p.Pos(), "%s: callback %s: %v", f.CName, name, err)
+			}
+			f.ParamTypes = append(f.ParamTypes, callbackKey(cb))
+			f.Callbacks = append(f.Callbacks, cb)
+			continue
+		}
+		key := s.typeKey(p.Type())
+		if key == "" {
+			return Func{}, s.errorf(p.Pos(), "%s: unsupported param type: %s", f.CName, s.typeString(p.Type()))
+		}
+		f.ParamTypes = append(f.ParamTypes, key)
+	}
+	if err := s.checkParamNames(f, params); err != nil {
+		return Func{}, err
+	}
+
+	results := sig.Results()
+	switch {
+	case results.Len() == 1 && isErrorType(results.At(0).Type()):
+	case results.Len() == 1:
+		return Func{}, s.errorf(fn.Pos(), "%s: single result must be error", f.CName)
+	case results.Len() == 2:
+		rt := results.At(0).Type()
+		key := s.typeKey(rt)
+		if key == "" {
+			return Func{}, s.errorf(fn.Pos(), "%s: unsupported result type: %s", f.CName, s.typeString(rt))
+		}
+		if !isErrorType(results.At(1).Type()) {
+			return Func{}, s.errorf(fn.Pos(), "%s: second result must be error: %s", f.CName, s.typeString(results.At(1).Type()))
+		}
+		f.HasValue, f.RetType, f.RetGoType = true, key, rt
+	default:
+		return Func{}, s.errorf(fn.Pos(), "%s: result must be error or (T, error)", f.CName)
+	}
+	return f, nil
+}
+
+// wrapperNames are declared by every generated export wrapper in exports.go: its locals, the
+// result out-params and the packages it refers to. Methods also declare the receiver h and hGo.
+var wrapperNames = map[string]bool{
+	"errno": true, "capiCall": true, "recovered": true, "res": true, "err": true, "cerr": true,
+	"out": true, "out_len": true, "C": true, "capi": true, "errors": true, "fmt": true, "json": true,
+	"math": true, "time": true, "unsafe": true,
+}
+
+// cKeywords cannot name a param of a C prototype.
+var cKeywords = map[string]bool{
+	"auto": true, "char": true, "const": true, "double": true, "enum": true, "extern": true, "float": true,
+	"int": true, "long": true, "register": true, "restrict": true, "short": true, "signed": true,
+	"sizeof": true, "static": true, "typedef": true, "union": true, "unsigned": true, "void": true,
+	"volatile": true, "while": true, "do": true, "inline": true, "bool": true, "true": true, "false": true,
+}
+
+// checkParamNames rejects params that would collide in exports.go or forgec.h: names the wrapper
+// declares itself, C keywords, and the names derived from other params (<p>Go for the converted
+// value, <p>_len for a buffer length, <p>_user_data for callback data).
+func (s *scan) checkParamNames(f Func, params *types.Tuple) error {
+	derived := map[string]string{}
+	for _, pn := range f.Params {
+		for _, n := range []string{pn + "Go", pn + "_len", pn + "_user_data"} {
+			derived[n] = pn
+		}
+	}
+	for i, pn := range f.Params {
+		pos := params.At(i).Pos()
+		switch {
+		case wrapperNames[pn], f.Recv != "" && (pn == "h" || pn == "hGo"):
+			return s.errorf(pos, "%s: param name %s is reserved by the generated wrapper; rename it", f.CName, pn)
+		case cKeywords[pn]:
+			return s.errorf(pos, "%s: param name %s is a C keyword; rename it", f.CName, pn)
+		}
+		if other, ok := derived[pn]; ok {
+			return s.errorf(pos, "%s: param name %s collides with the generated name of param %s; rename it", f.CName, pn, other)
+		}
+	}
+	return nil
+}
+
+// checkAliases rejects params named like a package alias: exports.go refers to the scanned
+// packages through them, so such a param would shadow a package inside the wrapper.
+func (s *scan) checkAliases(api *API, aliases map[string]bool) error {
+	for i, f := range api.Funcs {
+		for j, pn := range f.Params {
+			if aliases[pn] {
+				return s.errorf(s.paramPos[i][j], "%s: param name %s is reserved by the generated wrapper; rename it", f.CName, pn)
+			}
+		}
+	}
+	return nil
+}
+
+// collectCallback checks a func-typed param: params must be LookupType types,
+// and the result (if any) a single scalar.
+func (s *scan) collectCallback(param string, sig *types.Signature) (Callback, error) {
+	cb := Callback{Param: param}
+	if sig.Variadic() {
+		return cb, errors.New("variadic callbacks are not supported")
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		p := sig.Params().At(i)
+		key := basicKey(p.Type())
+		if key == "" {
+			return cb, fmt.Errorf("unsupported param type: %s", s.typeString(p.Type()))
+		}
+		name := paramName(p, i)
+		if cKeywords[name] || name == "user_data" {
+			return cb, fmt.Errorf("param name %s is reserved in the C typedef; rename it", name)
+		}
+		cb.Params = append(cb.Params, name)
+		cb.ParamTypes = append(cb.ParamTypes, key)
+		cb.ParamGoTypes = append(cb.ParamGoTypes, p.Type())
+	}
+	switch sig.Results().Len() {
+	case 0:
+	case 1:
+		rt := sig.Results().At(0).Type()
+		key := basicKey(rt)
+		if ct, ok := LookupType(key); !ok || ct.Kind != KindScalar {
+			return cb, fmt.Errorf("result must be a scalar: %s", s.typeString(rt))
+		}
+		cb.RetType, cb.RetGoType = key, rt
+	default:
+		return cb, errors.New("at most one result is supported")
+	}
+	return cb, nil
+}
+
+// callbackKey renders the canonical ParamTypes key of a callback, e.g., func(string) int32.
+func callbackKey(cb Callback) string {
+	key := "func(" + strings.Join(cb.ParamTypes, ", ") + ")"
+	if cb.RetType != "" {
+		key += " " + cb.RetType
+	}
+	return key
+}
+
+func paramName(p *types.Var, i int) string {
+	if p.Name() == "" || p.Name() == "_" {
+		return fmt.Sprintf("p%d", i)
+	}
+	return p.Name()
+}
+
+// typeKey returns the canonical ParamTypes/RetType key of t, or "" if t cannot cross the C boundary.
+func (s *scan) typeKey(t types.Type) string {
+	t = types.Unalias(t)
+	if ptr, ok := t.(*types.Pointer); ok {
+		// structs by pointer, handles only by pointer
+		name := s.localName(ptr.Elem())
+		if s.structs[name] || s.handles[name] {
+			return "*" + name
+		}
+		return ""
+	}
+	if name := s.localName(t); name != "" {
+		if s.structs[name] || s.enums[name] {
+			return name
+		}
+		if s.handles[name] {
+			return ""
+		}
+	}
+	return basicKey(t)
+}
+
+// basicKey resolves t to a LookupType key through its underlying type, or "".
+func basicKey(t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		// types.Typ is indexed by kind, so byte/rune report as uint8/int32
+		name := types.Typ[u.Kind()].Name()
+		if _, ok := LookupType(name); ok {
+			return name
+		}
+	case *types.Slice:
+		if b, ok := u.Elem().Underlying().(*types.Basic); ok && b.Kind() == types.Uint8 {
+			return "[]byte"
+		}
+	}
+	return ""
+}
+
+// fieldDocs returns the doc and line comments of the i-th field of a struct type declaration,
+// or nothing if the struct is not declared literally (type User other.User).
+func fieldDocs(ts *ast.TypeSpec, i int) []*ast.CommentGroup {
+	lit, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return nil
+	}
+	n := 0
+	for _, f := range lit.Fields.List {
+		names := len(f.Names)
+		if names == 0 {
+			names = 1 // embedded
+		}
+		if i < n+names {
+			return []*ast.CommentGroup{f.Doc, f.Comment}
+		}
+		n += names
+	}
+	return nil
+}
+
+// localName returns the name of t if it is a named type declared in the scanned package.
+func (s *scan) localName(t types.Type) string {
+	n, ok := types.Unalias(t).(*types.Named)
+	if !ok || n.Obj().Pkg() != s.pkg.Types {
+		return ""
+	}
+	return n.Obj().Name()
+}
+
+func (s *scan) typeString(t types.Type) string {
+	return types.TypeString(t, types.RelativeTo(s.pkg.Types))
+}
+
+func isErrorType(t types.Type) bool {
+	return types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+func (s *scan) collectStruct(ts *ast.TypeSpec) (Struct, error) {
+	st := s.pkg.TypesInfo.Defs[ts.Name].Type().Underlying().(*types.Struct)
+	var fields []Field
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		// skip embedded/anonymous and unexported fields (exports.go cannot reach them)
+		if v.Anonymous() || !v.Exported() {
+			continue
+		}
+		ds, err := s.directives("field", fieldDocs(ts, i)...)
+		if err != nil {
+			return Struct{}, err
+		}
+		if _, ok := ds["skip"]; ok {
+			continue
+		}
+		key, ctype, exportName, ok := mapGoToCField(v.Name(), v.Type())
+		if !ok {
+			return Struct{}, s.errorf(v.Pos(), "struct %s: unsupported field type: %s", ts.Name.Name, s.typeString(v.Type()))
+		}
+		fields = append(fields, Field{Name: v.Name(), GoType: key, CType: ctype, ExportName: exportName, Type: v.Type()})
+	}
+	return Struct{Name: ts.Name.Name, Fields: fields}, nil
+}
+
+func mapGoToCField(base string, t types.Type) (key string, ctype string, exportName string, ok bool) {
+	exportName = base
+	// time.Time -> int64 unix
+	if n, isNamed := types.Unalias(t).(*types.Named); isNamed && n.Obj().Pkg() != nil && n.Obj().Pkg().Path() == "time" && n.Obj().Name() == "Time" {
+		return "time.Time", "int64_t", base + "Unix", true
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		key = types.Typ[u.Kind()].Name()
+		switch key {
+		case "string":
+			return key, "const char*", exportName, true
+		case "bool":
+			return key, "int32_t", exportName, true
+		}
+		// other numeric fields share the function param/result mapping
+		if ct, ok := LookupType(key); ok && ct.Kind == KindScalar {
+			return key, ct.C, exportName, true
+		}
+	case *types.Map:
+		// map[string]int64 -> JSON string
+		if basicKey(u.Key()) == "string" && basicKey(u.Elem()) == "int64" {
+			return "map[string]int64", "const char*", base + "JSON", true
+		}
+	}
+	return "", "", "", false
+}
+
+// collectEnumValues gathers the package-level constants of e's type, in declaration order.
+func (s *scan) collectEnumValues(e *Enum) error {
+	scope := s.pkg.Types.Scope()
+	typ := scope.Lookup(e.Name).Type()
+	var consts []*types.Const
+	for _, name := range scope.Names() {
+		c, ok := scope.Lookup(name).(*types.Const)
+		if ok && types.Identical(c.Type(), typ) {
+			consts = append(consts, c)
+		}
+	}
+	if len(consts) == 0 {
+		return s.errorf(scope.Lookup(e.Name).Pos(), "enum %s: no constants of this type found", e.Name)
+	}
+	sort.Slice(consts, func(i, j int) bool { return consts[i].Pos() < consts[j].Pos() })
+	for _, c := range consts {
+		iv, exact := constant.Int64Val(c.Val())
+		if !exact || iv < math.MinInt32 || iv > math.MaxInt32 {
+			return s.errorf(c.Pos(), "const %s: value %s does not fit a C enum", c.Name(), c.Val())
+		}
+		cname := strings.TrimPrefix(strings.TrimPrefix(c.Name(), e.Name), "_")
+		if cname == "" {
+			cname = c.Name()
+		}
+		e.Values = append(e.Values, EnumValue{Name: c.Name(), CName: cname, Value: iv})
+	}
+	return nil
 }
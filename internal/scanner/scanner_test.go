@@ -0,0 +1,158 @@
+package scanner
+
+import (
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func scanOne(t *testing.T, pattern string) *API {
+	t.Helper()
+	apis, err := ScanExported("testdata", pattern)
+	if err != nil {
+		t.Fatalf("ScanExported(%s): %v", pattern, err)
+	}
+	if len(apis) != 1 {
+		t.Fatalf("ScanExported(%s): got %d APIs, want 1", pattern, len(apis))
+	}
+	return apis[0]
+}
+
+func findFunc(api *API, name string) (Func, bool) {
+	for _, f := range api.Funcs {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Func{}, false
+}
+
+func TestScanResolvesNamedTypes(t *testing.T) {
+	api := scanOne(t, "./named")
+	tests := []struct {
+		fn         string
+		paramTypes []string
+		retType    string
+	}{
+		// type UserID int64, type Ratio = float64, type Label string, type Blob []byte, time.Duration
+		{"Lookup", []string{"int64", "float64", "string", "[]byte", "int64"}, "int64"},
+		{"Timeout", []string{"int64"}, "int64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fn, func(t *testing.T) {
+			f, ok := findFunc(api, tt.fn)
+			if !ok {
+				t.Fatalf("%s not scanned", tt.fn)
+			}
+			if got := strings.Join(f.ParamTypes, ","); got != strings.Join(tt.paramTypes, ",") {
+				t.Errorf("ParamTypes = %s, want %s", got, strings.Join(tt.paramTypes, ","))
+			}
+			if !f.HasValue || f.RetType != tt.retType {
+				t.Errorf("RetType = %q (HasValue %v), want %q", f.RetType, f.HasValue, tt.retType)
+			}
+		})
+	}
+	// The declared Go types are kept to spell conversions in exports.go.
+	f, _ := findFunc(api, "Lookup")
+	if got := f.ParamGoTypes[0].String(); !strings.HasSuffix(got, "named.UserID") {
+		t.Errorf("ParamGoTypes[0] = %s, want named.UserID", got)
+	}
+	if got := f.ParamGoTypes[4].String(); got != "time.Duration" {
+		t.Errorf("ParamGoTypes[4] = %s, want time.Duration", got)
+	}
+}
+
+func TestScanSkipsExcludedFiles(t *testing.T) {
+	api := scanOne(t, "./named")
+	excluded := []string{"Tagged", "TestOnly"} // build tag not set, _test.go file
+	if runtime.GOOS != "windows" {
+		excluded = append(excluded, "Windows") // _windows.go
+	}
+	for _, name := range excluded {
+		if _, ok := findFunc(api, name); ok {
+			t.Errorf("%s was scanned from an excluded file", name)
+		}
+	}
+}
+
+func TestScanSkipsMainPackages(t *testing.T) {
+	apis, err := ScanExported("testdata", "./cmd", "./named")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, api := range apis {
+		if api.Name == "main" {
+			t.Errorf("main package %s was scanned", api.PkgPath)
+		}
+	}
+	if len(apis) != 1 {
+		t.Errorf("got %d APIs, want 1", len(apis))
+	}
+}
+
+func TestScanErrorsArePositioned(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string // regexp matched against the error
+	}{
+		{"./errors/param", `param\.go:4:11: Send: unsupported param type: chan int$`},
+		{"./errors/enum", `enum\.go:4:6: enum Mode: underlying type must be a sized integer type .*, got int$`},
+		{"./errors/result", `result\.go:4:1: Count: single result must be error$`},
+		{"./errors/reserved", `reserved\.go:4:10: Set: param name errno is reserved by the generated wrapper; rename it$`},
+		// p is the alias exports.go imports a single scanned package under.
+		{"./errors/alias", `alias\.go:4:10: Add: param name p is reserved by the generated wrapper; rename it$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			_, err := ScanExported("testdata", tt.pattern)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if !regexp.MustCompile(tt.want).MatchString(err.Error()) {
+				t.Errorf("error = %q, want match for %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    string // name:alias:prefix of each API
+		wantErr string // regexp matched against the error
+	}{
+		{"single", []Entry{{"./multi/a", ""}}, "a:p:", ""},
+		{"prefixes", []Entry{{"./multi/a", "A_"}, {"./multi/b", "B_"}}, "a:p_a:A_,b:p_b:B_", ""},
+		{"pattern", []Entry{{"./multi/...", ""}}, "a:p_a:,b:p_b:,a:p_a2:", ""},
+		// Aliases follow import paths, not the order of the entries.
+		{"same name", []Entry{{"./multi/dup/a", "D_"}, {"./multi/a", "A_"}}, "a:p_a:A_,a:p_a2:D_", ""},
+		{"both entries", []Entry{{"./multi/...", ""}, {"./multi/b", "B_"}}, "", `^package .*/multi/b matched by both -pkg entries "\./multi/\.\.\." and "\./multi/b"$`},
+		// p is only the alias when b is the single package.
+		{"alias", []Entry{{"./multi/b", ""}}, "", `b\.go:4:10: Sub: param name p is reserved by the generated wrapper; rename it$`},
+		// p_b is the alias of the package scanned next to a.
+		{"other alias", []Entry{{"./errors/aliases/a", ""}, {"./errors/aliases/b", ""}}, "", `a\.go:4:10: Add: param name p_b is reserved by the generated wrapper; rename it$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apis, err := ScanEntries("testdata", tt.entries)
+			if tt.wantErr != "" {
+				if err == nil || !regexp.MustCompile(tt.wantErr).MatchString(err.Error()) {
+					t.Errorf("error = %v, want match for %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, api := range apis {
+				got = append(got, api.Name+":"+api.Alias+":"+api.Prefix)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("got %s, want %s", strings.Join(got, ","), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+// Command cmd is a main package, which the scanner skips.
+package main
+
+// capi:export
+func Main() error { return nil }
+
+func main() {}
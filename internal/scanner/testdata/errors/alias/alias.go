@@ -0,0 +1,4 @@
+package alias
+
+// capi:export
+func Add(p, q int32) (int32, error) { return p + q, nil }
@@ -0,0 +1,4 @@
+package a
+
+// capi:export
+func Add(p_b, y int32) (int32, error) { return p_b + y, nil }
@@ -0,0 +1,4 @@
+package b
+
+// capi:export
+func Sub(x, y int32) (int32, error) { return x - y, nil }
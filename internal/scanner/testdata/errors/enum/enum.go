@@ -0,0 +1,6 @@
+package enum
+
+// capi:export
+type Mode int
+
+const ModeFast Mode = 0
@@ -0,0 +1,4 @@
+package param
+
+// capi:export
+func Send(c chan int) error { return nil }
@@ -0,0 +1,4 @@
+package reserved
+
+// capi:export
+func Set(errno int32) error { return nil }
@@ -0,0 +1,4 @@
+package b
+
+// capi:export
+func Sub(p, q int32) (int32, error) { return p - q, nil }
@@ -0,0 +1,4 @@
+package a
+
+// capi:export
+func Mul(x, y int32) (int32, error) { return x * y, nil }
@@ -0,0 +1,20 @@
+// Package named declares named types, aliases and imported types for the scanner tests.
+package named
+
+import "time"
+
+type UserID int64
+
+type Ratio = float64
+
+type Label string
+
+type Blob []byte
+
+// capi:export
+func Lookup(id UserID, r Ratio, l Label, b Blob, d time.Duration) (UserID, error) {
+	return id, nil
+}
+
+// capi:export
+func Timeout(d time.Duration) (time.Duration, error) { return d, nil }
@@ -0,0 +1,4 @@
+package named
+
+// capi:export
+func TestOnly() error { return nil }
@@ -0,0 +1,6 @@
+//go:build forgec_scanner_tag
+
+package named
+
+// capi:export
+func Tagged() error { return nil }
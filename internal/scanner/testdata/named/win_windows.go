@@ -0,0 +1,4 @@
+package named
+
+// capi:export
+func Windows() error { return nil }
@@ -0,0 +1,50 @@
+package scanner
+
+import "strings"
+
+// TypeKind classifies how a param/result value is marshalled across the C boundary.
+type TypeKind int
+
+const (
+	KindScalar TypeKind = iota // copied by value with a numeric conversion
+	KindString                 // const char* in, char** out (released with capi_free)
+	KindBytes                  // const uint8_t*+size_t in, uint8_t**+size_t* out (released with capi_free)
+)
+
+// CType describes how a Go param/result type is spelled in forgec.h and exports.go.
+type CType struct {
+	Kind TypeKind
+	C    string // C type in forgec.h, e.g., int32_t (element type for strings/bytes)
+	Cgo  string // cgo type in exports.go, e.g., C.int32_t
+}
+
+// valueTypes is the single Go→C mapping for exported function params and results.
+// The scanner accepts exactly these types; both writers derive their C spelling from it.
+var valueTypes = map[string]CType{
+	"int8":    {KindScalar, "int8_t", "C.int8_t"},
+	"int16":   {KindScalar, "int16_t", "C.int16_t"},
+	"int32":   {KindScalar, "int32_t", "C.int32_t"},
+	"int64":   {KindScalar, "int64_t", "C.int64_t"},
+	"uint8":   {KindScalar, "uint8_t", "C.uint8_t"},
+	"uint16":  {KindScalar, "uint16_t", "C.uint16_t"},
+	"uint32":  {KindScalar, "uint32_t", "C.uint32_t"},
+	"uint64":  {KindScalar, "uint64_t", "C.uint64_t"},
+	"uintptr": {KindScalar, "uintptr_t", "C.uintptr_t"},
+	"float32": {KindScalar, "float", "C.float"},
+	"float64": {KindScalar, "double", "C.double"},
+	"bool":    {KindScalar, "bool", "C.bool"},
+	"string":  {KindString, "char*", "*C.char"},
+	"[]byte":  {KindBytes, "uint8_t*", "*C.uint8_t"},
+}
+
+// LookupType returns the C mapping for a Go param/result type as recorded in Func.ParamTypes/RetType.
+func LookupType(goType string) (CType, bool) {
+	ct, ok := valueTypes[goType]
+	return ct, ok
+}
+
+// isIntegerType reports whether goType is one of the integer LookupType keys.
+func isIntegerType(goType string) bool {
+	ct, ok := LookupType(goType)
+	return ok && ct.Kind == KindScalar && goType != "bool" && !strings.HasPrefix(goType, "float")
+}
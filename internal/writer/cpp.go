@@ -0,0 +1,707 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WriteCPP writes forgec.hpp, C++17 wrappers over forgec.h in namespace forgec: functions return
+// their out-param and throw forgec::error, and strings, buffers, structs and handles returned by
+// the library are RAII owners. header is the path of forgec.h; the include is relative to path.
+func WriteCPP(path, header, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	c := newCPPNames(m)
+	if err := c.check(); err != nil {
+		return err
+	}
+	include, err := filepath.Rel(filepath.Dir(path), header)
+	if err != nil {
+		include = filepath.Base(header)
+	}
+	var b bytes.Buffer
+	writeCPP(&b, m, c, filepath.ToSlash(include))
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// cppNames spells the model in C++ the way the standard library does: snake_case functions,
+// handle classes and callback types. C declarations keep their names and are qualified with ::.
+type cppNames struct {
+	m    *cModel
+	name map[any]string // *cHandle, *cCallback -> type name
+}
+
+func newCPPNames(m *cModel) *cppNames {
+	c := &cppNames{m: m, name: map[any]string{}}
+	for _, h := range m.Handles {
+		c.name[h] = snakeName(h.Name)
+	}
+	for _, cb := range m.Callbacks {
+		c.name[cb] = snakeName(strings.TrimPrefix(cb.Type, m.Prefix))
+	}
+	return c
+}
+
+// check reports C++ names declared twice in namespace forgec, in a handle class or in a wrapper.
+func (c *cppNames) check() error {
+	names := newNameSet("c++", false)
+	names.reserve("", "forgec", cppHelpers...)
+	for k, name := range c.name {
+		switch v := k.(type) {
+		case *cHandle:
+			if err := names.declare("", name, v.Type); err != nil {
+				return err
+			}
+			names.reserve(name+"::", "forgec", cppHandleMembers...)
+		case *cCallback:
+			if err := names.declare("", name, v.Type); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range c.m.Funcs {
+		scope := ""
+		if f.Recv != nil {
+			scope = c.name[f.Recv] + "::"
+		}
+		if err := names.declare(scope, c.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+		// Parameters share the wrapper body with its locals.
+		local := f.Symbol + "::"
+		names.reserve(local, "forgec", "out", "out_len")
+		for i, p := range f.Params {
+			if i == 0 && f.Recv != nil {
+				continue
+			}
+			ns := []string{cppIdent(p.Name)}
+			if p.Kind == valCallback {
+				ns = append(ns, p.Name+"_cb")
+			}
+			for _, n := range ns {
+				if err := names.declare(local, n, f.Symbol+" parameter "+p.Name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cppHelpers are declared in namespace forgec by every header; functions of the same name are
+// escaped.
+var cppHelpers = []string{"detail", "error", "bytes_view", "unique_string", "unique_bytes", "owned", "status_name",
+	"last_error_json", "clear_last_error", "reporter_configure", "flush"}
+
+// cppHandleMembers are declared by every handle class; methods of the same name are escaped.
+var cppHandleMembers = []string{"get", "detach", "release"}
+
+func (c *cppNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(cppIdent(snakeName(f.Method)), cppHandleMembers)
+	}
+	return memberName(cppIdent(snakeName(f.Name)), cppHelpers)
+}
+
+// cppKeywords are the C++ keywords, which get a trailing underscore as names.
+var cppKeywords = map[string]bool{
+	"alignas": true, "alignof": true, "and": true, "and_eq": true, "asm": true, "auto": true, "bitand": true,
+	"bitor": true, "bool": true, "break": true, "case": true, "catch": true, "char": true, "char8_t": true,
+	"char16_t": true, "char32_t": true, "class": true, "compl": true, "concept": true, "const": true,
+	"consteval": true, "constexpr": true, "constinit": true, "const_cast": true, "continue": true,
+	"co_await": true, "co_return": true, "co_yield": true, "decltype": true, "default": true, "delete": true,
+	"do": true, "double": true, "dynamic_cast": true, "else": true, "enum": true, "explicit": true,
+	"export": true, "extern": true, "false": true, "float": true, "for": true, "friend": true, "goto": true,
+	"if": true, "inline": true, "int": true, "long": true, "mutable": true, "namespace": true, "new": true,
+	"noexcept": true, "not": true, "not_eq": true, "nullptr": true, "operator": true, "or": true,
+	"or_eq": true, "private": true, "protected": true, "public": true, "register": true,
+	"reinterpret_cast": true, "requires": true, "return": true, "short": true, "signed": true, "sizeof": true,
+	"static": true, "static_assert": true, "static_cast": true, "struct": true, "switch": true,
+	"template": true, "this": true, "thread_local": true, "throw": true, "true": true, "try": true,
+	"typedef": true, "typeid": true, "typename": true, "union": true, "unsigned": true, "using": true,
+	"virtual": true, "void": true, "volatile": true, "wchar_t": true, "while": true, "xor": true,
+	"xor_eq": true,
+}
+
+// cppIdent appends an underscore to C++ keywords.
+func cppIdent(name string) string {
+	if cppKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// paramType is the C++ type of a wrapper parameter.
+func (c *cppNames) paramType(v cValue) string {
+	switch v.Kind {
+	case valHandle:
+		return "const " + c.name[v.Handle] + "&"
+	case valString:
+		return "std::string_view"
+	case valBytes:
+		return "bytes_view"
+	case valStruct:
+		return "const ::" + v.C + "&"
+	case valCallback:
+		return "const " + c.name[v.Callback] + "&"
+	case valEnum:
+		return "::" + v.C
+	}
+	return v.C
+}
+
+// resultType is the C++ type a wrapper returns.
+func (c *cppNames) resultType(r *cValue) string {
+	if r == nil {
+		return "void"
+	}
+	switch r.Kind {
+	case valHandle:
+		return c.name[r.Handle]
+	case valString:
+		return "unique_string"
+	case valBytes:
+		return "unique_bytes"
+	case valStruct:
+		return "owned<::" + r.C + ">"
+	case valEnum:
+		return "::" + r.C
+	}
+	return r.C
+}
+
+func writeCPP(b *bytes.Buffer, m *cModel, c *cppNames, include string) {
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n\n")
+	b.WriteString("// C++17 wrappers of forgec.h. The functions return the out-param and throw forgec::error on\n")
+	b.WriteString("// a non-OK status. Strings, buffers, structs and handles returned by the library are owned by\n")
+	b.WriteString("// unique_string, unique_bytes, owned<S> and the handle classes, which release them on destruction.\n")
+	b.WriteString("// With C++20, bytes_view is std::span<const std::uint8_t>.\n")
+	b.WriteString("#pragma once\n\n")
+	fmt.Fprintf(b, "#include %q\n\n", include)
+	b.WriteString(`#include <cstddef>
+#include <cstdint>
+#include <exception>
+#include <functional>
+#include <memory>
+#include <stdexcept>
+#include <string>
+#include <string_view>
+#include <utility>
+#include <vector>
+#if __has_include(<version>)
+#include <version>
+#endif
+#ifdef __cpp_lib_span
+#include <span>
+#endif
+
+`)
+	// The wrappers of deprecated exports call them; only callers of the wrappers should be warned.
+	b.WriteString(`#if defined(__GNUC__)
+#pragma GCC diagnostic push
+#pragma GCC diagnostic ignored "-Wdeprecated-declarations"
+#elif defined(_MSC_VER)
+#pragma warning(push)
+#pragma warning(disable : 4996)
+#endif
+
+namespace forgec {
+
+#ifdef __cpp_lib_span
+using bytes_view = std::span<const std::uint8_t>;
+#else
+// bytes_view is a borrowed byte buffer passed to the library, like std::span<const std::uint8_t>.
+class bytes_view {
+public:
+    constexpr bytes_view() noexcept = default;
+    constexpr bytes_view(const std::uint8_t* data, std::size_t size) noexcept : data_(data), size_(size) {}
+    bytes_view(const std::vector<std::uint8_t>& v) noexcept : data_(v.data()), size_(v.size()) {}
+
+    constexpr const std::uint8_t* data() const noexcept { return data_; }
+    constexpr std::size_t size() const noexcept { return size_; }
+    constexpr bool empty() const noexcept { return size_ == 0; }
+    constexpr const std::uint8_t* begin() const noexcept { return data_; }
+    constexpr const std::uint8_t* end() const noexcept { return data_ + size_; }
+
+private:
+    const std::uint8_t* data_ = nullptr;
+    std::size_t size_ = 0;
+};
+#endif
+
+namespace detail {
+
+struct free_deleter {
+    void operator()(void* p) const noexcept { ::capi_free(p); }
+};
+
+inline std::string_view view(const char* s) noexcept {
+    return s ? std::string_view(s) : std::string_view();
+}
+
+// read_string decodes the JSON string starting at the quote json[i] into out and returns the
+// index of its closing quote.
+inline std::size_t read_string(std::string_view json, std::size_t i, std::string& out) {
+    for (++i; i < json.size() && json[i] != '"'; ++i) {
+        char c = json[i];
+        if (c != '\\' || i + 1 == json.size()) {
+            out += c;
+            continue;
+        }
+        switch (c = json[++i]) {
+        case 'b': out += '\b'; break;
+        case 'f': out += '\f'; break;
+        case 'n': out += '\n'; break;
+        case 'r': out += '\r'; break;
+        case 't': out += '\t'; break;
+        case 'u': {
+            if (i + 4 >= json.size()) {
+                return json.size();
+            }
+            unsigned long r = std::stoul(std::string(json.substr(i + 1, 4)), nullptr, 16);
+            i += 4;
+            if (r < 0x80) {
+                out += static_cast<char>(r);
+            } else if (r < 0x800) {
+                out += static_cast<char>(0xC0 | (r >> 6));
+                out += static_cast<char>(0x80 | (r & 0x3F));
+            } else {
+                out += static_cast<char>(0xE0 | (r >> 12));
+                out += static_cast<char>(0x80 | ((r >> 6) & 0x3F));
+                out += static_cast<char>(0x80 | (r & 0x3F));
+            }
+            break;
+        }
+        default: out += c;
+        }
+    }
+    return i;
+}
+
+// json_string returns the string member key of the top-level JSON object, or "" if it has none.
+inline std::string json_string(std::string_view json, std::string_view key) {
+    int depth = 0;
+    for (std::size_t i = 0; i < json.size(); ++i) {
+        const char c = json[i];
+        if (c == '{' || c == '[') {
+            ++depth;
+        } else if (c == '}' || c == ']') {
+            --depth;
+        } else if (c == '"') {
+            std::string name;
+            i = read_string(json, i, name);
+            std::size_t j = json.find_first_not_of(" \t\r\n", i + 1);
+            if (depth != 1 || name != key || j == std::string_view::npos || json[j] != ':') {
+                continue;
+            }
+            j = json.find_first_not_of(" \t\r\n", j + 1);
+            std::string value;
+            if (j != std::string_view::npos && json[j] == '"') {
+                read_string(json, j, value);
+            }
+            return value;
+        }
+    }
+    return {};
+}
+
+} // namespace detail
+
+// unique_string owns a string returned by the library and frees it with capi_free.
+class unique_string {
+public:
+    unique_string() noexcept = default;
+    explicit unique_string(char* p) noexcept : p_(p) {}
+
+    const char* c_str() const noexcept { return p_ ? p_.get() : ""; }
+    std::string_view view() const noexcept { return detail::view(p_.get()); }
+    std::string str() const { return std::string(view()); }
+    operator std::string_view() const noexcept { return view(); }
+    operator std::string() const { return str(); }
+
+    // release gives up ownership; free the string with capi_free.
+    char* release() noexcept { return p_.release(); }
+
+private:
+    std::unique_ptr<char, detail::free_deleter> p_;
+};
+
+// unique_bytes owns a buffer returned by the library and frees it with capi_free.
+class unique_bytes {
+public:
+    unique_bytes() noexcept = default;
+    unique_bytes(std::uint8_t* p, std::size_t size) noexcept : p_(p), size_(size) {}
+    unique_bytes(unique_bytes&& o) noexcept : p_(std::move(o.p_)), size_(std::exchange(o.size_, 0)) {}
+    unique_bytes& operator=(unique_bytes&& o) noexcept {
+        p_ = std::move(o.p_);
+        size_ = std::exchange(o.size_, 0);
+        return *this;
+    }
+
+    const std::uint8_t* data() const noexcept { return p_.get(); }
+    std::size_t size() const noexcept { return size_; }
+    bool empty() const noexcept { return size_ == 0; }
+    const std::uint8_t* begin() const noexcept { return p_.get(); }
+    const std::uint8_t* end() const noexcept { return p_.get() + size_; }
+    bytes_view view() const noexcept { return bytes_view(p_.get(), size_); }
+    operator bytes_view() const noexcept { return view(); }
+    std::vector<std::uint8_t> to_vector() const { return std::vector<std::uint8_t>(begin(), end()); }
+
+    // release gives up ownership; free the buffer with capi_free.
+    std::uint8_t* release() noexcept {
+        size_ = 0;
+        return p_.release();
+    }
+
+private:
+    std::unique_ptr<std::uint8_t, detail::free_deleter> p_;
+    std::size_t size_ = 0;
+};
+
+`)
+	fmt.Fprintf(b, "// status_name returns the name of a %s code, e.g., NOT_FOUND, or \"\" if it is unknown.\n", m.Status.Type)
+	b.WriteString("inline const char* status_name(std::int32_t status) noexcept {\n")
+	b.WriteString("    switch (status) {\n")
+	for _, v := range m.Status.Values {
+		fmt.Fprintf(b, "    case %d: return %q;\n", v.Value, v.Name)
+	}
+	b.WriteString("    default: return \"\";\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n\n")
+
+	b.WriteString(`// last_error_json returns the last error recorded on the calling thread as JSON ("{}" if none).
+inline std::string last_error_json() {
+    unique_string json(const_cast<char*>(::capi_last_error_json()));
+    return json.view().empty() ? std::string("{}") : json.str();
+}
+
+inline void clear_last_error() noexcept {
+    ::capi_clear_last_error();
+}
+
+// error is thrown when an export returns a non-OK status. json() is the capi_last_error_json
+// record (see forgec.error.schema.json); what() is "<function>: <error>".
+class error : public std::runtime_error {
+public:
+    error(std::int32_t status, std::string json)
+        : std::runtime_error(detail::json_string(json, "function") + ": " + detail::json_string(json, "error")),
+          status_(status),
+          json_(std::move(json)) {}
+
+    std::int32_t status() const noexcept { return status_; }
+    const std::string& json() const noexcept { return json_; }
+
+    // function returns the C name of the failed export, e.g., PM_Find.
+    std::string function() const { return detail::json_string(json_, "function"); }
+
+    // message returns the Go error message.
+    std::string message() const { return detail::json_string(json_, "error"); }
+
+    // type returns the Go type of the error or panic value.
+    std::string type() const { return detail::json_string(json_, "type"); }
+
+private:
+    std::int32_t status_;
+    std::string json_;
+};
+
+namespace detail {
+
+inline void check(std::int32_t status) {
+    if (status != 0) {
+        throw error(status, last_error_json());
+    }
+}
+
+// callback passes a std::function to a C callback through its user_data. Exceptions cannot
+// unwind through the library, so call keeps the first one and check rethrows it once the
+// export returns; later calls return a zero value.
+template <class F>
+struct callback {
+    const F& fn;
+    std::exception_ptr err;
+
+    template <class... Args>
+    typename F::result_type call(Args&&... args) noexcept {
+        if (!err) {
+            try {
+                return fn(std::forward<Args>(args)...);
+            } catch (...) {
+                err = std::current_exception();
+            }
+        }
+        return typename F::result_type();
+    }
+};
+
+template <class F, class... Rest>
+void check(std::int32_t status, const callback<F>& cb, const Rest&... rest) {
+    if (cb.err) {
+        std::rethrow_exception(cb.err);
+    }
+    check(status, rest...);
+}
+
+`)
+	for _, st := range m.Structs {
+		fmt.Fprintf(b, "inline void free_struct(::%s* s) noexcept {\n    ::%s(s);\n}\n\n", st.Name, st.Free)
+	}
+	b.WriteString(`} // namespace detail
+
+// reporter_configure configures a registered reporter, e.g., "jsonl" or "sentry".
+inline void reporter_configure(std::string_view name, std::string_view config) {
+    detail::check(::capi_reporter_configure(std::string(name).c_str(), std::string(config).c_str()));
+}
+
+// flush waits up to timeout_ms for reporters to deliver queued reports.
+inline bool flush(std::uint32_t timeout_ms) noexcept {
+    return ::capi_flush(timeout_ms);
+}
+
+`)
+	if len(m.Structs) > 0 {
+		b.WriteString(`// owned holds a struct returned by the library and frees its strings on destruction.
+template <class T>
+class owned {
+public:
+    owned() noexcept = default;
+    explicit owned(const T& value) noexcept : value_(value) {}
+    owned(owned&& o) noexcept : value_(std::exchange(o.value_, T{})) {}
+    owned& operator=(owned&& o) noexcept {
+        if (this != &o) {
+            detail::free_struct(&value_);
+            value_ = std::exchange(o.value_, T{});
+        }
+        return *this;
+    }
+    owned(const owned&) = delete;
+    owned& operator=(const owned&) = delete;
+    ~owned() { detail::free_struct(&value_); }
+
+    const T& get() const noexcept { return value_; }
+    const T& operator*() const noexcept { return value_; }
+    const T* operator->() const noexcept { return &value_; }
+
+private:
+    T value_{};
+};
+
+`)
+	}
+
+	for _, cb := range m.Callbacks {
+		var ts []string
+		for _, p := range cb.Params {
+			switch p.Kind {
+			case valString:
+				ts = append(ts, "std::string_view")
+			case valBytes:
+				ts = append(ts, "bytes_view")
+			default:
+				ts = append(ts, p.C)
+			}
+		}
+		ret := "void"
+		if cb.Ret != "" {
+			ret = cb.Ret
+		}
+		fmt.Fprintf(b, "// %s is called through %s while the export runs.\n", c.name[cb], cb.Type)
+		fmt.Fprintf(b, "using %s = std::function<%s(%s)>;\n\n", c.name[cb], ret, strings.Join(ts, ", "))
+	}
+
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "class %s;\n", c.name[h])
+	}
+	if len(m.Handles) > 0 {
+		b.WriteString("\n")
+	}
+	for _, h := range m.Handles {
+		name := c.name[h]
+		fmt.Fprintf(b, "// %s owns a %s and releases it with %s on destruction.\n", name, h.Type, h.Release)
+		fmt.Fprintf(b, "class %s {\n", name)
+		b.WriteString("public:\n")
+		fmt.Fprintf(b, "    %s() noexcept = default;\n", name)
+		fmt.Fprintf(b, "    explicit %s(::%s h) noexcept : h_(h) {}\n", name, h.Type)
+		fmt.Fprintf(b, "    %s(%s&& o) noexcept : h_(std::exchange(o.h_, 0)) {}\n", name, name)
+		fmt.Fprintf(b, "    %s& operator=(%s&& o) noexcept {\n", name, name)
+		b.WriteString("        if (this != &o) {\n")
+		b.WriteString("            if (h_ != 0) {\n")
+		fmt.Fprintf(b, "                ::%s(h_);\n", h.Release)
+		b.WriteString("            }\n")
+		b.WriteString("            h_ = std::exchange(o.h_, 0);\n")
+		b.WriteString("        }\n")
+		b.WriteString("        return *this;\n")
+		b.WriteString("    }\n")
+		fmt.Fprintf(b, "    %s(const %s&) = delete;\n", name, name)
+		fmt.Fprintf(b, "    %s& operator=(const %s&) = delete;\n", name, name)
+		fmt.Fprintf(b, "    ~%s() {\n", name)
+		b.WriteString("        if (h_ != 0) {\n")
+		fmt.Fprintf(b, "            ::%s(h_);\n", h.Release)
+		b.WriteString("        }\n")
+		b.WriteString("    }\n\n")
+		fmt.Fprintf(b, "    ::%s get() const noexcept { return h_; }\n", h.Type)
+		b.WriteString("    explicit operator bool() const noexcept { return h_ != 0; }\n\n")
+		b.WriteString("    // detach gives up ownership of the handle without releasing it.\n")
+		fmt.Fprintf(b, "    ::%s detach() noexcept { return std::exchange(h_, 0); }\n\n", h.Type)
+		b.WriteString("    // release releases the handle now, reporting a failure.\n")
+		b.WriteString("    void release() {\n")
+		b.WriteString("        if (h_ != 0) {\n")
+		fmt.Fprintf(b, "            detail::check(::%s(std::exchange(h_, 0)));\n", h.Release)
+		b.WriteString("        }\n")
+		b.WriteString("    }\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			fmt.Fprintf(b, "    // `%s`\n", strings.TrimSuffix(f.cPrototype(), ";"))
+			attr := ""
+			if f.Deprecated != "" {
+				attr = fmt.Sprintf("[[deprecated(%q)]] ", f.Deprecated)
+			}
+			fmt.Fprintf(b, "    %s%s %s(%s) const;\n", attr, c.resultType(f.Result), c.funcName(f), strings.Join(c.params(f), ", "))
+		}
+		b.WriteString("\n")
+		b.WriteString("private:\n")
+		fmt.Fprintf(b, "    ::%s h_ = 0;\n", h.Type)
+		b.WriteString("};\n\n")
+	}
+
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			writeCPPFunc(b, c, f)
+		}
+	}
+	for _, h := range m.Handles {
+		for _, f := range h.Methods {
+			writeCPPFunc(b, c, f)
+		}
+	}
+
+	b.WriteString(`} // namespace forgec
+
+#if defined(__GNUC__)
+#pragma GCC diagnostic pop
+#elif defined(_MSC_VER)
+#pragma warning(pop)
+#endif
+`)
+}
+
+// params are the parameters of the wrapper of f, without the receiver of a method.
+func (c *cppNames) params(f *cFunc) []string {
+	var ps []string
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			continue
+		}
+		ps = append(ps, c.paramType(p)+" "+cppIdent(p.Name))
+	}
+	return ps
+}
+
+func writeCPPFunc(b *bytes.Buffer, c *cppNames, f *cFunc) {
+	name, qual := c.funcName(f), ""
+	if f.Recv != nil {
+		name, qual = c.name[f.Recv]+"::"+name, " const"
+	} else {
+		fmt.Fprintf(b, "// `%s`\n", strings.TrimSuffix(f.cPrototype(), ";"))
+		if f.Deprecated != "" {
+			fmt.Fprintf(b, "[[deprecated(%q)]] ", f.Deprecated)
+		}
+	}
+	fmt.Fprintf(b, "inline %s %s(%s)%s {\n", c.resultType(f.Result), name, strings.Join(c.params(f), ", "), qual)
+	var args, cbs []string
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "h_")
+			continue
+		}
+		n := cppIdent(p.Name)
+		switch p.Kind {
+		case valHandle:
+			args = append(args, n+".get()")
+		case valString:
+			args = append(args, "std::string("+n+").c_str()")
+		case valBytes:
+			args = append(args, n+".data()", n+".size()")
+		case valStruct:
+			args = append(args, "&"+n)
+		case valCallback:
+			cb := p.Name + "_cb"
+			fmt.Fprintf(b, "    detail::callback<%s> %s{%s, nullptr};\n", c.name[p.Callback], cb, n)
+			args = append(args, cppTrampoline(c, p.Callback), "&"+cb)
+			cbs = append(cbs, cb)
+		default:
+			args = append(args, n)
+		}
+	}
+	ret := ""
+	if r := f.Result; r != nil {
+		switch r.Kind {
+		case valHandle:
+			fmt.Fprintf(b, "    ::%s out = 0;\n", r.C)
+			ret = c.name[r.Handle] + "(out)"
+		case valString:
+			b.WriteString("    char* out = nullptr;\n")
+			ret = "unique_string(out)"
+		case valBytes:
+			b.WriteString("    std::uint8_t* out = nullptr;\n")
+			b.WriteString("    std::size_t out_len = 0;\n")
+			ret = "unique_bytes(out, out_len)"
+		case valStruct:
+			fmt.Fprintf(b, "    ::%s out{};\n", r.C)
+			ret = fmt.Sprintf("owned<::%s>(out)", r.C)
+		case valEnum:
+			fmt.Fprintf(b, "    ::%s out{};\n", r.C)
+			ret = "out"
+		default:
+			fmt.Fprintf(b, "    %s out{};\n", r.C)
+			ret = "out"
+		}
+		args = append(args, "&out")
+		if r.Kind == valBytes {
+			args = append(args, "&out_len")
+		}
+	}
+	fmt.Fprintf(b, "    detail::check(%s)", strings.Join(append([]string{fmt.Sprintf("::%s(%s)", f.Symbol, strings.Join(args, ", "))}, cbs...), ", "))
+	b.WriteString(";\n")
+	if ret != "" {
+		fmt.Fprintf(b, "    return %s;\n", ret)
+	}
+	b.WriteString("}\n\n")
+}
+
+// cppTrampoline renders the captureless lambda, converted to the C callback, that calls the
+// std::function passed in user_data.
+func cppTrampoline(c *cppNames, cb *cCallback) string {
+	var ps, args []string
+	for _, p := range cb.Params {
+		n := cppIdent(p.Name)
+		switch p.Kind {
+		case valString:
+			ps = append(ps, "const char* "+n)
+			args = append(args, "detail::view("+n+")")
+		case valBytes:
+			ps = append(ps, "const uint8_t* "+n, "size_t "+p.Name+"_len")
+			args = append(args, fmt.Sprintf("bytes_view(%s, %s_len)", n, p.Name))
+		default:
+			ps = append(ps, p.C+" "+n)
+			args = append(args, n)
+		}
+	}
+	ps = append(ps, "void* user_data")
+	ret := "void"
+	if cb.Ret != "" {
+		ret = cb.Ret
+	}
+	return fmt.Sprintf("[](%s) -> %s { return static_cast<detail::callback<%s>*>(user_data)->call(%s); }",
+		strings.Join(ps, ", "), ret, c.name[cb], strings.Join(args, ", "))
+}
@@ -0,0 +1,38 @@
+package writer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+func TestWriteCPPCompiles(t *testing.T) {
+	cxx, err := exec.LookPath("c++")
+	if err != nil {
+		t.Skip("no C++ compiler")
+	}
+	tests := []struct {
+		name string
+		apis func(*testing.T) []*scanner.API
+	}{
+		{"sample", scanSample},
+		{"members", func(*testing.T) []*scanner.API { return memberAPI() }},
+		{"helpers", func(*testing.T) []*scanner.API { return helperAPI() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := generate(t, "c++", tt.apis(t))
+			src := filepath.Join(dir, "main.cpp")
+			if err := os.WriteFile(src, []byte("#include \"forgec.hpp\"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			out, err := exec.Command(cxx, "-std=c++17", "-Wall", "-Wextra", "-Werror", "-fsyntax-only", src).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,590 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WriteCSharp writes P/Invoke bindings of the scanned packages to path (e.g., Sample.cs): a
+// Native class with the [DllImport] declarations and blittable struct mirrors, and an Api
+// class wrapping them in exceptions, managed strings and arrays. libName is the base name of
+// the shared library built by the build scripts, as passed to [DllImport].
+func WriteCSharp(path, libName, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	cs := newCSNames(m)
+	if err := cs.check(); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	writeCSharpFile(&b, m, cs, libName)
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// csNames spells the model in C#: PascalCase types, members and methods, camelCase params.
+type csNames struct {
+	m    *cModel
+	name map[any]string // *cEnum, *cHandle, *cStruct -> type name
+}
+
+func newCSNames(m *cModel) *csNames {
+	cs := &csNames{m: m, name: map[any]string{m.Status: "Status"}}
+	for _, e := range m.Enums {
+		cs.name[e] = pascalName(e.Name)
+	}
+	for _, h := range m.Handles {
+		cs.name[h] = pascalName(h.Name)
+	}
+	for _, s := range m.Structs {
+		cs.name[s] = pascalName(s.Name)
+	}
+	return cs
+}
+
+// check reports C# type or Api method names declared twice.
+func (cs *csNames) check() error {
+	names := newNameSet("csharp", false)
+	names.reserve("", "forgec", "Api", "Native", "ForgecException")
+	for k, name := range cs.name {
+		var by string
+		switch v := k.(type) {
+		case *cEnum:
+			by = v.Type
+		case *cHandle:
+			by = v.Type
+		case *cStruct:
+			by = v.Name
+		}
+		if err := names.declare("", name, by); err != nil {
+			return err
+		}
+	}
+	for _, h := range cs.m.Handles {
+		names.reserve(cs.name[h]+".", h.Type, csHandleMembers...)
+	}
+	names.reserve("Api.", "forgec", csHelpers...)
+	for _, f := range cs.m.Funcs {
+		scope := "Api."
+		if f.Recv != nil {
+			scope = cs.name[f.Recv] + "."
+		}
+		if err := names.declare(scope, cs.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csHelpers are the public and internal methods of the Api class; functions of the same name
+// are escaped.
+var csHelpers = []string{"LastErrorJson", "ClearLastError", "ReporterConfigure", "Flush", "Check", "Utf8Z", "Utf8",
+	"Bytes", "TakeString", "TakeBytes", "AllocUtf8", "FreeAll", "ToNative", "Take"}
+
+// csHandleMembers are declared by every handle class; methods of the same name are escaped.
+var csHandleMembers = []string{"Handle", "Dispose"}
+
+func (cs *csNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(pascalName(f.Method), csHandleMembers)
+	}
+	return memberName(pascalName(f.Name), csHelpers)
+}
+
+var csKeywords = map[string]bool{
+	"abstract": true, "as": true, "base": true, "bool": true, "break": true, "byte": true, "case": true,
+	"catch": true, "char": true, "checked": true, "class": true, "const": true, "continue": true,
+	"decimal": true, "default": true, "delegate": true, "do": true, "double": true, "else": true,
+	"enum": true, "event": true, "explicit": true, "extern": true, "false": true, "finally": true,
+	"fixed": true, "float": true, "for": true, "foreach": true, "goto": true, "if": true, "implicit": true,
+	"in": true, "int": true, "interface": true, "internal": true, "is": true, "lock": true, "long": true,
+	"namespace": true, "new": true, "null": true, "object": true, "operator": true, "out": true,
+	"override": true, "params": true, "private": true, "protected": true, "public": true, "readonly": true,
+	"ref": true, "return": true, "sbyte": true, "sealed": true, "short": true, "sizeof": true,
+	"stackalloc": true, "static": true, "string": true, "struct": true, "switch": true, "this": true,
+	"throw": true, "true": true, "try": true, "typeof": true, "uint": true, "ulong": true,
+	"unchecked": true, "unsafe": true, "ushort": true, "using": true, "virtual": true, "void": true,
+	"volatile": true, "while": true,
+}
+
+// csIdent escapes C# keywords with @.
+func csIdent(name string) string {
+	if csKeywords[name] {
+		return "@" + name
+	}
+	return name
+}
+
+// csTypes maps C scalar types to C#; bool is marshaled as one byte (csBoolAttr).
+var csTypes = map[string]string{
+	"int8_t":    "sbyte",
+	"int16_t":   "short",
+	"int32_t":   "int",
+	"int64_t":   "long",
+	"uint8_t":   "byte",
+	"uint16_t":  "ushort",
+	"uint32_t":  "uint",
+	"uint64_t":  "ulong",
+	"uintptr_t": "UIntPtr",
+	"float":     "float",
+	"double":    "double",
+	"bool":      "bool",
+}
+
+const csBoolAttr = "[MarshalAs(UnmanagedType.U1)] "
+
+// nativeParams renders the [DllImport] parameter list of an export.
+func (cs *csNames) nativeParams(f *cFunc) []string {
+	var ps []string
+	for _, p := range f.Params {
+		n := csIdent(p.Name)
+		switch p.Kind {
+		case valEnum:
+			ps = append(ps, cs.name[p.Enum]+" "+n)
+		case valHandle:
+			ps = append(ps, "UIntPtr "+n)
+		case valString:
+			ps = append(ps, "byte[] "+n)
+		case valBytes:
+			ps = append(ps, "byte[] "+n, "UIntPtr "+csIdent(p.Name+"_len"))
+		case valStruct:
+			ps = append(ps, "ref "+cs.name[p.Struct]+" "+n)
+		case valCallback:
+			ps = append(ps, p.C+" "+n, "IntPtr "+csIdent(p.Name+"_user_data"))
+		default:
+			ps = append(ps, csAttr(p.C)+csTypes[p.C]+" "+n)
+		}
+	}
+	if r := f.Result; r != nil {
+		switch r.Kind {
+		case valEnum:
+			ps = append(ps, "out "+cs.name[r.Enum]+" @out")
+		case valHandle:
+			ps = append(ps, "out UIntPtr @out")
+		case valString:
+			ps = append(ps, "out IntPtr @out")
+		case valBytes:
+			ps = append(ps, "out IntPtr @out", "out UIntPtr out_len")
+		case valStruct:
+			ps = append(ps, "out "+cs.name[r.Struct]+" @out")
+		default:
+			ps = append(ps, csAttr(r.C)+"out "+csTypes[r.C]+" @out")
+		}
+	}
+	return ps
+}
+
+func csAttr(c string) string {
+	if c == "bool" {
+		return csBoolAttr
+	}
+	return ""
+}
+
+// managedType is the C# type of a wrapper param or result.
+func (cs *csNames) managedType(v cValue) string {
+	switch v.Kind {
+	case valEnum:
+		return cs.name[v.Enum]
+	case valHandle:
+		return cs.name[v.Handle]
+	case valString:
+		return "string"
+	case valBytes:
+		return "byte[]"
+	case valStruct:
+		return cs.name[v.Struct] + "Data"
+	case valCallback:
+		var ts []string
+		for _, p := range v.Callback.Params {
+			ts = append(ts, cs.managedType(p))
+		}
+		if v.Callback.Ret == "" {
+			if len(ts) == 0 {
+				return "Action"
+			}
+			return "Action<" + strings.Join(ts, ", ") + ">"
+		}
+		return "Func<" + strings.Join(append(ts, csTypes[v.Callback.Ret]), ", ") + ">"
+	}
+	return csTypes[v.C]
+}
+
+func writeCSharpFile(b *bytes.Buffer, m *cModel, cs *csNames, libName string) {
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n\n")
+	b.WriteString("#nullable disable\n\n")
+	b.WriteString("using System;\nusing System.Collections.Generic;\nusing System.Runtime.InteropServices;\nusing System.Text;\nusing System.Text.Json;\n\n")
+	fmt.Fprintf(b, "namespace %s\n{\n", pascalName(libName))
+
+	writeCSEnum(b, "Status", "Status codes returned by the exports.", m.Status)
+	for _, e := range m.Enums {
+		writeCSEnum(b, cs.name[e], e.Type+".", e)
+	}
+
+	b.WriteString("    /// <summary>Thrown when an export returns a non-OK status; carries the capi_last_error_json record.</summary>\n")
+	b.WriteString("    public sealed class ForgecException : Exception\n    {\n")
+	b.WriteString("        public ForgecException(int status, string json)\n")
+	b.WriteString("            : base(Describe(status, json))\n        {\n")
+	b.WriteString("            Status = (Status)status;\n")
+	b.WriteString("            Json = json;\n")
+	b.WriteString("            Function = Error = ErrorType = \"\";\n")
+	b.WriteString("            if (!string.IsNullOrEmpty(json))\n            {\n")
+	b.WriteString("                using (var doc = JsonDocument.Parse(json))\n                {\n")
+	b.WriteString("                    Record = doc.RootElement.Clone();\n                }\n")
+	b.WriteString("                Function = Field(Record, \"function\");\n")
+	b.WriteString("                Error = Field(Record, \"error\");\n")
+	b.WriteString("                ErrorType = Field(Record, \"type\");\n")
+	b.WriteString("            }\n        }\n\n")
+	b.WriteString("        /// <summary>The status returned by the export (may be a custom code).</summary>\n")
+	b.WriteString("        public Status Status { get; }\n\n")
+	b.WriteString("        /// <summary>The C name of the failed export, e.g., PM_Find.</summary>\n")
+	b.WriteString("        public string Function { get; }\n\n")
+	b.WriteString("        /// <summary>The Go error message.</summary>\n")
+	b.WriteString("        public string Error { get; }\n\n")
+	b.WriteString("        /// <summary>The Go type of the error or panic value.</summary>\n")
+	b.WriteString("        public string ErrorType { get; }\n\n")
+	b.WriteString("        /// <summary>The error record as returned by capi_last_error_json (see forgec.error.schema.json).</summary>\n")
+	b.WriteString("        public string Json { get; }\n\n")
+	b.WriteString("        /// <summary>The parsed error record; wrapped errors and panic stacks are read from here.</summary>\n")
+	b.WriteString("        public JsonElement Record { get; }\n\n")
+	b.WriteString("        private static string Field(JsonElement record, string name)\n        {\n")
+	b.WriteString("            return record.ValueKind == JsonValueKind.Object && record.TryGetProperty(name, out var v) && v.ValueKind == JsonValueKind.String ? v.GetString() : \"\";\n")
+	b.WriteString("        }\n\n")
+	b.WriteString("        private static string Describe(int status, string json)\n        {\n")
+	b.WriteString("            if (string.IsNullOrEmpty(json))\n            {\n")
+	b.WriteString("                return \"status \" + (Status)status;\n            }\n")
+	b.WriteString("            using (var doc = JsonDocument.Parse(json))\n            {\n")
+	b.WriteString("                return Field(doc.RootElement, \"function\") + \": \" + Field(doc.RootElement, \"error\") + \" (\" + (Status)status + \")\";\n")
+	b.WriteString("            }\n        }\n    }\n\n")
+
+	for _, s := range m.Structs {
+		name := cs.name[s]
+		fmt.Fprintf(b, "    /// <summary>Managed copy of %s.</summary>\n", s.Name)
+		fmt.Fprintf(b, "    public struct %sData\n    {\n", name)
+		for _, f := range s.Fields {
+			t := csTypes[f.C]
+			if f.String {
+				t = "string"
+			}
+			fmt.Fprintf(b, "        public %s %s;\n", t, csIdent(f.Name))
+		}
+		b.WriteString("    }\n\n")
+	}
+
+	for _, h := range m.Handles {
+		name := cs.name[h]
+		fmt.Fprintf(b, "    /// <summary>%s: an opaque reference to a Go object, released by Dispose.</summary>\n", h.Type)
+		fmt.Fprintf(b, "    public sealed class %s : IDisposable\n    {\n", name)
+		fmt.Fprintf(b, "        public %s(UIntPtr handle)\n        {\n            Handle = handle;\n        }\n\n", name)
+		b.WriteString("        public UIntPtr Handle { get; private set; }\n\n")
+		b.WriteString("        public void Dispose()\n        {\n")
+		b.WriteString("            var h = Handle;\n")
+		b.WriteString("            if (h == UIntPtr.Zero)\n            {\n                return;\n            }\n")
+		b.WriteString("            Handle = UIntPtr.Zero;\n")
+		fmt.Fprintf(b, "            Api.Check(Native.%s(h));\n", h.Release)
+		b.WriteString("        }\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writeCSFunc(b, cs, f, "        ")
+		}
+		b.WriteString("    }\n\n")
+	}
+
+	b.WriteString("    /// <summary>The exports, throwing ForgecException on a non-OK status and returning their out-param.</summary>\n")
+	b.WriteString("    public static class Api\n    {\n")
+	b.WriteString("        /// <summary>Returns the last error recorded on the calling thread as JSON ({} if none).</summary>\n")
+	b.WriteString("        public static string LastErrorJson()\n        {\n")
+	b.WriteString("            var p = Native.capi_last_error_json();\n")
+	b.WriteString("            return p == IntPtr.Zero ? null : TakeString(p);\n        }\n\n")
+	b.WriteString("        public static void ClearLastError()\n        {\n            Native.capi_clear_last_error();\n        }\n\n")
+	b.WriteString("        /// <summary>Configures a registered reporter, e.g., \"jsonl\" or \"sentry\".</summary>\n")
+	b.WriteString("        public static void ReporterConfigure(string name, string configJson)\n        {\n")
+	b.WriteString("            Check(Native.capi_reporter_configure(Utf8Z(name), Utf8Z(configJson)));\n        }\n\n")
+	b.WriteString("        /// <summary>Waits up to timeoutMs for reporters to deliver queued reports.</summary>\n")
+	b.WriteString("        public static bool Flush(uint timeoutMs = 2000)\n        {\n")
+	b.WriteString("            return Native.capi_flush(timeoutMs);\n        }\n")
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			b.WriteString("\n")
+			writeCSFunc(b, cs, f, "        ")
+		}
+	}
+	b.WriteString("\n        internal static void Check(int status)\n        {\n")
+	b.WriteString("            if (status != 0)\n            {\n")
+	b.WriteString("                throw new ForgecException(status, LastErrorJson());\n            }\n        }\n\n")
+	b.WriteString("        // Utf8Z encodes a string as NUL-terminated UTF-8; null stays null (read as \"\" by Go).\n")
+	b.WriteString("        internal static byte[] Utf8Z(string s)\n        {\n")
+	b.WriteString("            return s == null ? null : Encoding.UTF8.GetBytes(s + \"\\0\");\n        }\n\n")
+	b.WriteString("        internal static string Utf8(IntPtr p)\n        {\n")
+	b.WriteString("            if (p == IntPtr.Zero)\n            {\n                return null;\n            }\n")
+	b.WriteString("            var n = 0;\n")
+	b.WriteString("            while (Marshal.ReadByte(p, n) != 0)\n            {\n                n++;\n            }\n")
+	b.WriteString("            var buf = new byte[n];\n")
+	b.WriteString("            Marshal.Copy(p, buf, 0, n);\n")
+	b.WriteString("            return Encoding.UTF8.GetString(buf);\n        }\n\n")
+	b.WriteString("        internal static byte[] Bytes(IntPtr p, UIntPtr n)\n        {\n")
+	b.WriteString("            var buf = new byte[(int)n.ToUInt64()];\n")
+	b.WriteString("            if (buf.Length > 0)\n            {\n                Marshal.Copy(p, buf, 0, buf.Length);\n            }\n")
+	b.WriteString("            return buf;\n        }\n\n")
+	b.WriteString("        internal static string TakeString(IntPtr p)\n        {\n")
+	b.WriteString("            try\n            {\n                return Utf8(p) ?? \"\";\n            }\n")
+	b.WriteString("            finally\n            {\n                Native.capi_free(p);\n            }\n        }\n\n")
+	b.WriteString("        internal static byte[] TakeBytes(IntPtr p, UIntPtr n)\n        {\n")
+	b.WriteString("            try\n            {\n                return Bytes(p, n);\n            }\n")
+	b.WriteString("            finally\n            {\n                Native.capi_free(p);\n            }\n        }\n\n")
+	b.WriteString("        internal static IntPtr AllocUtf8(string s, List<IntPtr> allocs)\n        {\n")
+	b.WriteString("            if (s == null)\n            {\n                return IntPtr.Zero;\n            }\n")
+	b.WriteString("            var buf = Utf8Z(s);\n")
+	b.WriteString("            var p = Marshal.AllocHGlobal(buf.Length);\n")
+	b.WriteString("            allocs.Add(p);\n")
+	b.WriteString("            Marshal.Copy(buf, 0, p, buf.Length);\n")
+	b.WriteString("            return p;\n        }\n\n")
+	b.WriteString("        internal static void FreeAll(List<IntPtr> allocs)\n        {\n")
+	b.WriteString("            foreach (var p in allocs)\n            {\n                Marshal.FreeHGlobal(p);\n            }\n        }\n")
+	for _, s := range m.Structs {
+		name := cs.name[s]
+		fmt.Fprintf(b, "\n        internal static Native.%s ToNative(%sData v, List<IntPtr> allocs)\n        {\n", name, name)
+		fmt.Fprintf(b, "            return new Native.%s\n            {\n", name)
+		for _, f := range s.Fields {
+			n := csIdent(f.Name)
+			switch {
+			case f.String:
+				fmt.Fprintf(b, "                %s = AllocUtf8(v.%s, allocs),\n", n, n)
+			case f.C == "bool":
+				fmt.Fprintf(b, "                %s = v.%s ? (byte)1 : (byte)0,\n", n, n)
+			default:
+				fmt.Fprintf(b, "                %s = v.%s,\n", n, n)
+			}
+		}
+		b.WriteString("            };\n        }\n")
+		fmt.Fprintf(b, "\n        internal static %sData Take(Native.%s v)\n        {\n", name, name)
+		fmt.Fprintf(b, "            var d = new %sData\n            {\n", name)
+		for _, f := range s.Fields {
+			n := csIdent(f.Name)
+			switch {
+			case f.String:
+				fmt.Fprintf(b, "                %s = Utf8(v.%s),\n", n, n)
+			case f.C == "bool":
+				fmt.Fprintf(b, "                %s = v.%s != 0,\n", n, n)
+			default:
+				fmt.Fprintf(b, "                %s = v.%s,\n", n, n)
+			}
+		}
+		b.WriteString("            };\n")
+		fmt.Fprintf(b, "            Native.%s(ref v);\n", s.Free)
+		b.WriteString("            return d;\n        }\n")
+	}
+	b.WriteString("    }\n\n")
+
+	b.WriteString("    /// <summary>The C API of forgec.h as [DllImport] declarations and blittable struct mirrors.</summary>\n")
+	b.WriteString("    public static class Native\n    {\n")
+	fmt.Fprintf(b, "        public const string Library = %s;\n", strconv.Quote(libName))
+	for _, s := range m.Structs {
+		fmt.Fprintf(b, "\n        [StructLayout(LayoutKind.Sequential)]\n        public struct %s\n        {\n", cs.name[s])
+		for _, f := range s.Fields {
+			t := csTypes[f.C]
+			switch {
+			case f.String:
+				t = "IntPtr"
+			case f.C == "bool":
+				t = "byte"
+			}
+			fmt.Fprintf(b, "            public %s %s;\n", t, csIdent(f.Name))
+		}
+		b.WriteString("        }\n")
+	}
+	for _, cb := range m.Callbacks {
+		var ps []string
+		for _, p := range cb.Params {
+			n := csIdent(p.Name)
+			switch p.Kind {
+			case valString:
+				ps = append(ps, "IntPtr "+n)
+			case valBytes:
+				ps = append(ps, "IntPtr "+n, "UIntPtr "+csIdent(p.Name+"_len"))
+			default:
+				ps = append(ps, csAttr(p.C)+csTypes[p.C]+" "+n)
+			}
+		}
+		ps = append(ps, "IntPtr user_data")
+		ret := "void"
+		if cb.Ret != "" {
+			ret = csTypes[cb.Ret]
+		}
+		b.WriteString("\n        [UnmanagedFunctionPointer(CallingConvention.Cdecl)]\n")
+		if cb.Ret == "bool" {
+			b.WriteString("        [return: MarshalAs(UnmanagedType.U1)]\n")
+		}
+		fmt.Fprintf(b, "        public delegate %s %s(%s);\n", ret, cb.Type, strings.Join(ps, ", "))
+	}
+	writeCSImport(b, "IntPtr", "capi_last_error_json", nil, "")
+	writeCSImport(b, "void", "capi_clear_last_error", nil, "")
+	writeCSImport(b, "void", "capi_free", []string{"IntPtr p"}, "")
+	writeCSImport(b, "int", "capi_reporter_configure", []string{"byte[] name", "byte[] config"}, "")
+	writeCSImport(b, "bool", "capi_flush", []string{"uint timeout_ms"}, "")
+	for _, s := range m.Structs {
+		writeCSImport(b, "void", s.Free, []string{"ref " + cs.name[s] + " v"}, "")
+	}
+	for _, h := range m.Handles {
+		writeCSImport(b, "int", h.Release, []string{"UIntPtr h"}, "")
+	}
+	for _, f := range m.Funcs {
+		writeCSImport(b, "int", f.Symbol, cs.nativeParams(f), f.Deprecated)
+	}
+	b.WriteString("    }\n}\n")
+}
+
+func writeCSEnum(b *bytes.Buffer, name, doc string, e *cEnum) {
+	fmt.Fprintf(b, "    /// <summary>%s</summary>\n", doc)
+	fmt.Fprintf(b, "    public enum %s : int\n    {\n", name)
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "        %s = %d,\n", csIdent(pascalName(v.Name)), v.Value)
+	}
+	b.WriteString("    }\n\n")
+}
+
+func writeCSImport(b *bytes.Buffer, ret, symbol string, params []string, deprecated string) {
+	b.WriteString("\n")
+	if deprecated != "" {
+		fmt.Fprintf(b, "        [Obsolete(%s)]\n", strconv.Quote(deprecated))
+	}
+	if ret == "bool" {
+		b.WriteString("        [return: MarshalAs(UnmanagedType.U1)]\n")
+	}
+	fmt.Fprintf(b, "        [DllImport(Library, EntryPoint = %q, CallingConvention = CallingConvention.Cdecl)]\n", symbol)
+	fmt.Fprintf(b, "        public static extern %s %s(%s);\n", ret, symbol, strings.Join(params, ", "))
+}
+
+// writeCSFunc writes the wrapper of an export: a static method of Api or a method of its handle class.
+func writeCSFunc(b *bytes.Buffer, cs *csNames, f *cFunc, indent string) {
+	in := indent + "    "
+	ret := "void"
+	if f.Result != nil {
+		ret = cs.managedType(*f.Result)
+	}
+	var ps, args, pre, keep []string
+	var allocs bool
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "Handle")
+			continue
+		}
+		n := csIdent(camelName(p.Name))
+		ps = append(ps, cs.managedType(p)+" "+n)
+		switch p.Kind {
+		case valHandle:
+			args = append(args, n+" == null ? UIntPtr.Zero : "+n+".Handle")
+		case valString:
+			args = append(args, "Api.Utf8Z("+n+")")
+		case valBytes:
+			args = append(args, n, "new UIntPtr((uint)("+n+" == null ? 0 : "+n+".Length))")
+		case valStruct:
+			allocs = true
+			pre = append(pre, fmt.Sprintf("var _%s = Api.ToNative(%s, _allocs);", p.Name, n))
+			args = append(args, "ref _"+p.Name)
+		case valCallback:
+			keep = append(keep, fmt.Sprintf("Native.%s _%s = %s == null ? null : %s;", p.C, p.Name, n, csCallbackAdapter(p.Callback, n)))
+			args = append(args, "_"+p.Name, "IntPtr.Zero")
+		default:
+			args = append(args, n)
+		}
+	}
+	if r := f.Result; r != nil {
+		args = append(args, "out var _out")
+		if r.Kind == valBytes {
+			args = append(args, "out var _outLen")
+		}
+	}
+	fmt.Fprintf(b, "%s/// <summary><c>%s</c></summary>\n", indent, escapeXML(strings.TrimSuffix(f.cPrototype(), ";")))
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%s[Obsolete(%s)]\n", indent, strconv.Quote(f.Deprecated))
+	}
+	static := "static "
+	if f.Recv != nil {
+		static = ""
+	}
+	fmt.Fprintf(b, "%spublic %s%s %s(%s)\n%s{\n", indent, static, ret, cs.funcName(f), strings.Join(ps, ", "), indent)
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%s#pragma warning disable CS0618\n", in)
+	}
+	// the delegates must outlive the call, which invokes them synchronously
+	for _, k := range keep {
+		fmt.Fprintf(b, "%s%s\n", in, k)
+	}
+	body := in
+	if allocs || len(keep) > 0 {
+		if allocs {
+			fmt.Fprintf(b, "%svar _allocs = new List<IntPtr>();\n", in)
+		}
+		fmt.Fprintf(b, "%stry\n%s{\n", in, in)
+		body = in + "    "
+	}
+	for _, s := range pre {
+		fmt.Fprintf(b, "%s%s\n", body, s)
+	}
+	fmt.Fprintf(b, "%sApi.Check(Native.%s(%s));\n", body, f.Symbol, strings.Join(args, ", "))
+	if r := f.Result; r != nil {
+		switch r.Kind {
+		case valHandle:
+			fmt.Fprintf(b, "%sreturn _out == UIntPtr.Zero ? null : new %s(_out);\n", body, cs.name[r.Handle])
+		case valString:
+			fmt.Fprintf(b, "%sreturn Api.TakeString(_out);\n", body)
+		case valBytes:
+			fmt.Fprintf(b, "%sreturn Api.TakeBytes(_out, _outLen);\n", body)
+		case valStruct:
+			fmt.Fprintf(b, "%sreturn Api.Take(_out);\n", body)
+		default:
+			fmt.Fprintf(b, "%sreturn _out;\n", body)
+		}
+	}
+	if allocs || len(keep) > 0 {
+		fmt.Fprintf(b, "%s}\n%sfinally\n%s{\n", in, in, in)
+		if allocs {
+			fmt.Fprintf(b, "%s    Api.FreeAll(_allocs);\n", in)
+		}
+		for _, k := range keep {
+			fmt.Fprintf(b, "%s    GC.KeepAlive(%s);\n", in, strings.Fields(k)[1])
+		}
+		fmt.Fprintf(b, "%s}\n", in)
+	}
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%s#pragma warning restore CS0618\n", in)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// csCallbackAdapter renders a lambda adapting a managed delegate to a native callback.
+func csCallbackAdapter(cb *cCallback, fn string) string {
+	var ps, args []string
+	for _, p := range cb.Params {
+		n := "_" + p.Name
+		switch p.Kind {
+		case valString:
+			ps = append(ps, n)
+			args = append(args, "Api.Utf8("+n+")")
+		case valBytes:
+			ps = append(ps, n, n+"Len")
+			args = append(args, "Api.Bytes("+n+", "+n+"Len)")
+		default:
+			ps = append(ps, n)
+			args = append(args, n)
+		}
+	}
+	ps = append(ps, "_")
+	return fmt.Sprintf("(%s) => %s(%s)", strings.Join(ps, ", "), fn, strings.Join(args, ", "))
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escapeXML(s string) string {
+	return xmlEscaper.Replace(s)
+}
@@ -0,0 +1,49 @@
+package writer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// csproj builds the bindings into a library; it needs no packages, so restoring works offline.
+const csproj = `<Project Sdk="Microsoft.NET.Sdk">
+  <PropertyGroup>
+    <TargetFramework>net8.0</TargetFramework>
+    <AllowUnsafeBlocks>true</AllowUnsafeBlocks>
+    <TreatWarningsAsErrors>true</TreatWarningsAsErrors>
+  </PropertyGroup>
+</Project>
+`
+
+func TestWriteCSharpBuilds(t *testing.T) {
+	dotnet, err := exec.LookPath("dotnet")
+	if err != nil {
+		t.Skip("no dotnet")
+	}
+	tests := []struct {
+		name string
+		apis func(*testing.T) []*scanner.API
+	}{
+		{"sample", scanSample},
+		{"members", func(*testing.T) []*scanner.API { return memberAPI() }},
+		{"helpers", func(*testing.T) []*scanner.API { return helperAPI() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := generate(t, "csharp", tt.apis(t))
+			if err := os.WriteFile(filepath.Join(dir, "Sample.csproj"), []byte(csproj), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command(dotnet, "build", "-nologo", "-v", "quiet", dir)
+			cmd.Env = append(os.Environ(), "DOTNET_CLI_TELEMETRY_OPTOUT=1", "DOTNET_NOLOGO=1", "DOTNET_SKIP_FIRST_TIME_EXPERIENCE=1")
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,717 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WriteDart writes Dart bindings of the scanned packages to path: a library declaring every
+// export through dart:ffi (NativeFunction typedefs, DynamicLibrary lookups and Struct
+// subclasses) and wrapping it as a function that returns the out-param and throws
+// ForgecException on a non-OK status. libName is the base name of the shared library built by
+// the build scripts.
+func WriteDart(path, libName, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	d := newDartNames(m)
+	if err := d.check(); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	writeDartLibrary(&b, m, d, libName)
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// dartNames spells the model in Dart: PascalCase classes, camelCase functions, methods, fields
+// and constants; the native declarations keep the C names.
+type dartNames struct {
+	m    *cModel
+	name map[any]string // *cEnum, *cHandle, *cStruct, *cCallback -> class or typedef name
+}
+
+func newDartNames(m *cModel) *dartNames {
+	d := &dartNames{m: m, name: map[any]string{m.Status: "Status"}}
+	for _, e := range m.Enums {
+		d.name[e] = pascalName(e.Name)
+	}
+	for _, h := range m.Handles {
+		d.name[h] = pascalName(h.Name)
+	}
+	for _, s := range m.Structs {
+		d.name[s] = pascalName(s.Name)
+	}
+	for _, cb := range m.Callbacks {
+		d.name[cb] = pascalName(strings.TrimPrefix(cb.Type, m.Prefix))
+	}
+	return d
+}
+
+// check reports top-level Dart names declared twice, including the C names of the native
+// declarations and their typedefs, and members hiding the handle class members.
+func (d *dartNames) check() error {
+	names := newNameSet("dart", false)
+	names.reserve("", "forgec", "ForgecException")
+	names.reserve("", "forgec", dartHelpers...)
+	for _, n := range []string{"capi_free", "capi_last_error_json", "capi_clear_last_error", "capi_reporter_configure", "capi_flush"} {
+		names.reserve("", "forgec", n, n+"_c", n+"_dart")
+	}
+	native := func(sym string) error {
+		for _, n := range []string{sym, sym + "_c", sym + "_dart"} {
+			if err := names.declare("", n, sym); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for k, name := range d.name {
+		switch v := k.(type) {
+		case *cEnum:
+			if err := names.declare("", name, v.Type); err != nil {
+				return err
+			}
+			for _, ev := range v.Values {
+				if err := names.declare(name+".", dartIdent(camelName(ev.Name)), ev.C); err != nil {
+					return err
+				}
+			}
+			if err := names.declare(name+".", "name", v.Type); err != nil {
+				return err
+			}
+		case *cHandle:
+			if err := names.declare("", name, v.Type); err != nil {
+				return err
+			}
+			if err := native(v.Release); err != nil {
+				return err
+			}
+			names.reserve(name+".", v.Type, dartHandleMembers...)
+		case *cStruct:
+			if err := names.declare("", name, v.Name); err != nil {
+				return err
+			}
+			if err := names.declare("", name+"Struct", v.Name); err != nil {
+				return err
+			}
+			if err := native(v.Free); err != nil {
+				return err
+			}
+		case *cCallback:
+			if err := names.declare("", name, v.Type); err != nil {
+				return err
+			}
+			if err := names.declare("", v.Type, v.Type); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range d.m.Funcs {
+		if err := native(f.Symbol); err != nil {
+			return err
+		}
+		scope := ""
+		if f.Recv != nil {
+			scope = d.name[f.Recv] + "."
+		}
+		if err := names.declare(scope, d.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dartHelpers are the public functions and variables of the generated library; functions of the
+// same name are escaped.
+var dartHelpers = []string{"dylib", "lastErrorJson", "clearLastError", "reporterConfigure", "flush"}
+
+// dartHandleMembers are declared by every handle class; methods of the same name are escaped.
+var dartHandleMembers = []string{"handle", "release"}
+
+func (d *dartNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(dartIdent(camelName(f.Method)), dartHandleMembers)
+	}
+	return memberName(dartIdent(camelName(f.Name)), dartHelpers)
+}
+
+// dartKeywords are the reserved words of Dart, which cannot name a variable or member.
+var dartKeywords = map[string]bool{
+	"assert": true, "break": true, "case": true, "catch": true, "class": true, "const": true,
+	"continue": true, "default": true, "do": true, "else": true, "enum": true, "extends": true,
+	"false": true, "final": true, "finally": true, "for": true, "if": true, "in": true, "is": true,
+	"new": true, "null": true, "rethrow": true, "return": true, "super": true, "switch": true,
+	"this": true, "throw": true, "true": true, "try": true, "var": true, "void": true, "while": true,
+	"with": true,
+}
+
+// dartIdent escapes Dart reserved words with a trailing underscore.
+func dartIdent(name string) string {
+	if dartKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// dartNatives maps C scalar types to their dart:ffi native types.
+var dartNatives = map[string]string{
+	"int8_t":    "Int8",
+	"int16_t":   "Int16",
+	"int32_t":   "Int32",
+	"int64_t":   "Int64",
+	"uint8_t":   "Uint8",
+	"uint16_t":  "Uint16",
+	"uint32_t":  "Uint32",
+	"uint64_t":  "Uint64",
+	"uintptr_t": "UintPtr",
+	"float":     "Float",
+	"double":    "Double",
+	"bool":      "Bool",
+}
+
+// dartScalar is the Dart type of a C scalar.
+func dartScalar(c string) string {
+	switch c {
+	case "float", "double":
+		return "double"
+	case "bool":
+		return "bool"
+	}
+	return "int"
+}
+
+// dartZero is the zero value of a Dart scalar type, used as a default and as the value
+// returned to C when a callback throws.
+func dartZero(t string) string {
+	switch t {
+	case "double":
+		return "0.0"
+	case "bool":
+		return "false"
+	case "String":
+		return "''"
+	}
+	return "0"
+}
+
+// dartType is the type of a value in the Dart API.
+func (d *dartNames) dartType(v cValue) string {
+	switch v.Kind {
+	case valEnum:
+		return "int"
+	case valHandle:
+		return d.name[v.Handle]
+	case valStruct:
+		return d.name[v.Struct]
+	case valCallback:
+		return d.name[v.Callback]
+	case valString:
+		return "String"
+	case valBytes:
+		return "Uint8List"
+	}
+	return dartScalar(v.C)
+}
+
+// dartParam is a native parameter: its dart:ffi type, its Dart type and its name.
+type dartParam struct{ Native, Dart, Name string }
+
+// dartNativeParams lists the native parameters of an export, including the out-params.
+func (d *dartNames) dartNativeParams(f *cFunc) []dartParam {
+	var ps []dartParam
+	for _, p := range f.Params {
+		n := dartIdent(p.Name)
+		switch p.Kind {
+		case valEnum:
+			ps = append(ps, dartParam{"Int32", "int", n})
+		case valHandle:
+			ps = append(ps, dartParam{"UintPtr", "int", n})
+		case valString:
+			ps = append(ps, dartParam{"Pointer<Utf8>", "Pointer<Utf8>", n})
+		case valBytes:
+			ps = append(ps, dartParam{"Pointer<Uint8>", "Pointer<Uint8>", n}, dartParam{"Size", "int", n + "_len"})
+		case valStruct:
+			t := "Pointer<" + d.name[p.Struct] + "Struct>"
+			ps = append(ps, dartParam{t, t, n})
+		case valCallback:
+			t := "Pointer<NativeFunction<" + p.C + ">>"
+			ps = append(ps, dartParam{t, t, n}, dartParam{"Pointer<Void>", "Pointer<Void>", n + "_user_data"})
+		default:
+			ps = append(ps, dartParam{dartNatives[p.C], dartScalar(p.C), n})
+		}
+	}
+	if r := f.Result; r != nil {
+		var t string
+		switch r.Kind {
+		case valEnum:
+			t = "Pointer<Int32>"
+		case valHandle:
+			t = "Pointer<UintPtr>"
+		case valString:
+			t = "Pointer<Pointer<Utf8>>"
+		case valBytes:
+			t = "Pointer<Pointer<Uint8>>"
+		case valStruct:
+			t = "Pointer<" + d.name[r.Struct] + "Struct>"
+		default:
+			t = "Pointer<" + dartNatives[r.C] + ">"
+		}
+		ps = append(ps, dartParam{t, t, "out"})
+		if r.Kind == valBytes {
+			ps = append(ps, dartParam{"Pointer<Size>", "Pointer<Size>", "out_len"})
+		}
+	}
+	return ps
+}
+
+// writeDartNative declares a C function: its NativeFunction typedef, the Dart function type
+// and the function looked up in the library.
+func writeDartNative(b *bytes.Buffer, sym, ret, dartRet string, ps []dartParam) {
+	var ns, ds []string
+	for _, p := range ps {
+		ns = append(ns, p.Native+" "+p.Name)
+		ds = append(ds, p.Dart+" "+p.Name)
+	}
+	fmt.Fprintf(b, "typedef %s_c = %s Function(%s);\n", sym, ret, strings.Join(ns, ", "))
+	fmt.Fprintf(b, "typedef %s_dart = %s Function(%s);\n", sym, dartRet, strings.Join(ds, ", "))
+	fmt.Fprintf(b, "final %s_dart %s = dylib.lookup<NativeFunction<%s_c>>('%s').asFunction();\n\n", sym, sym, sym, sym)
+}
+
+func writeDartLibrary(b *bytes.Buffer, m *cModel, d *dartNames, libName string) {
+	envVar := pyEnvName(libName) + "_LIBRARY"
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "/// Dart bindings of the %s library, through dart:ffi (Dart 3.2+) and package:ffi.\n", libName)
+	b.WriteString("///\n")
+	b.WriteString("/// The C declarations keep their names from forgec.h; the functions wrapping them return\n")
+	b.WriteString("/// the out-param and throw [ForgecException] on a non-OK status.\n")
+	b.WriteString("// ignore_for_file: camel_case_types, non_constant_identifier_names, unused_element\n")
+	b.WriteString("library;\n\n")
+	b.WriteString("import 'dart:convert';\n")
+	b.WriteString("import 'dart:ffi';\n")
+	b.WriteString("import 'dart:io';\n")
+	b.WriteString("import 'dart:typed_data';\n\n")
+	b.WriteString("import 'package:ffi/ffi.dart';\n\n")
+
+	b.WriteString("DynamicLibrary _open() {\n")
+	fmt.Fprintf(b, "  final path = Platform.environment['%s'];\n", envVar)
+	b.WriteString("  if (path != null && path.isNotEmpty) {\n")
+	b.WriteString("    return DynamicLibrary.open(path);\n")
+	b.WriteString("  }\n")
+	b.WriteString("  if (Platform.isWindows) {\n")
+	fmt.Fprintf(b, "    return DynamicLibrary.open('%s.dll');\n", libName)
+	b.WriteString("  }\n")
+	b.WriteString("  if (Platform.isMacOS || Platform.isIOS) {\n")
+	fmt.Fprintf(b, "    return DynamicLibrary.open('lib%s.dylib');\n", libName)
+	b.WriteString("  }\n")
+	fmt.Fprintf(b, "  return DynamicLibrary.open('lib%s.so');\n", libName)
+	b.WriteString("}\n\n")
+	fmt.Fprintf(b, "/// The library: `$%s`, or lib%s.so, lib%s.dylib or %s.dll from the\n", envVar, libName, libName, libName)
+	b.WriteString("/// system search path (or the app bundle).\n")
+	b.WriteString("final DynamicLibrary dylib = _open();\n\n")
+
+	writeDartConstants(b, "Status", "Status codes returned by the exports; custom codes start at 100.", m.Status)
+	for _, e := range m.Enums {
+		writeDartConstants(b, d.name[e], "`"+e.Type+"` values.", e)
+	}
+
+	b.WriteString(`/// Thrown when an export returns a non-OK status. [record] is the decoded
+/// ` + "`capi_last_error_json`" + ` record (see forgec.error.schema.json).
+class ForgecException implements Exception {
+  ForgecException(this.status, this.json) : record = _decode(json);
+
+  /// The status returned by the export, one of [Status] or a custom code.
+  final int status;
+
+  /// The error record as JSON.
+  final String json;
+
+  /// The decoded error record, including wrapped errors and panic stacks.
+  final Map<String, Object?> record;
+
+  /// The C name of the failed export, e.g., PM_Find.
+  String get function => _field('function');
+
+  /// The Go error message.
+  String get error => _field('error');
+
+  /// The Go type of the error or panic value.
+  String get errorType => _field('type');
+
+  String _field(String key) {
+    final v = record[key];
+    return v is String ? v : '';
+  }
+
+  @override
+  String toString() => 'ForgecException: $function: $error (${Status.name(status)})';
+
+  static Map<String, Object?> _decode(String json) {
+    try {
+      final v = jsonDecode(json);
+      return v is Map<String, Object?> ? v : {};
+    } on FormatException {
+      return {};
+    }
+  }
+}
+
+`)
+
+	for _, s := range m.Structs {
+		name := d.name[s]
+		fmt.Fprintf(b, "/// The C layout of `%s`.\n", s.Name)
+		fmt.Fprintf(b, "final class %sStruct extends Struct {\n", name)
+		for i, f := range s.Fields {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			if f.String {
+				fmt.Fprintf(b, "  external Pointer<Utf8> %s;\n", dartIdent(f.Name))
+				continue
+			}
+			fmt.Fprintf(b, "  @%s()\n  external %s %s;\n", dartNatives[f.C], dartScalar(f.C), dartIdent(f.Name))
+		}
+		b.WriteString("}\n\n")
+
+		fmt.Fprintf(b, "/// A copy of the C struct `%s`.\n", s.Name)
+		fmt.Fprintf(b, "class %s {\n", name)
+		var ps, fs []string
+		for _, f := range s.Fields {
+			t := dartScalar(f.C)
+			if f.String {
+				t = "String"
+			}
+			n := dartIdent(camelName(f.Name))
+			ps = append(ps, fmt.Sprintf("this.%s = %s", n, dartZero(t)))
+			fs = append(fs, fmt.Sprintf("%s: $%s", n, n))
+		}
+		fmt.Fprintf(b, "  %s({%s});\n\n", name, strings.Join(ps, ", "))
+		for _, f := range s.Fields {
+			t := dartScalar(f.C)
+			if f.String {
+				t = "String"
+			}
+			fmt.Fprintf(b, "  %s %s;\n", t, dartIdent(camelName(f.Name)))
+		}
+		b.WriteString("\n  @override\n")
+		fmt.Fprintf(b, "  String toString() => '%s(%s)';\n", name, strings.Join(fs, ", "))
+		b.WriteString("}\n\n")
+	}
+
+	for _, cb := range m.Callbacks {
+		var ns, ds []string
+		for _, p := range cb.Params {
+			n := dartIdent(p.Name)
+			switch p.Kind {
+			case valString:
+				ns = append(ns, "Pointer<Utf8> "+n)
+				ds = append(ds, "String "+n)
+			case valBytes:
+				ns = append(ns, "Pointer<Uint8> "+n, "Size "+n+"_len")
+				ds = append(ds, "Uint8List "+n)
+			default:
+				ns = append(ns, dartNatives[p.C]+" "+n)
+				ds = append(ds, dartScalar(p.C)+" "+n)
+			}
+		}
+		ns = append(ns, "Pointer<Void> user_data")
+		ret, dret := "Void", "void"
+		if cb.Ret != "" {
+			ret, dret = dartNatives[cb.Ret], dartScalar(cb.Ret)
+		}
+		fmt.Fprintf(b, "typedef %s = %s Function(%s);\n\n", cb.Type, ret, strings.Join(ns, ", "))
+		fmt.Fprintf(b, "/// The Dart side of `%s`, called while the export runs.\n", cb.Type)
+		fmt.Fprintf(b, "typedef %s = %s Function(%s);\n\n", d.name[cb], dret, strings.Join(ds, ", "))
+	}
+
+	writeDartNative(b, "capi_free", "Void", "void", []dartParam{{"Pointer<Void>", "Pointer<Void>", "p"}})
+	writeDartNative(b, "capi_last_error_json", "Pointer<Utf8>", "Pointer<Utf8>", nil)
+	writeDartNative(b, "capi_clear_last_error", "Void", "void", nil)
+	writeDartNative(b, "capi_reporter_configure", "Int32", "int", []dartParam{{"Pointer<Utf8>", "Pointer<Utf8>", "name"}, {"Pointer<Utf8>", "Pointer<Utf8>", "config"}})
+	writeDartNative(b, "capi_flush", "Bool", "bool", []dartParam{{"Uint32", "int", "timeout_ms"}})
+	for _, s := range m.Structs {
+		t := "Pointer<" + d.name[s] + "Struct>"
+		writeDartNative(b, s.Free, "Void", "void", []dartParam{{t, t, "v"}})
+	}
+	for _, h := range m.Handles {
+		writeDartNative(b, h.Release, "Int32", "int", []dartParam{{"UintPtr", "int", "h"}})
+	}
+	for _, f := range m.Funcs {
+		writeDartNative(b, f.Symbol, "Int32", "int", d.dartNativeParams(f))
+	}
+
+	b.WriteString(`/// Returns the last error recorded on the calling thread as JSON ({} if none).
+String lastErrorJson() {
+  final p = capi_last_error_json();
+  return p == nullptr ? '{}' : _takeString(p);
+}
+
+void clearLastError() => capi_clear_last_error();
+
+/// Configures a registered reporter, e.g., "jsonl" or "sentry".
+void reporterConfigure(String name, String configJson) {
+  final arena = Arena();
+  try {
+    _check(capi_reporter_configure(name.toNativeUtf8(allocator: arena), configJson.toNativeUtf8(allocator: arena)));
+  } finally {
+    arena.releaseAll();
+  }
+}
+
+/// Waits up to [timeoutMs] for reporters to deliver queued reports.
+bool flush(int timeoutMs) => capi_flush(timeoutMs);
+
+`)
+
+	for _, h := range m.Handles {
+		name := d.name[h]
+		fmt.Fprintf(b, "/// `%s`: an opaque reference to a Go object, released by [release].\n", h.Type)
+		fmt.Fprintf(b, "class %s {\n", name)
+		fmt.Fprintf(b, "  %s(this.handle);\n\n", name)
+		b.WriteString("  /// The raw handle; 0 once released.\n")
+		b.WriteString("  int handle;\n\n")
+		b.WriteString("  void release() {\n")
+		b.WriteString("    if (handle == 0) {\n      return;\n    }\n")
+		b.WriteString("    final h = handle;\n")
+		b.WriteString("    handle = 0;\n")
+		fmt.Fprintf(b, "    _check(%s(h));\n", h.Release)
+		b.WriteString("  }\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writeDartFunc(b, d, f, "  ")
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			writeDartFunc(b, d, f, "")
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString(`void _check(int status) {
+  if (status != 0) {
+    throw ForgecException(status, lastErrorJson());
+  }
+}
+
+Pointer<Uint8> _buffer(Uint8List b, Allocator a) {
+  if (b.isEmpty) {
+    return nullptr;
+  }
+  final p = a<Uint8>(b.length);
+  p.asTypedList(b.length).setAll(0, b);
+  return p;
+}
+
+String _string(Pointer<Utf8> p) => p == nullptr ? '' : p.toDartString();
+
+Uint8List _bytes(Pointer<Uint8> p, int n) => p == nullptr || n == 0 ? Uint8List(0) : Uint8List.fromList(p.asTypedList(n));
+
+String _takeString(Pointer<Utf8> p) {
+  try {
+    return _string(p);
+  } finally {
+    if (p != nullptr) {
+      capi_free(p.cast());
+    }
+  }
+}
+
+Uint8List _takeBytes(Pointer<Uint8> p, int n) {
+  try {
+    return _bytes(p, n);
+  } finally {
+    if (p != nullptr) {
+      capi_free(p.cast());
+    }
+  }
+}
+`)
+	for _, s := range m.Structs {
+		name := d.name[s]
+		fmt.Fprintf(b, "\nPointer<%sStruct> _to%sStruct(%s v, Allocator a) {\n", name, name, name)
+		fmt.Fprintf(b, "  final p = a<%sStruct>();\n", name)
+		for _, f := range s.Fields {
+			n := dartIdent(camelName(f.Name))
+			if f.String {
+				fmt.Fprintf(b, "  p.ref.%s = v.%s.toNativeUtf8(allocator: a);\n", dartIdent(f.Name), n)
+			} else {
+				fmt.Fprintf(b, "  p.ref.%s = v.%s;\n", dartIdent(f.Name), n)
+			}
+		}
+		b.WriteString("  return p;\n}\n")
+		b.WriteString("\n// _take copies a struct returned by the library and releases its strings.\n")
+		fmt.Fprintf(b, "%s _take%s(Pointer<%sStruct> p) {\n", name, name, name)
+		b.WriteString("  final s = p.ref;\n")
+		var fs []string
+		for _, f := range s.Fields {
+			v := "s." + dartIdent(f.Name)
+			if f.String {
+				v = "_string(" + v + ")"
+			}
+			fs = append(fs, dartIdent(camelName(f.Name))+": "+v)
+		}
+		fmt.Fprintf(b, "  final v = %s(%s);\n", name, strings.Join(fs, ", "))
+		fmt.Fprintf(b, "  %s(p);\n", s.Free)
+		b.WriteString("  return v;\n}\n")
+	}
+}
+
+// writeDartConstants writes a C enum as int constants, so values unknown to the bindings
+// (e.g., combined flags or new status codes) stay representable.
+func writeDartConstants(b *bytes.Buffer, name, doc string, e *cEnum) {
+	fmt.Fprintf(b, "/// %s\n", doc)
+	fmt.Fprintf(b, "abstract final class %s {\n", name)
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "  static const int %s = %d;\n", dartIdent(camelName(v.Name)), v.Value)
+	}
+	b.WriteString("\n  /// Returns the name of a value, or the number if it is unknown.\n")
+	b.WriteString("  static String name(int value) => switch (value) {\n")
+	seen := map[int64]bool{}
+	for _, v := range e.Values {
+		if !seen[v.Value] {
+			seen[v.Value] = true
+			fmt.Fprintf(b, "        %d => '%s',\n", v.Value, v.Name)
+		}
+	}
+	b.WriteString("        _ => '$value',\n")
+	b.WriteString("      };\n")
+	b.WriteString("}\n\n")
+}
+
+func writeDartFunc(b *bytes.Buffer, d *dartNames, f *cFunc, indent string) {
+	in := indent + "  "
+	var ps, args, pre, callables []string
+	arena := f.Result != nil
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "handle")
+			continue
+		}
+		n := dartIdent(camelName(p.Name))
+		ps = append(ps, d.dartType(p)+" "+n)
+		switch p.Kind {
+		case valHandle:
+			args = append(args, n+".handle")
+		case valString:
+			arena = true
+			args = append(args, n+".toNativeUtf8(allocator: arena)")
+		case valBytes:
+			arena = true
+			args = append(args, "_buffer("+n+", arena)", n+".length")
+		case valStruct:
+			arena = true
+			args = append(args, "_to"+d.name[p.Struct]+"Struct("+n+", arena)")
+		case valCallback:
+			cb := n + "Callable"
+			callables = append(callables, cb)
+			pre = append(pre, fmt.Sprintf("final %s = %s;", cb, dartCallable(p.Callback, n)))
+			args = append(args, cb+".nativeFunction", "nullptr")
+		default:
+			args = append(args, n)
+		}
+	}
+	ret, result := "void", ""
+	var outs []string
+	if r := f.Result; r != nil {
+		ret = d.dartType(*r)
+		switch r.Kind {
+		case valEnum:
+			outs = append(outs, "final out = arena<Int32>();")
+			result = "out.value"
+		case valHandle:
+			outs = append(outs, "final out = arena<UintPtr>();")
+			result = d.name[r.Handle] + "(out.value)"
+		case valString:
+			outs = append(outs, "final out = arena<Pointer<Utf8>>();")
+			result = "_takeString(out.value)"
+		case valBytes:
+			outs = append(outs, "final out = arena<Pointer<Uint8>>();", "final outLen = arena<Size>();")
+			result = "_takeBytes(out.value, outLen.value)"
+		case valStruct:
+			outs = append(outs, fmt.Sprintf("final out = arena<%sStruct>();", d.name[r.Struct]))
+			result = "_take" + d.name[r.Struct] + "(out)"
+		default:
+			outs = append(outs, fmt.Sprintf("final out = arena<%s>();", dartNatives[r.C]))
+			result = "out.value"
+		}
+		args = append(args, "out")
+		if r.Kind == valBytes {
+			args = append(args, "outLen")
+		}
+	}
+	fmt.Fprintf(b, "%s/// `%s`\n", indent, strings.TrimSuffix(f.cPrototype(), ";"))
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%s@Deprecated(%s)\n", indent, dartString(f.Deprecated))
+	}
+	fmt.Fprintf(b, "%s%s %s(%s) {\n", indent, ret, d.funcName(f), strings.Join(ps, ", "))
+	for _, s := range pre {
+		fmt.Fprintf(b, "%s%s\n", in, s)
+	}
+	body := in
+	if arena {
+		fmt.Fprintf(b, "%sfinal arena = Arena();\n", in)
+	}
+	if arena || len(callables) > 0 {
+		fmt.Fprintf(b, "%stry {\n", in)
+		body = in + "  "
+	}
+	for _, s := range outs {
+		fmt.Fprintf(b, "%s%s\n", body, s)
+	}
+	fmt.Fprintf(b, "%s_check(%s(%s));\n", body, f.Symbol, strings.Join(args, ", "))
+	if result != "" {
+		fmt.Fprintf(b, "%sreturn %s;\n", body, result)
+	}
+	if arena || len(callables) > 0 {
+		fmt.Fprintf(b, "%s} finally {\n", in)
+		for _, cb := range callables {
+			fmt.Fprintf(b, "%s  %s.close();\n", in, cb)
+		}
+		if arena {
+			fmt.Fprintf(b, "%s  arena.releaseAll();\n", in)
+		}
+		fmt.Fprintf(b, "%s}\n", in)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// dartCallable renders the NativeCallable calling the Dart callback fn. It is isolate-local:
+// the library calls it on the calling thread while the export runs.
+func dartCallable(cb *cCallback, fn string) string {
+	var ps, args []string
+	for _, p := range cb.Params {
+		n := dartIdent(p.Name)
+		switch p.Kind {
+		case valString:
+			ps = append(ps, "Pointer<Utf8> "+n)
+			args = append(args, "_string("+n+")")
+		case valBytes:
+			ps = append(ps, "Pointer<Uint8> "+n, "int "+n+"Len")
+			args = append(args, "_bytes("+n+", "+n+"Len)")
+		default:
+			ps = append(ps, dartScalar(p.C)+" "+n)
+			args = append(args, n)
+		}
+	}
+	ps = append(ps, "Pointer<Void> userData")
+	s := fmt.Sprintf("NativeCallable<%s>.isolateLocal((%s) => %s(%s)", cb.Type, strings.Join(ps, ", "), fn, strings.Join(args, ", "))
+	if cb.Ret != "" {
+		s += ", exceptionalReturn: " + dartZero(dartScalar(cb.Ret))
+	}
+	return s + ")"
+}
+
+// dartString quotes s as a single-quoted Dart string literal.
+func dartString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "$", `\$`, "\n", `\n`)
+	return "'" + r.Replace(s) + "'"
+}
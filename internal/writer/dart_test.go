@@ -0,0 +1,52 @@
+package writer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// pubspec makes the bindings a package depending on package:ffi.
+const pubspec = `name: sample
+environment:
+  sdk: ">=3.0.0 <4.0.0"
+dependencies:
+  ffi: ^2.0.0
+`
+
+func TestWriteDartAnalyzes(t *testing.T) {
+	dart, err := exec.LookPath("dart")
+	if err != nil {
+		t.Skip("no dart")
+	}
+	tests := []struct {
+		name string
+		apis func(*testing.T) []*scanner.API
+	}{
+		{"sample", scanSample},
+		{"members", func(*testing.T) []*scanner.API { return memberAPI() }},
+		{"helpers", func(*testing.T) []*scanner.API { return helperAPI() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := generate(t, "dart", tt.apis(t))
+			if err := os.WriteFile(filepath.Join(dir, "pubspec.yaml"), []byte(pubspec), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			get := exec.Command(dart, "pub", "get", "--offline")
+			get.Dir = dir
+			if out, err := get.CombinedOutput(); err != nil {
+				t.Skipf("package:ffi is not in the pub cache: %v\n%s", err, out)
+			}
+			// Only errors fail; warnings such as unused imports depend on the API.
+			analyze := exec.Command(dart, "analyze", "--no-fatal-warnings", "sample.dart")
+			analyze.Dir = dir
+			if out, err := analyze.CombinedOutput(); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,1384 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WriteJava writes Java bindings of the scanned packages into dir, under the directories of
+// package pkg (empty: the library name): <Lib>Jna (JNA 5), <Lib>Panama (java.lang.foreign,
+// Java 22+), and the exception, constant, struct and callback types both share. libName is the
+// base name of the shared library built by the build scripts.
+func WriteJava(dir, pkg, libName, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	if pkg == "" {
+		pkg = javaPackageName(libName)
+	}
+	j := newJavaNames(m, libName)
+	if err := j.check(); err != nil {
+		return err
+	}
+	files := map[string]*bytes.Buffer{}
+	file := func(name string) *bytes.Buffer {
+		b := &bytes.Buffer{}
+		files[name] = b
+		return b
+	}
+	writeJavaException(file("ForgecException"), pkg)
+	writeJavaConstants(file("Status"), pkg, "Status", "Status codes returned by the exports; custom codes start at 100.", m.Status)
+	for _, e := range m.Enums {
+		writeJavaConstants(file(j.name[e]), pkg, j.name[e], e.Type+" values.", e)
+	}
+	for _, s := range m.Structs {
+		writeJavaStruct(file(j.name[s]), pkg, j.name[s], s)
+	}
+	for _, cb := range m.Callbacks {
+		writeJavaCallback(file(j.name[cb]), pkg, j.name[cb], cb)
+	}
+	writeJavaJNA(file(j.jna), pkg, m, j, libName)
+	writeJavaPanama(file(j.panama), pkg, m, j, libName)
+
+	out := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(pkg, ".", "/")))
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return fmt.Errorf("mkdir %s: %w", out, err)
+	}
+	for name, b := range files {
+		p := filepath.Join(out, name+".java")
+		if err := os.WriteFile(p, b.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// javaPackageName derives a package name from a library name: my-lib -> my_lib.
+func javaPackageName(libName string) string {
+	p := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, libName)
+	if p == "" || unicode.IsDigit(rune(p[0])) || javaKeywords[p] {
+		p = "_" + p
+	}
+	return p
+}
+
+// javaNames spells the model in Java: PascalCase types, camelCase methods, params and fields;
+// the native declarations keep the C names.
+type javaNames struct {
+	m           *cModel
+	jna, panama string
+	name        map[any]string // *cEnum, *cHandle, *cStruct, *cCallback -> type name
+}
+
+func newJavaNames(m *cModel, libName string) *javaNames {
+	base := pascalName(javaPackageName(libName))
+	j := &javaNames{m: m, jna: base + "Jna", panama: base + "Panama", name: map[any]string{m.Status: "Status"}}
+	for _, e := range m.Enums {
+		j.name[e] = pascalName(e.Name)
+	}
+	for _, h := range m.Handles {
+		j.name[h] = pascalName(h.Name)
+	}
+	for _, s := range m.Structs {
+		j.name[s] = pascalName(s.Name)
+	}
+	for _, cb := range m.Callbacks {
+		j.name[cb] = pascalName(strings.TrimPrefix(cb.Type, m.Prefix))
+	}
+	return j
+}
+
+// check reports Java type or method names declared twice. Top-level types are files, and handles
+// are nested in both binding classes next to the JNA Api interface, SizeT and the <Struct>Struct
+// classes, so their names must also differ in more than case.
+func (j *javaNames) check() error {
+	files := newNameSet("java", true)
+	files.reserve("", "forgec", "ForgecException", j.jna, j.panama)
+	nested := newNameSet("java", true)
+	nested.reserve("", "forgec", "Api", "SizeT")
+	for k, name := range j.name {
+		var by string
+		switch v := k.(type) {
+		case *cEnum:
+			by = v.Type
+		case *cHandle:
+			if err := nested.declare("", name, v.Type); err != nil {
+				return err
+			}
+			continue
+		case *cStruct:
+			by = v.Name
+			if err := nested.declare("", name+"Struct", by); err != nil {
+				return err
+			}
+		case *cCallback:
+			by = v.Type
+		}
+		if err := files.declare("", name, by); err != nil {
+			return err
+		}
+	}
+	methods := newNameSet("java", false)
+	methods.reserve(".", "forgec", javaHelpers...)
+	for _, h := range j.m.Handles {
+		methods.reserve(j.name[h]+".", "forgec", javaHandleMembers...)
+	}
+	for _, f := range j.m.Funcs {
+		scope := "."
+		if f.Recv != nil {
+			scope = j.name[f.Recv] + "."
+		}
+		if err := methods.declare(scope, j.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// javaHelpers are the helpers of the binding classes, which a method of the same name would hide;
+// functions of the same name are escaped.
+var javaHelpers = []string{"lastErrorJson", "clearLastError", "reporterConfigure", "flush", "check", "utf8z", "string",
+	"bytes", "address", "takeString", "takeBytes", "keep", "toNative", "take", "cstring", "buffer", "invoke",
+	"target", "downcall"}
+
+// javaHandleMembers are declared by every nested handle class or hidden by its methods; methods
+// of the same name are escaped.
+var javaHandleMembers = append([]string{"close", "handle"}, javaHelpers...)
+
+func (j *javaNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(javaIdent(camelName(f.Method)), javaHandleMembers)
+	}
+	return memberName(javaIdent(camelName(f.Name)), javaHelpers)
+}
+
+var javaKeywords = map[string]bool{
+	"abstract": true, "assert": true, "boolean": true, "break": true, "byte": true, "case": true,
+	"catch": true, "char": true, "class": true, "const": true, "continue": true, "default": true,
+	"do": true, "double": true, "else": true, "enum": true, "extends": true, "false": true, "final": true,
+	"finally": true, "float": true, "for": true, "goto": true, "if": true, "implements": true,
+	"import": true, "instanceof": true, "int": true, "interface": true, "long": true, "native": true,
+	"new": true, "null": true, "package": true, "private": true, "protected": true, "public": true,
+	"return": true, "short": true, "static": true, "strictfp": true, "super": true, "switch": true,
+	"synchronized": true, "this": true, "throw": true, "throws": true, "transient": true, "true": true,
+	"try": true, "void": true, "volatile": true, "while": true, "_": true,
+}
+
+// javaIdent escapes Java keywords with a trailing underscore.
+func javaIdent(name string) string {
+	if javaKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// javaTypes maps C scalar types to Java; unsigned types use the signed type of the same size.
+var javaTypes = map[string]string{
+	"int8_t":    "byte",
+	"int16_t":   "short",
+	"int32_t":   "int",
+	"int64_t":   "long",
+	"uint8_t":   "byte",
+	"uint16_t":  "short",
+	"uint32_t":  "int",
+	"uint64_t":  "long",
+	"uintptr_t": "long",
+	"float":     "float",
+	"double":    "double",
+	"bool":      "boolean",
+}
+
+// javaType is the type of a value in the public API of both bindings.
+func (j *javaNames) javaType(v cValue) string {
+	switch v.Kind {
+	case valEnum:
+		return "int"
+	case valHandle:
+		return j.name[v.Handle]
+	case valString:
+		return "String"
+	case valBytes:
+		return "byte[]"
+	case valStruct:
+		return j.name[v.Struct]
+	case valCallback:
+		return j.name[v.Callback]
+	}
+	return javaTypes[v.C]
+}
+
+// javaBoxed is the boxed type of a Java primitive, for generics.
+func javaBoxed(t string) string {
+	switch t {
+	case "int":
+		return "Integer"
+	case "boolean", "byte", "short", "long", "float", "double":
+		return strings.ToUpper(t[:1]) + t[1:]
+	}
+	return t
+}
+
+func javaHeader(b *bytes.Buffer, pkg string, imports ...string) {
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "package %s;\n\n", pkg)
+	static := false
+	for _, imp := range imports {
+		if strings.HasPrefix(imp, "static ") && !static {
+			static = true
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "import %s;\n", imp)
+	}
+	if len(imports) > 0 {
+		b.WriteString("\n")
+	}
+}
+
+func writeJavaException(b *bytes.Buffer, pkg string) {
+	javaHeader(b, pkg)
+	b.WriteString(`/**
+ * Thrown when an export returns a non-OK status. It carries the record returned by
+ * {@code capi_last_error_json} (see forgec.error.schema.json) and its main fields.
+ */
+public class ForgecException extends Exception {
+    private static final long serialVersionUID = 1L;
+
+    private final int status;
+    private final String function;
+    private final String error;
+    private final String errorType;
+    private final String json;
+
+    public ForgecException(int status, String json) {
+        super(field(json, "function") + ": " + field(json, "error") + " (" + Status.name(status) + ")");
+        this.status = status;
+        this.function = field(json, "function");
+        this.error = field(json, "error");
+        this.errorType = field(json, "type");
+        this.json = json;
+    }
+
+    /** The status returned by the export, one of {@link Status} or a custom code. */
+    public int status() {
+        return status;
+    }
+
+    /** The C name of the failed export, e.g., PM_Find. */
+    public String function() {
+        return function;
+    }
+
+    /** The Go error message. */
+    public String error() {
+        return error;
+    }
+
+    /** The Go type of the error or panic value. */
+    public String errorType() {
+        return errorType;
+    }
+
+    /** The whole error record as JSON, including wrapped errors and panic stacks. */
+    public String json() {
+        return json;
+    }
+
+    // field returns a top-level string field of a JSON object, without depending on a JSON library.
+    static String field(String json, String key) {
+        int depth = 0;
+        for (int i = 0; i < json.length(); i++) {
+            char c = json.charAt(i);
+            if (c == '{' || c == '[') {
+                depth++;
+            } else if (c == '}' || c == ']') {
+                depth--;
+            } else if (c == '"') {
+                StringBuilder s = new StringBuilder();
+                i = string(json, i, s);
+                if (i < 0) {
+                    return "";
+                }
+                int next = skipSpace(json, i + 1);
+                if (depth == 1 && key.contentEquals(s) && next < json.length() && json.charAt(next) == ':') {
+                    int value = skipSpace(json, next + 1);
+                    if (value >= json.length() || json.charAt(value) != '"') {
+                        return "";
+                    }
+                    StringBuilder v = new StringBuilder();
+                    return string(json, value, v) < 0 ? "" : v.toString();
+                }
+            }
+        }
+        return "";
+    }
+
+    private static int skipSpace(String json, int i) {
+        while (i < json.length() && Character.isWhitespace(json.charAt(i))) {
+            i++;
+        }
+        return i;
+    }
+
+    // string decodes the JSON string starting at the quote at start into out and returns the
+    // index of its closing quote, or -1 if it is malformed.
+    private static int string(String json, int start, StringBuilder out) {
+        for (int i = start + 1; i < json.length(); i++) {
+            char c = json.charAt(i);
+            if (c == '"') {
+                return i;
+            }
+            if (c != '\\') {
+                out.append(c);
+                continue;
+            }
+            if (++i >= json.length()) {
+                return -1;
+            }
+            switch (json.charAt(i)) {
+                case 'b': out.append('\b'); break;
+                case 'f': out.append('\f'); break;
+                case 'n': out.append('\n'); break;
+                case 'r': out.append('\r'); break;
+                case 't': out.append('\t'); break;
+                case 'u':
+                    if (i + 4 >= json.length()) {
+                        return -1;
+                    }
+                    out.append((char) Integer.parseInt(json.substring(i + 1, i + 5), 16));
+                    i += 4;
+                    break;
+                default: out.append(json.charAt(i));
+            }
+        }
+        return -1;
+    }
+}
+`)
+}
+
+// writeJavaConstants writes a C enum as int constants, so values unknown to the bindings
+// (e.g., combined flags or new status codes) stay representable.
+func writeJavaConstants(b *bytes.Buffer, pkg, name, doc string, e *cEnum) {
+	javaHeader(b, pkg)
+	fmt.Fprintf(b, "/** %s */\n", doc)
+	fmt.Fprintf(b, "public final class %s {\n", name)
+	fmt.Fprintf(b, "    private %s() {\n    }\n\n", name)
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "    public static final int %s = %d;\n", javaIdent(v.Name), v.Value)
+	}
+	b.WriteString("\n    /** Returns the name of a value, or the number if it is unknown. */\n")
+	b.WriteString("    public static String name(int value) {\n")
+	b.WriteString("        switch (value) {\n")
+	seen := map[int64]bool{}
+	for _, v := range e.Values {
+		if !seen[v.Value] {
+			seen[v.Value] = true
+			fmt.Fprintf(b, "            case %d: return %q;\n", v.Value, v.Name)
+		}
+	}
+	b.WriteString("            default: return Integer.toString(value);\n")
+	b.WriteString("        }\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n")
+}
+
+func writeJavaStruct(b *bytes.Buffer, pkg, name string, s *cStruct) {
+	javaHeader(b, pkg)
+	fmt.Fprintf(b, "/** A copy of the C struct {@code %s}. */\n", s.Name)
+	fmt.Fprintf(b, "public final class %s {\n", name)
+	for _, f := range s.Fields {
+		t := javaTypes[f.C]
+		if f.String {
+			t = "String"
+		}
+		fmt.Fprintf(b, "    public %s %s;\n", t, javaIdent(camelName(f.Name)))
+	}
+	b.WriteString("\n    @Override\n    public String toString() {\n")
+	var parts []string
+	for i, f := range s.Fields {
+		sep := ", "
+		if i == 0 {
+			sep = ""
+		}
+		parts = append(parts, fmt.Sprintf("%q + %s", sep+camelName(f.Name)+"=", javaIdent(camelName(f.Name))))
+	}
+	fmt.Fprintf(b, "        return %q + %s + \"}\";\n", name+"{", strings.Join(parts, " + "))
+	b.WriteString("    }\n}\n")
+}
+
+func writeJavaCallback(b *bytes.Buffer, pkg, name string, cb *cCallback) {
+	javaHeader(b, pkg)
+	fmt.Fprintf(b, "/** The Java side of the C callback {@code %s}, called while the export runs. */\n", cb.Type)
+	b.WriteString("@FunctionalInterface\n")
+	fmt.Fprintf(b, "public interface %s {\n", name)
+	var ps []string
+	for _, p := range cb.Params {
+		t := javaTypes[p.C]
+		switch p.Kind {
+		case valString:
+			t = "String"
+		case valBytes:
+			t = "byte[]"
+		}
+		ps = append(ps, t+" "+javaIdent(camelName(p.Name)))
+	}
+	ret := "void"
+	if cb.Ret != "" {
+		ret = javaTypes[cb.Ret]
+	}
+	fmt.Fprintf(b, "    %s call(%s);\n", ret, strings.Join(ps, ", "))
+	b.WriteString("}\n")
+}
+
+// JNA
+
+// jnaType is the JNA type of a C scalar in the Api interface, structs and callbacks.
+func jnaType(c string) string {
+	switch c {
+	case "bool":
+		return "byte"
+	case "uintptr_t":
+		return "SizeT"
+	}
+	return javaTypes[c]
+}
+
+// jnaByRef is the JNA by-reference type of a scalar out-param and the expression reading it.
+func jnaByRef(c string) (typ, get string) {
+	switch c {
+	case "int8_t", "uint8_t":
+		return "ByteByReference", "out.getValue()"
+	case "bool":
+		return "ByteByReference", "out.getValue() != 0"
+	case "int16_t", "uint16_t":
+		return "ShortByReference", "out.getValue()"
+	case "int64_t", "uint64_t":
+		return "LongByReference", "out.getValue()"
+	case "uintptr_t":
+		return "PointerByReference", "address(out.getValue())"
+	case "float":
+		return "FloatByReference", "out.getValue()"
+	case "double":
+		return "DoubleByReference", "out.getValue()"
+	}
+	return "IntByReference", "out.getValue()"
+}
+
+func (j *javaNames) jnaParams(f *cFunc) []string {
+	var ps []string
+	for _, p := range f.Params {
+		n := javaIdent(p.Name)
+		switch p.Kind {
+		case valEnum:
+			ps = append(ps, "int "+n)
+		case valHandle:
+			ps = append(ps, "SizeT "+n)
+		case valString:
+			ps = append(ps, "byte[] "+n)
+		case valBytes:
+			ps = append(ps, "byte[] "+n, "SizeT "+n+"_len")
+		case valStruct:
+			ps = append(ps, j.name[p.Struct]+"Struct "+n)
+		case valCallback:
+			ps = append(ps, p.C+" "+n, "Pointer "+n+"_user_data")
+		default:
+			ps = append(ps, jnaType(p.C)+" "+n)
+		}
+	}
+	if r := f.Result; r != nil {
+		switch r.Kind {
+		case valEnum:
+			ps = append(ps, "IntByReference out")
+		case valHandle, valString:
+			ps = append(ps, "PointerByReference out")
+		case valBytes:
+			ps = append(ps, "PointerByReference out", "PointerByReference out_len")
+		case valStruct:
+			ps = append(ps, j.name[r.Struct]+"Struct out")
+		default:
+			t, _ := jnaByRef(r.C)
+			ps = append(ps, t+" out")
+		}
+	}
+	return ps
+}
+
+func writeJavaJNA(b *bytes.Buffer, pkg string, m *cModel, j *javaNames, libName string) {
+	javaHeader(b, pkg,
+		"com.sun.jna.Callback",
+		"com.sun.jna.IntegerType",
+		"com.sun.jna.Library",
+		"com.sun.jna.Memory",
+		"com.sun.jna.Native",
+		"com.sun.jna.Pointer",
+		"com.sun.jna.Structure",
+		"com.sun.jna.ptr.ByteByReference",
+		"com.sun.jna.ptr.DoubleByReference",
+		"com.sun.jna.ptr.FloatByReference",
+		"com.sun.jna.ptr.IntByReference",
+		"com.sun.jna.ptr.LongByReference",
+		"com.sun.jna.ptr.PointerByReference",
+		"com.sun.jna.ptr.ShortByReference",
+		"java.lang.ref.Reference",
+		"java.nio.charset.StandardCharsets",
+		"java.util.ArrayList",
+		"java.util.List",
+	)
+	fmt.Fprintf(b, "/**\n * JNA bindings of the %s library. {@link Api} declares the C API of forgec.h; the static\n", libName)
+	b.WriteString(" * methods wrap it, throwing {@link ForgecException} on a non-OK status and returning the\n")
+	b.WriteString(" * out-param. The library is loaded by JNA from jna.library.path or the system search path,\n")
+	fmt.Fprintf(b, " * or from the path in the system property {@code %s.library}.\n */\n", libName)
+	fmt.Fprintf(b, "@SuppressWarnings({\"unused\", \"deprecation\"})\n")
+	fmt.Fprintf(b, "public final class %s {\n", j.jna)
+	fmt.Fprintf(b, "    private %s() {\n    }\n\n", j.jna)
+
+	b.WriteString("    /** A size_t or uintptr_t. */\n")
+	b.WriteString("    public static final class SizeT extends IntegerType {\n")
+	b.WriteString("        private static final long serialVersionUID = 1L;\n\n")
+	b.WriteString("        public SizeT() {\n            this(0);\n        }\n\n")
+	b.WriteString("        public SizeT(long value) {\n            super(Native.SIZE_T_SIZE, value, true);\n        }\n    }\n\n")
+
+	for _, s := range m.Structs {
+		var order []string
+		for _, f := range s.Fields {
+			order = append(order, strconv.Quote(f.Name))
+		}
+		fmt.Fprintf(b, "    /** The C layout of {@code %s}. */\n", s.Name)
+		fmt.Fprintf(b, "    @Structure.FieldOrder({%s})\n", strings.Join(order, ", "))
+		fmt.Fprintf(b, "    public static class %sStruct extends Structure {\n", j.name[s])
+		for _, f := range s.Fields {
+			t := jnaType(f.C)
+			if f.String {
+				t = "Pointer"
+			}
+			fmt.Fprintf(b, "        public %s %s;\n", t, f.Name)
+		}
+		b.WriteString("    }\n\n")
+	}
+
+	b.WriteString("    /** The C API of forgec.h. */\n")
+	b.WriteString("    public interface Api extends Library {\n")
+	for _, cb := range m.Callbacks {
+		var ps []string
+		for _, p := range cb.Params {
+			n := javaIdent(p.Name)
+			switch p.Kind {
+			case valString:
+				ps = append(ps, "Pointer "+n)
+			case valBytes:
+				ps = append(ps, "Pointer "+n, "SizeT "+n+"_len")
+			default:
+				ps = append(ps, jnaType(p.C)+" "+n)
+			}
+		}
+		ps = append(ps, "Pointer user_data")
+		ret := "void"
+		if cb.Ret != "" {
+			ret = jnaType(cb.Ret)
+		}
+		fmt.Fprintf(b, "        interface %s extends Callback {\n            %s invoke(%s);\n        }\n\n", cb.Type, ret, strings.Join(ps, ", "))
+	}
+	b.WriteString("        void capi_free(Pointer p);\n\n")
+	b.WriteString("        Pointer capi_last_error_json();\n\n")
+	b.WriteString("        void capi_clear_last_error();\n\n")
+	b.WriteString("        int capi_reporter_configure(byte[] name, byte[] config);\n\n")
+	b.WriteString("        byte capi_flush(int timeout_ms);\n")
+	for _, s := range m.Structs {
+		fmt.Fprintf(b, "\n        void %s(%sStruct v);\n", s.Free, j.name[s])
+	}
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "\n        int %s(SizeT h);\n", h.Release)
+	}
+	for _, f := range m.Funcs {
+		b.WriteString("\n")
+		if f.Deprecated != "" {
+			fmt.Fprintf(b, "        /** @deprecated %s */\n        @Deprecated\n", f.Deprecated)
+		}
+		fmt.Fprintf(b, "        int %s(%s);\n", f.Symbol, strings.Join(j.jnaParams(f), ", "))
+	}
+	b.WriteString("    }\n\n")
+	fmt.Fprintf(b, "    public static final Api LIB = Native.load(System.getProperty(%q, %q), Api.class);\n\n", libName+".library", libName)
+
+	b.WriteString("    /** Returns the last error recorded on the calling thread as JSON ({} if none). */\n")
+	b.WriteString("    public static String lastErrorJson() {\n")
+	b.WriteString("        Pointer p = LIB.capi_last_error_json();\n")
+	b.WriteString("        return p == null ? \"{}\" : takeString(p);\n")
+	b.WriteString("    }\n\n")
+	b.WriteString("    public static void clearLastError() {\n        LIB.capi_clear_last_error();\n    }\n\n")
+	b.WriteString("    /** Configures a registered reporter, e.g., \"jsonl\" or \"sentry\". */\n")
+	b.WriteString("    public static void reporterConfigure(String name, String configJson) throws ForgecException {\n")
+	b.WriteString("        check(LIB.capi_reporter_configure(utf8z(name), utf8z(configJson)));\n")
+	b.WriteString("    }\n\n")
+	b.WriteString("    /** Waits up to timeoutMs for reporters to deliver queued reports. */\n")
+	b.WriteString("    public static boolean flush(int timeoutMs) {\n")
+	b.WriteString("        return LIB.capi_flush(timeoutMs) != 0;\n")
+	b.WriteString("    }\n")
+
+	for _, h := range m.Handles {
+		name := j.name[h]
+		fmt.Fprintf(b, "\n    /** {@code %s}: an opaque reference to a Go object, released by {@link #close}. */\n", h.Type)
+		fmt.Fprintf(b, "    public static final class %s implements AutoCloseable {\n", name)
+		b.WriteString("        private long handle;\n\n")
+		fmt.Fprintf(b, "        public %s(long handle) {\n            this.handle = handle;\n        }\n\n", name)
+		b.WriteString("        public long handle() {\n            return handle;\n        }\n\n")
+		b.WriteString("        @Override\n")
+		b.WriteString("        public void close() throws ForgecException {\n")
+		b.WriteString("            if (handle == 0) {\n                return;\n            }\n")
+		b.WriteString("            long h = handle;\n")
+		b.WriteString("            handle = 0;\n")
+		fmt.Fprintf(b, "            check(LIB.%s(new SizeT(h)));\n", h.Release)
+		b.WriteString("        }\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writeJNAFunc(b, j, f, "        ")
+		}
+		b.WriteString("    }\n")
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			b.WriteString("\n")
+			writeJNAFunc(b, j, f, "    ")
+		}
+	}
+
+	b.WriteString(`
+    static void check(int status) throws ForgecException {
+        if (status != 0) {
+            throw new ForgecException(status, lastErrorJson());
+        }
+    }
+
+    // utf8z encodes a string as NUL-terminated UTF-8; null stays null (read as "" by Go).
+    static byte[] utf8z(String s) {
+        if (s == null) {
+            return null;
+        }
+        byte[] b = s.getBytes(StandardCharsets.UTF_8);
+        byte[] z = new byte[b.length + 1];
+        System.arraycopy(b, 0, z, 0, b.length);
+        return z;
+    }
+
+    static String string(Pointer p) {
+        return p == null ? null : p.getString(0, "UTF-8");
+    }
+
+    static byte[] bytes(Pointer p, long n) {
+        return p == null || n == 0 ? new byte[0] : p.getByteArray(0, (int) n);
+    }
+
+    static long address(Pointer p) {
+        return p == null ? 0 : Pointer.nativeValue(p);
+    }
+
+    static String takeString(Pointer p) {
+        if (p == null) {
+            return "";
+        }
+        try {
+            return string(p);
+        } finally {
+            LIB.capi_free(p);
+        }
+    }
+
+    static byte[] takeBytes(Pointer p, long n) {
+        try {
+            return bytes(p, n);
+        } finally {
+            if (p != null) {
+                LIB.capi_free(p);
+            }
+        }
+    }
+
+    // keep copies s into native memory that stays valid while keep is reachable.
+    static Pointer keep(String s, List<Memory> keep) {
+        byte[] z = utf8z(s);
+        if (z == null) {
+            return null;
+        }
+        Memory m = new Memory(z.length);
+        m.write(0, z, 0, z.length);
+        keep.add(m);
+        return m;
+    }
+`)
+	for _, s := range m.Structs {
+		name := j.name[s]
+		fmt.Fprintf(b, "\n    static %sStruct toNative(%s v, List<Memory> keep) {\n", name, name)
+		fmt.Fprintf(b, "        %sStruct n = new %sStruct();\n", name, name)
+		b.WriteString("        if (v == null) {\n            return n;\n        }\n")
+		for _, f := range s.Fields {
+			fn := javaIdent(camelName(f.Name))
+			switch {
+			case f.String:
+				fmt.Fprintf(b, "        n.%s = keep(v.%s, keep);\n", f.Name, fn)
+			case f.C == "bool":
+				fmt.Fprintf(b, "        n.%s = (byte) (v.%s ? 1 : 0);\n", f.Name, fn)
+			case f.C == "uintptr_t":
+				fmt.Fprintf(b, "        n.%s = new SizeT(v.%s);\n", f.Name, fn)
+			default:
+				fmt.Fprintf(b, "        n.%s = v.%s;\n", f.Name, fn)
+			}
+		}
+		b.WriteString("        return n;\n    }\n")
+		fmt.Fprintf(b, "\n    // take copies a struct returned by the library and releases its strings.\n")
+		fmt.Fprintf(b, "    static %s take(%sStruct n) {\n", name, name)
+		fmt.Fprintf(b, "        %s v = new %s();\n", name, name)
+		for _, f := range s.Fields {
+			fn := javaIdent(camelName(f.Name))
+			switch {
+			case f.String:
+				fmt.Fprintf(b, "        v.%s = string(n.%s);\n", fn, f.Name)
+			case f.C == "bool":
+				fmt.Fprintf(b, "        v.%s = n.%s != 0;\n", fn, f.Name)
+			case f.C == "uintptr_t":
+				fmt.Fprintf(b, "        v.%s = n.%s.longValue();\n", fn, f.Name)
+			default:
+				fmt.Fprintf(b, "        v.%s = n.%s;\n", fn, f.Name)
+			}
+		}
+		fmt.Fprintf(b, "        LIB.%s(n);\n", s.Free)
+		b.WriteString("        return v;\n    }\n")
+	}
+	b.WriteString("}\n")
+}
+
+// javaSignature renders the wrapper declaration of an export.
+func (j *javaNames) javaSignature(f *cFunc, static bool) string {
+	var ps []string
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			continue
+		}
+		ps = append(ps, j.javaType(p)+" "+javaIdent(camelName(p.Name)))
+	}
+	ret := "void"
+	if f.Result != nil {
+		ret = j.javaType(*f.Result)
+	}
+	mod := "public "
+	if static {
+		mod += "static "
+	}
+	return fmt.Sprintf("%s%s %s(%s) throws ForgecException", mod, ret, j.funcName(f), strings.Join(ps, ", "))
+}
+
+func writeJavaDoc(b *bytes.Buffer, f *cFunc, indent string) {
+	proto := strings.TrimSuffix(f.cPrototype(), ";")
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%s/**\n%s * {@code %s}\n%s *\n%s * @deprecated %s\n%s */\n%s@Deprecated\n", indent, indent, proto, indent, indent, f.Deprecated, indent, indent)
+		return
+	}
+	fmt.Fprintf(b, "%s/** {@code %s} */\n", indent, proto)
+}
+
+func writeJNAFunc(b *bytes.Buffer, j *javaNames, f *cFunc, indent string) {
+	in := indent + "    "
+	var args, pre, fences []string
+	var keep bool
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "new SizeT(handle)")
+			continue
+		}
+		n := javaIdent(camelName(p.Name))
+		switch p.Kind {
+		case valHandle:
+			args = append(args, "new SizeT("+n+" == null ? 0 : "+n+".handle())")
+		case valString:
+			args = append(args, "utf8z("+n+")")
+		case valBytes:
+			args = append(args, n, "new SizeT("+n+" == null ? 0 : "+n+".length)")
+		case valStruct:
+			keep = true
+			args = append(args, "toNative("+n+", keep)")
+		case valCallback:
+			cb := "_" + n
+			pre = append(pre, fmt.Sprintf("Api.%s %s = %s == null ? null : %s;", p.C, cb, n, jnaCallbackLambda(p.Callback, n)))
+			fences = append(fences, cb)
+			args = append(args, cb, "null")
+		case valScalar:
+			switch p.C {
+			case "bool":
+				args = append(args, "(byte) ("+n+" ? 1 : 0)")
+			case "uintptr_t":
+				args = append(args, "new SizeT("+n+")")
+			default:
+				args = append(args, n)
+			}
+		default:
+			args = append(args, n)
+		}
+	}
+	if keep {
+		pre = append([]string{"List<Memory> keep = new ArrayList<>();"}, pre...)
+	}
+	r := f.Result
+	var ret string
+	if r != nil {
+		switch r.Kind {
+		case valEnum:
+			pre = append(pre, "IntByReference out = new IntByReference();")
+			ret = "out.getValue()"
+		case valHandle:
+			pre = append(pre, "PointerByReference out = new PointerByReference();")
+			ret = fmt.Sprintf("address(out.getValue()) == 0 ? null : new %s(address(out.getValue()))", j.name[r.Handle])
+		case valString:
+			pre = append(pre, "PointerByReference out = new PointerByReference();")
+			ret = "takeString(out.getValue())"
+		case valBytes:
+			pre = append(pre, "PointerByReference out = new PointerByReference();", "PointerByReference outLen = new PointerByReference();")
+			ret = "takeBytes(out.getValue(), address(outLen.getValue()))"
+		case valStruct:
+			pre = append(pre, fmt.Sprintf("%sStruct out = new %sStruct();", j.name[r.Struct], j.name[r.Struct]))
+			ret = "take(out)"
+		default:
+			t, get := jnaByRef(r.C)
+			pre = append(pre, fmt.Sprintf("%s out = new %s();", t, t))
+			ret = get
+		}
+		args = append(args, "out")
+		if r.Kind == valBytes {
+			args = append(args, "outLen")
+		}
+	}
+	writeJavaDoc(b, f, indent)
+	fmt.Fprintf(b, "%s%s {\n", indent, j.javaSignature(f, f.Recv == nil))
+	for _, s := range pre {
+		fmt.Fprintf(b, "%s%s\n", in, s)
+	}
+	body := in
+	if keep || len(fences) > 0 {
+		fmt.Fprintf(b, "%stry {\n", in)
+		body = in + "    "
+	}
+	fmt.Fprintf(b, "%scheck(LIB.%s(%s));\n", body, f.Symbol, strings.Join(args, ", "))
+	if r != nil {
+		fmt.Fprintf(b, "%sreturn %s;\n", body, ret)
+	}
+	if keep || len(fences) > 0 {
+		fmt.Fprintf(b, "%s} finally {\n", in)
+		// the native memory and callbacks must stay reachable until the call returns
+		if keep {
+			fmt.Fprintf(b, "%s    Reference.reachabilityFence(keep);\n", in)
+		}
+		for _, cb := range fences {
+			fmt.Fprintf(b, "%s    Reference.reachabilityFence(%s);\n", in, cb)
+		}
+		fmt.Fprintf(b, "%s}\n", in)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// jnaCallbackLambda renders the JNA callback calling a Java callback.
+func jnaCallbackLambda(cb *cCallback, fn string) string {
+	var ps, args []string
+	for _, p := range cb.Params {
+		n := "_" + javaIdent(p.Name)
+		switch p.Kind {
+		case valString:
+			ps = append(ps, n)
+			args = append(args, "string("+n+")")
+		case valBytes:
+			ps = append(ps, n, n+"Len")
+			args = append(args, "bytes("+n+", "+n+"Len.longValue())")
+		default:
+			ps = append(ps, n)
+			switch p.C {
+			case "bool":
+				args = append(args, n+" != 0")
+			case "uintptr_t":
+				args = append(args, n+".longValue()")
+			default:
+				args = append(args, n)
+			}
+		}
+	}
+	ps = append(ps, "_userData")
+	call := fmt.Sprintf("%s.call(%s)", fn, strings.Join(args, ", "))
+	switch cb.Ret {
+	case "bool":
+		call = "(byte) (" + call + " ? 1 : 0)"
+	case "uintptr_t":
+		call = "new SizeT(" + call + ")"
+	}
+	return fmt.Sprintf("(%s) -> %s", strings.Join(ps, ", "), call)
+}
+
+// Panama
+
+// panamaLayout is the java.lang.foreign layout of a C scalar (64-bit platforms).
+var panamaLayouts = map[string]string{
+	"int8_t":      "JAVA_BYTE",
+	"int16_t":     "JAVA_SHORT",
+	"int32_t":     "JAVA_INT",
+	"int64_t":     "JAVA_LONG",
+	"uint8_t":     "JAVA_BYTE",
+	"uint16_t":    "JAVA_SHORT",
+	"uint32_t":    "JAVA_INT",
+	"uint64_t":    "JAVA_LONG",
+	"uintptr_t":   "JAVA_LONG",
+	"float":       "JAVA_FLOAT",
+	"double":      "JAVA_DOUBLE",
+	"bool":        "JAVA_BOOLEAN",
+	"const char*": "ADDRESS",
+}
+
+// panamaSize is the size and alignment of a layout.
+func panamaSize(layout string) int64 {
+	switch layout {
+	case "JAVA_BYTE", "JAVA_BOOLEAN":
+		return 1
+	case "JAVA_SHORT":
+		return 2
+	case "JAVA_INT", "JAVA_FLOAT":
+		return 4
+	}
+	return 8
+}
+
+type panamaField struct {
+	cField
+	Layout string
+	Offset int64
+}
+
+// panamaStruct lays a struct out as the C compiler does: fields at their natural alignment,
+// padded to the largest alignment.
+func panamaStruct(s *cStruct) (fields []panamaField, size int64) {
+	var align int64 = 1
+	for _, f := range s.Fields {
+		l := panamaLayouts[f.C]
+		n := panamaSize(l)
+		size = (size + n - 1) / n * n
+		fields = append(fields, panamaField{cField: f, Layout: l, Offset: size})
+		size += n
+		if n > align {
+			align = n
+		}
+	}
+	return fields, (size + align - 1) / align * align
+}
+
+func panamaValueLayout(v cValue) string {
+	switch v.Kind {
+	case valEnum:
+		return "JAVA_INT"
+	case valHandle:
+		return "JAVA_LONG"
+	case valString, valBytes, valStruct, valCallback:
+		return "ADDRESS"
+	}
+	return panamaLayouts[v.C]
+}
+
+// panamaDescriptor renders the FunctionDescriptor of an export.
+func panamaDescriptor(f *cFunc) string {
+	var ls []string
+	for _, p := range f.Params {
+		switch p.Kind {
+		case valBytes:
+			ls = append(ls, "ADDRESS", "JAVA_LONG")
+		case valCallback:
+			ls = append(ls, "ADDRESS", "ADDRESS")
+		default:
+			ls = append(ls, panamaValueLayout(p))
+		}
+	}
+	if f.Result != nil {
+		ls = append(ls, "ADDRESS")
+		if f.Result.Kind == valBytes {
+			ls = append(ls, "ADDRESS")
+		}
+	}
+	return "FunctionDescriptor.of(" + strings.Join(append([]string{"JAVA_INT"}, ls...), ", ") + ")"
+}
+
+func writeJavaPanama(b *bytes.Buffer, pkg string, m *cModel, j *javaNames, libName string) {
+	javaHeader(b, pkg,
+		"java.lang.foreign.Arena",
+		"java.lang.foreign.FunctionDescriptor",
+		"java.lang.foreign.Linker",
+		"java.lang.foreign.MemoryLayout",
+		"java.lang.foreign.MemorySegment",
+		"java.lang.foreign.SymbolLookup",
+		"java.lang.invoke.MethodHandle",
+		"java.lang.invoke.MethodHandles",
+		"java.lang.invoke.MethodType",
+		"java.nio.file.Path",
+		"java.util.concurrent.atomic.AtomicReference",
+		"static java.lang.foreign.ValueLayout.ADDRESS",
+		"static java.lang.foreign.ValueLayout.JAVA_BOOLEAN",
+		"static java.lang.foreign.ValueLayout.JAVA_BYTE",
+		"static java.lang.foreign.ValueLayout.JAVA_DOUBLE",
+		"static java.lang.foreign.ValueLayout.JAVA_FLOAT",
+		"static java.lang.foreign.ValueLayout.JAVA_INT",
+		"static java.lang.foreign.ValueLayout.JAVA_LONG",
+		"static java.lang.foreign.ValueLayout.JAVA_SHORT",
+	)
+	fmt.Fprintf(b, "/**\n * Bindings of the %s library through the foreign function API (java.lang.foreign, Java 22+;\n", libName)
+	b.WriteString(" * run with --enable-native-access). The static methods throw {@link ForgecException} on a\n")
+	b.WriteString(" * non-OK status and return the out-param. The library is looked up by name in the system\n")
+	fmt.Fprintf(b, " * search path, or loaded from the path in the system property {@code %s.library}. Struct\n", libName)
+	b.WriteString(" * layouts assume a 64-bit platform.\n */\n")
+	fmt.Fprintf(b, "@SuppressWarnings(\"unused\")\n")
+	fmt.Fprintf(b, "public final class %s {\n", j.panama)
+	fmt.Fprintf(b, "    private %s() {\n    }\n\n", j.panama)
+	b.WriteString("    private static final Linker LINKER = Linker.nativeLinker();\n")
+	fmt.Fprintf(b, "    private static final SymbolLookup LOOKUP = System.getProperty(%q) != null\n", libName+".library")
+	fmt.Fprintf(b, "            ? SymbolLookup.libraryLookup(Path.of(System.getProperty(%q)), Arena.global())\n", libName+".library")
+	fmt.Fprintf(b, "            : SymbolLookup.libraryLookup(System.mapLibraryName(%q), Arena.global());\n\n", libName)
+	b.WriteString("    private static MethodHandle downcall(String name, FunctionDescriptor fd) {\n")
+	b.WriteString("        return LINKER.downcallHandle(LOOKUP.find(name).orElseThrow(() -> new UnsatisfiedLinkError(name)), fd);\n")
+	b.WriteString("    }\n\n")
+	b.WriteString("    private static final MethodHandle capi_free = downcall(\"capi_free\", FunctionDescriptor.ofVoid(ADDRESS));\n")
+	b.WriteString("    private static final MethodHandle capi_last_error_json = downcall(\"capi_last_error_json\", FunctionDescriptor.of(ADDRESS));\n")
+	b.WriteString("    private static final MethodHandle capi_clear_last_error = downcall(\"capi_clear_last_error\", FunctionDescriptor.ofVoid());\n")
+	b.WriteString("    private static final MethodHandle capi_reporter_configure = downcall(\"capi_reporter_configure\", FunctionDescriptor.of(JAVA_INT, ADDRESS, ADDRESS));\n")
+	b.WriteString("    private static final MethodHandle capi_flush = downcall(\"capi_flush\", FunctionDescriptor.of(JAVA_BOOLEAN, JAVA_INT));\n")
+	for _, s := range m.Structs {
+		fmt.Fprintf(b, "    private static final MethodHandle %s = downcall(%q, FunctionDescriptor.ofVoid(ADDRESS));\n", s.Free, s.Free)
+	}
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "    private static final MethodHandle %s = downcall(%q, FunctionDescriptor.of(JAVA_INT, JAVA_LONG));\n", h.Release, h.Release)
+	}
+	for _, f := range m.Funcs {
+		fmt.Fprintf(b, "    private static final MethodHandle %s = downcall(%q, %s);\n", f.Symbol, f.Symbol, panamaDescriptor(f))
+	}
+
+	for _, s := range m.Structs {
+		fields, size := panamaStruct(s)
+		var ls []string
+		var end int64
+		for _, f := range fields {
+			if f.Offset > end {
+				ls = append(ls, fmt.Sprintf("MemoryLayout.paddingLayout(%d)", f.Offset-end))
+			}
+			ls = append(ls, fmt.Sprintf("%s.withName(%q)", f.Layout, f.Name))
+			end = f.Offset + panamaSize(f.Layout)
+		}
+		if size > end {
+			ls = append(ls, fmt.Sprintf("MemoryLayout.paddingLayout(%d)", size-end))
+		}
+		fmt.Fprintf(b, "\n    /** The C layout of {@code %s}. */\n", s.Name)
+		fmt.Fprintf(b, "    public static final MemoryLayout %s_LAYOUT = MemoryLayout.structLayout(\n            %s).withName(%q);\n", s.Name, strings.Join(ls, ",\n            "), s.Name)
+	}
+
+	for _, cb := range m.Callbacks {
+		var ls []string
+		jt := []string{j.name[cb] + ".class", "AtomicReference.class"}
+		for _, p := range cb.Params {
+			switch p.Kind {
+			case valString:
+				ls = append(ls, "ADDRESS")
+				jt = append(jt, "MemorySegment.class")
+			case valBytes:
+				ls = append(ls, "ADDRESS", "JAVA_LONG")
+				jt = append(jt, "MemorySegment.class", "long.class")
+			default:
+				ls = append(ls, panamaLayouts[p.C])
+				jt = append(jt, javaTypes[p.C]+".class")
+			}
+		}
+		ls = append(ls, "ADDRESS")
+		jt = append(jt, "MemorySegment.class")
+		desc := "FunctionDescriptor.ofVoid(" + strings.Join(ls, ", ") + ")"
+		ret := "void.class"
+		if cb.Ret != "" {
+			desc = "FunctionDescriptor.of(" + strings.Join(append([]string{panamaLayouts[cb.Ret]}, ls...), ", ") + ")"
+			ret = javaTypes[cb.Ret] + ".class"
+		}
+		fmt.Fprintf(b, "\n    private static final FunctionDescriptor %s_DESC = %s;\n", cb.Type, desc)
+		fmt.Fprintf(b, "    private static final MethodHandle %s_TARGET = target(%q, MethodType.methodType(%s, %s));\n", cb.Type, cb.Type, ret, strings.Join(jt, ", "))
+	}
+
+	b.WriteString("\n    /** Returns the last error recorded on the calling thread as JSON ({} if none). */\n")
+	b.WriteString("    public static String lastErrorJson() {\n")
+	b.WriteString("        MemorySegment p = (MemorySegment) invoke(capi_last_error_json);\n")
+	b.WriteString("        return p.address() == 0 ? \"{}\" : takeString(p);\n")
+	b.WriteString("    }\n\n")
+	b.WriteString("    public static void clearLastError() {\n        invoke(capi_clear_last_error);\n    }\n\n")
+	b.WriteString("    /** Configures a registered reporter, e.g., \"jsonl\" or \"sentry\". */\n")
+	b.WriteString("    public static void reporterConfigure(String name, String configJson) throws ForgecException {\n")
+	b.WriteString("        try (Arena arena = Arena.ofConfined()) {\n")
+	b.WriteString("            check(capi_reporter_configure, cstring(arena, name), cstring(arena, configJson));\n")
+	b.WriteString("        }\n")
+	b.WriteString("    }\n\n")
+	b.WriteString("    /** Waits up to timeoutMs for reporters to deliver queued reports. */\n")
+	b.WriteString("    public static boolean flush(int timeoutMs) {\n")
+	b.WriteString("        return (boolean) invoke(capi_flush, timeoutMs);\n")
+	b.WriteString("    }\n")
+
+	for _, h := range m.Handles {
+		name := j.name[h]
+		fmt.Fprintf(b, "\n    /** {@code %s}: an opaque reference to a Go object, released by {@link #close}. */\n", h.Type)
+		fmt.Fprintf(b, "    public static final class %s implements AutoCloseable {\n", name)
+		b.WriteString("        private long handle;\n\n")
+		fmt.Fprintf(b, "        public %s(long handle) {\n            this.handle = handle;\n        }\n\n", name)
+		b.WriteString("        public long handle() {\n            return handle;\n        }\n\n")
+		b.WriteString("        @Override\n")
+		b.WriteString("        public void close() throws ForgecException {\n")
+		b.WriteString("            if (handle == 0) {\n                return;\n            }\n")
+		b.WriteString("            long h = handle;\n")
+		b.WriteString("            handle = 0;\n")
+		fmt.Fprintf(b, "            check(%s, h);\n", h.Release)
+		b.WriteString("        }\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writePanamaFunc(b, j, f, "        ")
+		}
+		b.WriteString("    }\n")
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			b.WriteString("\n")
+			writePanamaFunc(b, j, f, "    ")
+		}
+	}
+
+	for _, cb := range m.Callbacks {
+		var ps, args []string
+		ps = append(ps, j.name[cb]+" fn", "AtomicReference<Throwable> thrown")
+		for _, p := range cb.Params {
+			n := javaIdent(p.Name)
+			switch p.Kind {
+			case valString:
+				ps = append(ps, "MemorySegment "+n)
+				args = append(args, "string("+n+")")
+			case valBytes:
+				ps = append(ps, "MemorySegment "+n, "long "+n+"_len")
+				args = append(args, "bytes("+n+", "+n+"_len)")
+			default:
+				ps = append(ps, javaTypes[p.C]+" "+n)
+				args = append(args, n)
+			}
+		}
+		ps = append(ps, "MemorySegment user_data")
+		ret, call, zero := "void", "", "return;"
+		if cb.Ret != "" {
+			ret, call, zero = javaTypes[cb.Ret], "return ", "return 0;"
+			if ret == "boolean" {
+				zero = "return false;"
+			}
+		}
+		fmt.Fprintf(b, "\n    // %s adapts a %s to the C callback; user_data is unused. An exception\n", cb.Type, j.name[cb])
+		b.WriteString("    // must not unwind into C (the JVM would exit): it is kept in thrown, rethrown by check once\n")
+		b.WriteString("    // the export returns, and the callback returns zero.\n")
+		fmt.Fprintf(b, "    private static %s %s(%s) {\n", ret, cb.Type, strings.Join(ps, ", "))
+		b.WriteString("        try {\n")
+		fmt.Fprintf(b, "            %sfn.call(%s);\n", call, strings.Join(args, ", "))
+		b.WriteString("        } catch (Throwable t) {\n")
+		b.WriteString("            thrown.compareAndSet(null, t);\n")
+		fmt.Fprintf(b, "            %s\n", zero)
+		b.WriteString("        }\n")
+		b.WriteString("    }\n")
+	}
+
+	b.WriteString(`
+    private static MethodHandle target(String name, MethodType type) {
+        try {
+            return MethodHandles.lookup().findStatic(` + j.panama + `.class, name, type);
+        } catch (ReflectiveOperationException e) {
+            throw new ExceptionInInitializerError(e);
+        }
+    }
+
+    private static Object invoke(MethodHandle h, Object... args) {
+        try {
+            return h.invokeWithArguments(args);
+        } catch (RuntimeException | Error e) {
+            throw e;
+        } catch (Throwable t) {
+            throw new IllegalStateException(t);
+        }
+    }
+
+    static void check(MethodHandle h, Object... args) throws ForgecException {
+        int status = (int) invoke(h, args);
+        if (status != 0) {
+            throw new ForgecException(status, lastErrorJson());
+        }
+    }
+
+    // check for exports taking callbacks: the first exception thrown by a callback during the
+    // call is rethrown in place of the status.
+    static void check(AtomicReference<Throwable> thrown, MethodHandle h, Object... args) throws ForgecException {
+        int status = (int) invoke(h, args);
+        Throwable t = thrown.get();
+        if (t instanceof RuntimeException e) {
+            throw e;
+        } else if (t instanceof Error e) {
+            throw e;
+        } else if (t != null) {
+            throw new IllegalStateException(t);
+        }
+        if (status != 0) {
+            throw new ForgecException(status, lastErrorJson());
+        }
+    }
+
+    // cstring copies s into arena as NUL-terminated UTF-8; null is NULL (read as "" by Go).
+    static MemorySegment cstring(Arena arena, String s) {
+        return s == null ? MemorySegment.NULL : arena.allocateFrom(s);
+    }
+
+    static MemorySegment buffer(Arena arena, byte[] b) {
+        return b == null || b.length == 0 ? MemorySegment.NULL : arena.allocateFrom(JAVA_BYTE, b);
+    }
+
+    static String string(MemorySegment p) {
+        return p.address() == 0 ? null : p.reinterpret(Long.MAX_VALUE).getString(0);
+    }
+
+    static byte[] bytes(MemorySegment p, long n) {
+        return p.address() == 0 || n == 0 ? new byte[0] : p.reinterpret(n).toArray(JAVA_BYTE);
+    }
+
+    static String takeString(MemorySegment p) {
+        if (p.address() == 0) {
+            return "";
+        }
+        try {
+            return string(p);
+        } finally {
+            invoke(capi_free, p);
+        }
+    }
+
+    static byte[] takeBytes(MemorySegment p, long n) {
+        try {
+            return bytes(p, n);
+        } finally {
+            if (p.address() != 0) {
+                invoke(capi_free, p);
+            }
+        }
+    }
+`)
+	for _, s := range m.Structs {
+		name := j.name[s]
+		fields, _ := panamaStruct(s)
+		fmt.Fprintf(b, "\n    static MemorySegment toNative(Arena arena, %s v) {\n", name)
+		b.WriteString("        if (v == null) {\n            return MemorySegment.NULL;\n        }\n")
+		fmt.Fprintf(b, "        MemorySegment n = arena.allocate(%s_LAYOUT);\n", s.Name)
+		for _, f := range fields {
+			fn := javaIdent(camelName(f.Name))
+			if f.String {
+				fmt.Fprintf(b, "        n.set(ADDRESS, %d, cstring(arena, v.%s));\n", f.Offset, fn)
+			} else {
+				fmt.Fprintf(b, "        n.set(%s, %d, v.%s);\n", f.Layout, f.Offset, fn)
+			}
+		}
+		b.WriteString("        return n;\n    }\n")
+		b.WriteString("\n    // take copies a struct returned by the library and releases its strings.\n")
+		fmt.Fprintf(b, "    static %s take%s(MemorySegment n) {\n", name, name)
+		fmt.Fprintf(b, "        %s v = new %s();\n", name, name)
+		for _, f := range fields {
+			fn := javaIdent(camelName(f.Name))
+			if f.String {
+				fmt.Fprintf(b, "        v.%s = string(n.get(ADDRESS, %d));\n", fn, f.Offset)
+			} else {
+				fmt.Fprintf(b, "        v.%s = n.get(%s, %d);\n", fn, f.Layout, f.Offset)
+			}
+		}
+		fmt.Fprintf(b, "        invoke(%s, n);\n", s.Free)
+		b.WriteString("        return v;\n    }\n")
+	}
+	b.WriteString("}\n")
+}
+
+func writePanamaFunc(b *bytes.Buffer, j *javaNames, f *cFunc, indent string) {
+	in := indent + "    "
+	body := in + "    "
+	// the arena holds the arguments, upcall stubs and out-params for the duration of the call
+	arena := f.Result != nil
+	var args, pre []string
+	check := []string{f.Symbol}
+	for i, p := range f.Params {
+		if p.Kind == valString || p.Kind == valBytes || p.Kind == valStruct || p.Kind == valCallback {
+			arena = true
+		}
+		if p.Kind == valCallback && len(check) == 1 {
+			pre = append(pre, "AtomicReference<Throwable> thrown = new AtomicReference<>();")
+			check = []string{"thrown", f.Symbol}
+		}
+		if i == 0 && f.Recv != nil {
+			args = append(args, "handle")
+			continue
+		}
+		n := javaIdent(camelName(p.Name))
+		switch p.Kind {
+		case valHandle:
+			args = append(args, "("+n+" == null ? 0L : "+n+".handle())")
+		case valString:
+			args = append(args, "cstring(arena, "+n+")")
+		case valBytes:
+			args = append(args, "buffer(arena, "+n+")", "(long) ("+n+" == null ? 0 : "+n+".length)")
+		case valStruct:
+			args = append(args, "toNative(arena, "+n+")")
+		case valCallback:
+			args = append(args, fmt.Sprintf("%s == null ? MemorySegment.NULL : LINKER.upcallStub(MethodHandles.insertArguments(%s_TARGET, 0, %s, thrown), %s_DESC, arena)", n, p.C, n, p.C), "MemorySegment.NULL")
+		default:
+			args = append(args, n)
+		}
+	}
+	r := f.Result
+	var ret string
+	if r != nil {
+		switch r.Kind {
+		case valStruct:
+			pre = append(pre, fmt.Sprintf("MemorySegment out = arena.allocate(%s_LAYOUT);", r.Struct.Name))
+			ret = "take" + j.name[r.Struct] + "(out)"
+		case valString:
+			pre = append(pre, "MemorySegment out = arena.allocate(ADDRESS);")
+			ret = "takeString(out.get(ADDRESS, 0))"
+		case valBytes:
+			pre = append(pre, "MemorySegment out = arena.allocate(ADDRESS);", "MemorySegment outLen = arena.allocate(JAVA_LONG);")
+			ret = "takeBytes(out.get(ADDRESS, 0), outLen.get(JAVA_LONG, 0))"
+		case valHandle:
+			pre = append(pre, "MemorySegment out = arena.allocate(JAVA_LONG);")
+			ret = fmt.Sprintf("out.get(JAVA_LONG, 0) == 0 ? null : new %s(out.get(JAVA_LONG, 0))", j.name[r.Handle])
+		default:
+			l := panamaValueLayout(*r)
+			pre = append(pre, fmt.Sprintf("MemorySegment out = arena.allocate(%s);", l))
+			ret = fmt.Sprintf("out.get(%s, 0)", l)
+		}
+		args = append(args, "out")
+		if r.Kind == valBytes {
+			args = append(args, "outLen")
+		}
+	}
+	writeJavaDoc(b, f, indent)
+	fmt.Fprintf(b, "%s%s {\n", indent, j.javaSignature(f, f.Recv == nil))
+	if arena {
+		fmt.Fprintf(b, "%stry (Arena arena = Arena.ofConfined()) {\n", in)
+	} else {
+		body = in
+	}
+	for _, s := range pre {
+		fmt.Fprintf(b, "%s%s\n", body, s)
+	}
+	fmt.Fprintf(b, "%scheck(%s);\n", body, strings.Join(append(check, args...), ", "))
+	if r != nil {
+		fmt.Fprintf(b, "%sreturn %s;\n", body, ret)
+	}
+	if arena {
+		fmt.Fprintf(b, "%s}\n", in)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
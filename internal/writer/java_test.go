@@ -0,0 +1,72 @@
+package writer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// javacVersion returns the feature version of javac -version ("javac 22.0.1" -> 22).
+func javacVersion(t *testing.T, javac string) int {
+	t.Helper()
+	out, err := exec.Command(javac, "-version").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	v := strings.TrimPrefix(strings.TrimSpace(string(out)), "javac ")
+	major, _, _ := strings.Cut(v, ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		t.Fatalf("javac -version: %s", out)
+	}
+	return n
+}
+
+// TestWriteJavaCompiles compiles the Panama bindings and the types they share with the JNA
+// ones; the JNA bindings are compiled too when JNA_JAR points to the JNA 5 jar.
+func TestWriteJavaCompiles(t *testing.T) {
+	javac, err := exec.LookPath("javac")
+	if err != nil {
+		t.Skip("no javac")
+	}
+	if v := javacVersion(t, javac); v < 22 {
+		t.Skipf("javac %d: java.lang.foreign needs Java 22", v)
+	}
+	jna := os.Getenv("JNA_JAR")
+	tests := []struct {
+		name string
+		apis func(*testing.T) []*scanner.API
+	}{
+		{"sample", scanSample},
+		{"members", func(*testing.T) []*scanner.API { return memberAPI() }},
+		{"helpers", func(*testing.T) []*scanner.API { return helperAPI() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := generate(t, "java", tt.apis(t))
+			srcs, err := filepath.Glob(filepath.Join(dir, "sample", "*.java"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := []string{"-d", filepath.Join(dir, "classes")}
+			if jna != "" {
+				args = append(args, "-cp", jna)
+			}
+			for _, src := range srcs {
+				if jna == "" && strings.HasSuffix(src, "Jna.java") {
+					continue
+				}
+				args = append(args, src)
+			}
+			out, err := exec.Command(javac, args...).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
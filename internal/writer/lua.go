@@ -0,0 +1,552 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WriteLua writes LuaJIT bindings of the scanned packages to path: a module declaring forgec.h
+// with ffi.cdef and wrapping every export as a function that returns the out-param and raises
+// a ForgecError on a non-OK status. libName is the base name of the shared library built by
+// the build scripts.
+func WriteLua(path, libName, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	l := newLuaNames(m)
+	if err := l.check(); err != nil {
+		return err
+	}
+	header, err := renderHeader(cPrefix, apis, nil)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	writeLuaModule(&b, m, l, libName, luaCdef(header))
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+var forgecDeprecated = regexp.MustCompile(`(?m)^FORGEC_DEPRECATED\("(?:[^"\\]|\\.)*"\) `)
+
+// luaCdef turns forgec.h into the declarations ffi.cdef accepts: the text of the header without
+// its preprocessor lines, the C++ linkage block and the FORGEC_DEPRECATED markers.
+func luaCdef(header []byte) string {
+	var b strings.Builder
+	blank, skip := true, false
+	for _, line := range strings.Split(string(header), "\n") {
+		switch {
+		case line == "#ifdef __cplusplus":
+			skip = true
+			continue
+		case skip && line == "#endif":
+			skip = false
+			continue
+		case skip || strings.HasPrefix(line, "#"):
+			continue
+		}
+		// the removed lines leave runs of blank lines behind
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		b.WriteString(line + "\n")
+	}
+	return strings.TrimSpace(forgecDeprecated.ReplaceAllString(b.String(), "")) + "\n"
+}
+
+// luaNames spells the model in Lua: snake_case functions and methods, PascalCase enum and
+// handle tables; enum values and struct fields keep their C names.
+type luaNames struct {
+	m    *cModel
+	name map[any]string // *cEnum, *cHandle -> name
+}
+
+func newLuaNames(m *cModel) *luaNames {
+	l := &luaNames{m: m, name: map[any]string{m.Status: "Status"}}
+	for _, e := range m.Enums {
+		l.name[e] = pascalName(e.Name)
+	}
+	for _, h := range m.Handles {
+		l.name[h] = pascalName(h.Name)
+	}
+	return l
+}
+
+// check reports fields of the module or of a handle class declared twice.
+func (l *luaNames) check() error {
+	names := newNameSet("lua", false)
+	names.reserve("", "forgec", "C", "ForgecError")
+	names.reserve("", "forgec", luaHelpers...)
+	for k, name := range l.name {
+		by := ""
+		switch v := k.(type) {
+		case *cEnum:
+			by = v.Type
+		case *cHandle:
+			by = v.Type
+			names.reserve(name+".", v.Type, luaHandleMembers...)
+		}
+		if err := names.declare("", name, by); err != nil {
+			return err
+		}
+	}
+	for _, f := range l.m.Funcs {
+		scope := ""
+		if f.Recv != nil {
+			scope = l.name[f.Recv] + "."
+		}
+		if err := names.declare(scope, l.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// luaHelpers are the functions of the module table; functions of the same name are escaped.
+var luaHelpers = []string{"last_error_json", "clear_last_error", "reporter_configure", "flush"}
+
+// luaHandleMembers are declared by every handle class; methods of the same name are escaped.
+var luaHandleMembers = []string{"new", "release", "handle"}
+
+func (l *luaNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(luaIdent(snakeName(f.Method)), luaHandleMembers)
+	}
+	return memberName(luaIdent(snakeName(f.Name)), luaHelpers)
+}
+
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true, "false": true,
+	"for": true, "function": true, "goto": true, "if": true, "in": true, "local": true, "nil": true,
+	"not": true, "or": true, "repeat": true, "return": true, "then": true, "true": true, "until": true,
+	"while": true,
+}
+
+// luaIdent escapes Lua keywords with a trailing underscore.
+func luaIdent(name string) string {
+	if luaKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// luaLongString quotes s as a long bracket string of a level that does not occur in s.
+func luaLongString(s string) string {
+	eq := ""
+	for strings.Contains(s, "]"+eq+"]") {
+		eq += "="
+	}
+	return "[" + eq + "[\n" + s + "]" + eq + "]"
+}
+
+func writeLuaModule(b *bytes.Buffer, m *cModel, l *luaNames, libName, cdef string) {
+	envVar := pyEnvName(libName) + "_LIBRARY"
+	b.WriteString("-- Code generated by forgec. DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "--- LuaJIT FFI bindings of the %s library.\n", libName)
+	b.WriteString("--\n")
+	b.WriteString("-- The cdef is forgec.h without its preprocessor lines; M.C calls the exports directly.\n")
+	b.WriteString("-- The wrappers return the out-param and raise a ForgecError (status, func, message,\n")
+	b.WriteString("-- type, json and the decoded record) on a non-OK status. Returned strings and buffers\n")
+	b.WriteString("-- are Lua strings; 64-bit integers and handles are int64_t/uint64_t cdata.\n")
+	b.WriteString("local ffi = require(\"ffi\")\n\n")
+	fmt.Fprintf(b, "ffi.cdef%s\n\n", luaLongString(cdef))
+	b.WriteString("local M = {}\n\n")
+	fmt.Fprintf(b, "-- $%s, or %s from the system search path (lib%s.so, lib%s.dylib, %s.dll).\n", envVar, libName, libName, libName, libName)
+	fmt.Fprintf(b, "local path = os.getenv(%q)\n", envVar)
+	fmt.Fprintf(b, "local C = ffi.load(path and path ~= \"\" and path or %q)\n", libName)
+	b.WriteString("M.C = C\n\n")
+
+	writeLuaConstants(b, "Status", "Status codes returned by the exports; custom codes start at 100.", m.Status)
+	for _, e := range m.Enums {
+		writeLuaConstants(b, l.name[e], e.Type+" values.", e)
+	}
+
+	b.WriteString(luaRuntime)
+
+	for _, s := range m.Structs {
+		var fs []string
+		for _, f := range s.Fields {
+			v := "s." + f.Name
+			if f.String {
+				v = "str(" + v + ")"
+			}
+			fs = append(fs, f.Name+" = "+v)
+		}
+		fmt.Fprintf(b, "\n-- take_%s copies a %s returned by the library and releases its strings.\n", s.Name, s.Name)
+		fmt.Fprintf(b, "local function take_%s(p)\n", s.Name)
+		b.WriteString("  local s = p[0]\n")
+		fmt.Fprintf(b, "  local v = { %s }\n", strings.Join(fs, ", "))
+		fmt.Fprintf(b, "  C.%s(p)\n", s.Free)
+		b.WriteString("  return v\nend\n")
+	}
+
+	for _, h := range m.Handles {
+		name := l.name[h]
+		fmt.Fprintf(b, "\n--- %s: an opaque reference to a Go object, released by release().\n", h.Type)
+		fmt.Fprintf(b, "local %s = {}\n", name)
+		fmt.Fprintf(b, "%s.__index = %s\n", name, name)
+		fmt.Fprintf(b, "M.%s = %s\n\n", name, name)
+		fmt.Fprintf(b, "function %s.new(handle)\n", name)
+		fmt.Fprintf(b, "  return setmetatable({ handle = handle }, %s)\n", name)
+		b.WriteString("end\n\n")
+		fmt.Fprintf(b, "function %s:release()\n", name)
+		b.WriteString("  if self.handle == 0 then\n    return\n  end\n")
+		b.WriteString("  local h = self.handle\n")
+		b.WriteString("  self.handle = 0\n")
+		fmt.Fprintf(b, "  check(C.%s(h))\n", h.Release)
+		b.WriteString("end\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writeLuaFunc(b, l, f)
+		}
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			b.WriteString("\n")
+			writeLuaFunc(b, l, f)
+		}
+	}
+	b.WriteString("\nreturn M\n")
+}
+
+// writeLuaConstants writes a C enum as a table of its values, by their C names.
+func writeLuaConstants(b *bytes.Buffer, name, doc string, e *cEnum) {
+	fmt.Fprintf(b, "--- %s\n", doc)
+	fmt.Fprintf(b, "M.%s = {\n", name)
+	for _, v := range e.Values {
+		key := v.Name
+		if luaKeywords[key] {
+			key = fmt.Sprintf("[%q]", key)
+		}
+		fmt.Fprintf(b, "  %s = %d,\n", key, v.Value)
+	}
+	b.WriteString("}\n\n")
+}
+
+// luaRuntime holds the error type and the helpers the wrappers share.
+const luaRuntime = `-- decode_json decodes the JSON of an error record; null is nil.
+local decode_json
+do
+  local escapes = { ['"'] = '"', ["\\"] = "\\", ["/"] = "/", b = "\b", f = "\f", n = "\n", r = "\r", t = "\t" }
+
+  local function utf8(cp)
+    if cp < 0x80 then
+      return string.char(cp)
+    elseif cp < 0x800 then
+      return string.char(0xC0 + math.floor(cp / 0x40), 0x80 + cp % 0x40)
+    elseif cp < 0x10000 then
+      return string.char(0xE0 + math.floor(cp / 0x1000), 0x80 + math.floor(cp / 0x40) % 0x40, 0x80 + cp % 0x40)
+    end
+    return string.char(0xF0 + math.floor(cp / 0x40000), 0x80 + math.floor(cp / 0x1000) % 0x40,
+      0x80 + math.floor(cp / 0x40) % 0x40, 0x80 + cp % 0x40)
+  end
+
+  local function skip(s, i)
+    return s:find("[^ \t\r\n]", i) or #s + 1
+  end
+
+  local function str(s, i)
+    local out = {}
+    i = i + 1
+    while true do
+      local c = s:sub(i, i)
+      if c == '"' then
+        return table.concat(out), i + 1
+      elseif c == "\\" then
+        local e = s:sub(i + 1, i + 1)
+        if e == "u" then
+          local cp = tonumber(s:sub(i + 2, i + 5), 16) or error("bad escape")
+          i = i + 6
+          if cp >= 0xD800 and cp < 0xDC00 and s:sub(i, i + 1) == "\\u" then
+            local lo = tonumber(s:sub(i + 2, i + 5), 16) or error("bad escape")
+            cp = 0x10000 + (cp - 0xD800) * 0x400 + (lo - 0xDC00)
+            i = i + 6
+          end
+          out[#out + 1] = utf8(cp)
+        else
+          out[#out + 1] = escapes[e] or error("bad escape")
+          i = i + 2
+        end
+      elseif c == "" then
+        error("unterminated string")
+      else
+        local j = s:find('["\\]', i) or #s + 1
+        out[#out + 1] = s:sub(i, j - 1)
+        i = j
+      end
+    end
+  end
+
+  local value
+
+  local function list(s, i, close, item)
+    i = skip(s, i + 1)
+    if s:sub(i, i) == close then
+      return i + 1
+    end
+    while true do
+      i = skip(s, item(i))
+      local c = s:sub(i, i)
+      if c == close then
+        return i + 1
+      elseif c ~= "," then
+        error("expected , or " .. close)
+      end
+      i = skip(s, i + 1)
+    end
+  end
+
+  function value(s, i)
+    i = skip(s, i)
+    local c = s:sub(i, i)
+    if c == "{" then
+      local t = {}
+      return t, list(s, i, "}", function(j)
+        if s:sub(j, j) ~= '"' then
+          error("expected key")
+        end
+        local k
+        k, j = str(s, j)
+        j = skip(s, j)
+        if s:sub(j, j) ~= ":" then
+          error("expected :")
+        end
+        t[k], j = value(s, j + 1)
+        return j
+      end)
+    elseif c == "[" then
+      local t = {}
+      return t, list(s, i, "]", function(j)
+        t[#t + 1], j = value(s, j)
+        return j
+      end)
+    elseif c == '"' then
+      return str(s, i)
+    elseif s:sub(i, i + 3) == "true" then
+      return true, i + 4
+    elseif s:sub(i, i + 4) == "false" then
+      return false, i + 5
+    elseif s:sub(i, i + 3) == "null" then
+      return nil, i + 4
+    end
+    local n = s:match("^-?%d+%.?%d*[eE]?[-+]?%d*", i)
+    if not n then
+      error("unexpected " .. c)
+    end
+    return tonumber(n), i + #n
+  end
+
+  function decode_json(s)
+    return (value(s, 1))
+  end
+end
+
+local function status_name(status)
+  for name, v in pairs(M.Status) do
+    if v == status then
+      return name
+    end
+  end
+  return tostring(status)
+end
+
+--- ForgecError is raised when an export returns a non-OK status.
+local ForgecError = {}
+ForgecError.__index = ForgecError
+ForgecError.__tostring = function(e)
+  return string.format("%s: %s (%s)", e.func, e.message, status_name(e.status))
+end
+M.ForgecError = ForgecError
+
+local function str(p)
+  if p == nil then
+    return ""
+  end
+  return ffi.string(p)
+end
+
+local function take_string(p)
+  if p == nil then
+    return ""
+  end
+  local s = ffi.string(p)
+  C.capi_free(p)
+  return s
+end
+
+local function take_bytes(p, n)
+  if p == nil then
+    return ""
+  end
+  local s = ffi.string(p, n)
+  C.capi_free(p)
+  return s
+end
+
+--- Returns the last error recorded on the calling thread as JSON ("{}" if none).
+function M.last_error_json()
+  local p = C.capi_last_error_json()
+  if p == nil then
+    return "{}"
+  end
+  local s = ffi.string(p)
+  C.capi_free(ffi.cast("void*", p))
+  return s
+end
+
+function M.clear_last_error()
+  C.capi_clear_last_error()
+end
+
+local function check(status)
+  if status == 0 then
+    return
+  end
+  local json = M.last_error_json()
+  local ok, record = pcall(decode_json, json)
+  if not ok or type(record) ~= "table" then
+    record = {}
+  end
+  error(setmetatable({
+    status = status,
+    func = record["function"] or "",
+    message = record.error or "",
+    type = record.type or "",
+    json = json,
+    record = record,
+  }, ForgecError), 0)
+end
+
+--- Configures a registered reporter, e.g., "jsonl" or "sentry".
+function M.reporter_configure(name, config)
+  check(C.capi_reporter_configure(name, config))
+end
+
+--- Waits up to timeout_ms for reporters to deliver queued reports.
+function M.flush(timeout_ms)
+  return C.capi_flush(timeout_ms)
+end
+
+local warned = {}
+
+-- deprecated writes the deprecation message of an export to stderr, once.
+local function deprecated(name, message)
+  if not warned[name] then
+    warned[name] = true
+    io.stderr:write(string.format("%s is deprecated: %s\n", name, message))
+  end
+end
+`
+
+func writeLuaFunc(b *bytes.Buffer, l *luaNames, f *cFunc) {
+	var ps, args, pre, callbacks []string
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "self.handle")
+			continue
+		}
+		n := luaIdent(snakeName(p.Name))
+		ps = append(ps, n)
+		switch p.Kind {
+		case valHandle:
+			args = append(args, n+" and "+n+".handle or 0")
+		case valBytes:
+			args = append(args, fmt.Sprintf("ffi.cast(\"const uint8_t*\", %s)", n), n+" and #"+n+" or 0")
+		case valStruct:
+			args = append(args, fmt.Sprintf("ffi.new(%q, %s or {})", p.C, n))
+		case valCallback:
+			cb := n + "_cb"
+			callbacks = append(callbacks, cb)
+			pre = append(pre, fmt.Sprintf("local %s = %s and ffi.cast(%q, %s)", cb, n, p.C, luaCallback(p.Callback, n)))
+			args = append(args, cb, "nil")
+		default:
+			args = append(args, n)
+		}
+	}
+	r := f.Result
+	var result string
+	if r != nil {
+		switch r.Kind {
+		case valString:
+			pre = append(pre, `local out = ffi.new("char*[1]")`)
+			result = "take_string(out[0])"
+		case valBytes:
+			pre = append(pre, `local out = ffi.new("uint8_t*[1]")`, `local out_len = ffi.new("size_t[1]")`)
+			result = "take_bytes(out[0], out_len[0])"
+		case valStruct:
+			pre = append(pre, fmt.Sprintf("local out = ffi.new(%q)", r.C+"[1]"))
+			result = "take_" + r.C + "(out)"
+		case valHandle:
+			pre = append(pre, fmt.Sprintf("local out = ffi.new(%q)", r.C+"[1]"))
+			result = l.name[r.Handle] + ".new(out[0])"
+		default:
+			pre = append(pre, fmt.Sprintf("local out = ffi.new(%q)", r.C+"[1]"))
+			result = "out[0]"
+		}
+		args = append(args, "out")
+		if r.Kind == valBytes {
+			args = append(args, "out_len")
+		}
+	}
+	fmt.Fprintf(b, "--- %s\n", strings.TrimSuffix(f.cPrototype(), ";"))
+	if f.Recv != nil {
+		fmt.Fprintf(b, "function %s:%s(%s)\n", l.name[f.Recv], l.funcName(f), strings.Join(ps, ", "))
+	} else {
+		fmt.Fprintf(b, "function M.%s(%s)\n", l.funcName(f), strings.Join(ps, ", "))
+	}
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "  deprecated(%q, %q)\n", f.Symbol, f.Deprecated)
+	}
+	for _, s := range pre {
+		fmt.Fprintf(b, "  %s\n", s)
+	}
+	call := fmt.Sprintf("C.%s(%s)", f.Symbol, strings.Join(args, ", "))
+	if len(callbacks) == 0 {
+		fmt.Fprintf(b, "  check(%s)\n", call)
+	} else {
+		// the callbacks are freed before the error, if any, is raised
+		fmt.Fprintf(b, "  local status = %s\n", call)
+		for _, cb := range callbacks {
+			fmt.Fprintf(b, "  if %s then\n    %s:free()\n  end\n", cb, cb)
+		}
+		b.WriteString("  check(status)\n")
+	}
+	if result != "" {
+		fmt.Fprintf(b, "  return %s\n", result)
+	}
+	b.WriteString("end\n")
+}
+
+// luaCallback renders the Lua function adapting the C arguments of a callback for fn.
+func luaCallback(cb *cCallback, fn string) string {
+	var ps, args []string
+	for _, p := range cb.Params {
+		n := luaIdent(p.Name)
+		switch p.Kind {
+		case valString:
+			ps = append(ps, n)
+			args = append(args, "str("+n+")")
+		case valBytes:
+			ps = append(ps, n, n+"_len")
+			args = append(args, "ffi.string("+n+", "+n+"_len)")
+		default:
+			ps = append(ps, n)
+			args = append(args, n)
+		}
+	}
+	ps = append(ps, "user_data")
+	return fmt.Sprintf("function(%s) return %s(%s) end", strings.Join(ps, ", "), fn, strings.Join(args, ", "))
+}
@@ -0,0 +1,35 @@
+package writer
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+func TestWriteLuaLoads(t *testing.T) {
+	luajit, err := exec.LookPath("luajit")
+	if err != nil {
+		t.Skip("no luajit")
+	}
+	tests := []struct {
+		name string
+		apis func(*testing.T) []*scanner.API
+	}{
+		{"sample", scanSample},
+		{"members", func(*testing.T) []*scanner.API { return memberAPI() }},
+		{"helpers", func(*testing.T) []*scanner.API { return helperAPI() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := generate(t, "lua", tt.apis(t))
+			// ffi.load is stubbed, so the module runs, and ffi.cdef parses the header, without the library.
+			stub := `require("ffi").load = function() return {} end`
+			out, err := exec.Command(luajit, "-e", stub, filepath.Join(dir, "sample.lua")).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
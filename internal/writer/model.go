@@ -0,0 +1,352 @@
+package writer
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// The binding model is the C API of forgec.h as language bindings see it. It is built from the
+// same units as the header, whose prototypes are rendered from it too, so the header and the
+// bindings cannot disagree.
+
+// valueKind classifies how a param or result crosses the C boundary.
+type valueKind int
+
+const (
+	valScalar   valueKind = iota // C scalar by value, T* out for results
+	valEnum                      // <prefix><Enum>, an int-sized C enum
+	valHandle                    // <prefix><Type>Handle, a uintptr_t
+	valString                    // const char* in, char** out released with capi_free
+	valBytes                     // const uint8_t* + size_t <name>_len in, uint8_t** out + size_t* out_len released with capi_free
+	valStruct                    // const S* in, caller-allocated S* out whose strings are released with <prefix><S>_free
+	valCallback                  // function pointer followed by void* <name>_user_data
+)
+
+// cValue is a param or result of an export, or a param of a callback.
+type cValue struct {
+	Name     string // C param name; "h" for method receivers, "out" for results
+	Kind     valueKind
+	C        string // scalar C type (int32_t), enum or handle typedef, struct name or callback typedef
+	Enum     *cEnum
+	Handle   *cHandle
+	Struct   *cStruct
+	Callback *cCallback
+}
+
+// cFunc is one export.
+type cFunc struct {
+	Symbol     string // C symbol, e.g., PM_Find
+	Name       string // binding name: the symbol without the -cprefix prefix, e.g., Find or AUD_Play
+	Recv       *cHandle
+	Method     string   // binding name of a handle method, e.g., Get for PM_Session_Get
+	Params     []cValue // the receiver handle "h" first for methods
+	Result     *cValue  // nil when the Go function only returns an error
+	Deprecated string
+}
+
+// cEnum is a C enum: the shared status enum or an exported Go enum.
+type cEnum struct {
+	Type   string // C typedef, e.g., PM_Mode
+	Name   string // binding name, e.g., Mode or AUD_Volume
+	Values []cEnumValue
+}
+
+type cEnumValue struct {
+	C     string // C enumerator, e.g., PM_Mode_Fast
+	Name  string // enumerator without the enum prefix, e.g., Fast
+	Value int64
+}
+
+// cHandle is an opaque handle type and the exports operating on it.
+type cHandle struct {
+	Type    string // C typedef, e.g., PM_SessionHandle
+	Name    string // binding name, e.g., Session or AUD_Player
+	Release string // C symbol of the release function
+	Methods []*cFunc
+}
+
+// cStruct is an exported C struct.
+type cStruct struct {
+	Name   string // C and binding name
+	Free   string // C symbol of the function releasing its strings
+	Fields []cField
+}
+
+type cField struct {
+	Name   string // C field name (Go name, or with a Unix/JSON suffix)
+	C      string // C type: a scalar type or const char*
+	String bool   // const char*: owned by the struct when returned
+}
+
+// cCallback is a callback typedef; Params are scalars, strings or buffers.
+type cCallback struct {
+	Type   string // C typedef, e.g., PM_Walk_visit_fn
+	Params []cValue
+	Ret    string // scalar C result type, empty for void
+}
+
+// cModel is the whole C API of one generated library.
+type cModel struct {
+	Prefix    string // -cprefix
+	Status    *cEnum
+	Enums     []*cEnum
+	Handles   []*cHandle
+	Structs   []*cStruct
+	Callbacks []*cCallback
+	Funcs     []*cFunc // in header order; methods are also listed on their handle
+}
+
+// newModel builds the binding model of the scanned packages.
+func newModel(cPrefix string, apis []*scanner.API) (*cModel, error) {
+	units, err := newUnits(cPrefix, apis)
+	if err != nil {
+		return nil, err
+	}
+	return buildModel(cPrefix, units)
+}
+
+func buildModel(cPrefix string, units []*unit) (*cModel, error) {
+	m := &cModel{Prefix: cPrefix}
+	bindingName := func(cName string) string { return strings.TrimPrefix(cName, cPrefix) }
+	newEnum := func(prefix string, e scanner.Enum) *cEnum {
+		ce := &cEnum{Type: prefix + e.Name, Name: bindingName(prefix + e.Name)}
+		for _, v := range e.Values {
+			ce.Values = append(ce.Values, cEnumValue{C: prefix + e.Name + "_" + v.CName, Name: v.CName, Value: v.Value})
+		}
+		return ce
+	}
+	m.Status = newEnum(cPrefix, statusEnum(units))
+	for _, u := range units {
+		enums := map[string]*cEnum{}
+		for _, e := range u.api.Enums {
+			enums[e.Name] = newEnum(u.prefix, e)
+			m.Enums = append(m.Enums, enums[e.Name])
+		}
+		handles := map[string]*cHandle{}
+		for _, h := range u.api.Handles {
+			handles[h.Name] = &cHandle{Type: u.prefix + h.Name + "Handle", Name: bindingName(u.prefix + h.Name), Release: u.prefix + h.Name + "_release"}
+			m.Handles = append(m.Handles, handles[h.Name])
+		}
+		structs := map[string]*cStruct{}
+		for _, s := range u.api.Structs {
+			cs := &cStruct{Name: s.Name, Free: u.prefix + s.Name + "_free"}
+			for _, f := range s.Fields {
+				cs.Fields = append(cs.Fields, cField{Name: f.ExportName, C: f.CType, String: f.CType == "const char*"})
+			}
+			structs[s.Name] = cs
+			m.Structs = append(m.Structs, cs)
+		}
+		// value resolves a param or result type, in the order the writers check them
+		value := func(f scanner.Func, name, goType string) (cValue, error) {
+			v := cValue{Name: name}
+			if e, ok := enums[goType]; ok {
+				v.Kind, v.C, v.Enum = valEnum, e.Type, e
+				return v, nil
+			}
+			if hn, ok := handleRef(u.isHandle, goType); ok {
+				v.Kind, v.C, v.Handle = valHandle, handles[hn].Type, handles[hn]
+				return v, nil
+			}
+			if st, _, ok := structRef(u.byName, goType); ok {
+				v.Kind, v.C, v.Struct = valStruct, st.Name, structs[st.Name]
+				return v, nil
+			}
+			ct, ok := scanner.LookupType(goType)
+			if !ok {
+				return v, fmt.Errorf("%s: unsupported type %s", f.Name, goType)
+			}
+			v.C = ct.C
+			switch ct.Kind {
+			case scanner.KindString:
+				v.Kind = valString
+			case scanner.KindBytes:
+				v.Kind = valBytes
+			default:
+				v.Kind = valScalar
+			}
+			return v, nil
+		}
+		for _, f := range u.api.Funcs {
+			cf := &cFunc{Symbol: funcSymbol(u.prefix, f), Deprecated: f.Deprecated}
+			cf.Name = bindingName(cf.Symbol)
+			if f.Recv != "" {
+				cf.Recv = handles[f.Recv]
+				cf.Method = strings.TrimPrefix(f.CName, f.Recv+"_")
+				cf.Params = append(cf.Params, cValue{Name: "h", Kind: valHandle, C: cf.Recv.Type, Handle: cf.Recv})
+				cf.Recv.Methods = append(cf.Recv.Methods, cf)
+			}
+			for i, pn := range f.Params {
+				if cb, ok := f.CallbackFor(pn); ok {
+					ccb := &cCallback{Type: callbackTypeName(u.prefix, f, cb)}
+					for j, cpn := range cb.Params {
+						v, err := value(f, cpn, cb.ParamTypes[j])
+						if err != nil {
+							return nil, err
+						}
+						ccb.Params = append(ccb.Params, v)
+					}
+					if ct, ok := scanner.LookupType(cb.RetType); ok {
+						ccb.Ret = ct.C
+					}
+					m.Callbacks = append(m.Callbacks, ccb)
+					cf.Params = append(cf.Params, cValue{Name: pn, Kind: valCallback, C: ccb.Type, Callback: ccb})
+					continue
+				}
+				v, err := value(f, pn, f.ParamTypes[i])
+				if err != nil {
+					return nil, err
+				}
+				cf.Params = append(cf.Params, v)
+			}
+			if f.HasValue {
+				v, err := value(f, "out", f.RetType)
+				if err != nil {
+					return nil, err
+				}
+				cf.Result = &v
+			}
+			m.Funcs = append(m.Funcs, cf)
+		}
+	}
+	return m, nil
+}
+
+// cParams renders the C parameter list of an export, including the result out-params.
+func (f *cFunc) cParams() []string {
+	var ps []string
+	for _, p := range f.Params {
+		switch p.Kind {
+		case valString:
+			ps = append(ps, fmt.Sprintf("const %s %s", p.C, p.Name))
+		case valBytes:
+			ps = append(ps, fmt.Sprintf("const %s %s", p.C, p.Name), fmt.Sprintf("size_t %s_len", p.Name))
+		case valStruct:
+			ps = append(ps, fmt.Sprintf("const %s* %s", p.C, p.Name))
+		case valCallback:
+			ps = append(ps, fmt.Sprintf("%s %s", p.C, p.Name), fmt.Sprintf("void* %s_user_data", p.Name))
+		default:
+			ps = append(ps, fmt.Sprintf("%s %s", p.C, p.Name))
+		}
+	}
+	if r := f.Result; r != nil {
+		ps = append(ps, fmt.Sprintf("%s* out", r.C))
+		if r.Kind == valBytes {
+			ps = append(ps, "size_t* out_len")
+		}
+	}
+	return ps
+}
+
+// cPrototype renders the C declaration of an export, e.g., `int32_t PM_Add(int32_t a, int32_t b, int32_t* out);`.
+func (f *cFunc) cPrototype() string {
+	var b strings.Builder
+	if f.Deprecated != "" {
+		fmt.Fprintf(&b, "FORGEC_DEPRECATED(%s) ", strconv.Quote(f.Deprecated))
+	}
+	ps := f.cParams()
+	if len(ps) == 0 {
+		ps = []string{"void"} // () leaves the params unspecified before C23
+	}
+	fmt.Fprintf(&b, "int32_t %s(%s);", f.Symbol, strings.Join(ps, ", "))
+	return b.String()
+}
+
+// nameSet records the names a binding declares, per scope ("" for the module, "Session." for the
+// members of a handle class, ...) and reports names declared twice. Names the generated code
+// declares itself are reserved for forgec.
+type nameSet struct {
+	lang  string            // language in errors, e.g., python
+	fold  bool              // names differing only in case collide, e.g., Java files on case-insensitive file systems
+	owner map[string]string // scope + name -> declaring C name
+}
+
+func newNameSet(lang string, fold bool) *nameSet {
+	return &nameSet{lang: lang, fold: fold, owner: map[string]string{}}
+}
+
+func (s *nameSet) key(scope, name string) string {
+	if s.fold {
+		return strings.ToLower(scope + name)
+	}
+	return scope + name
+}
+
+// reserve records names declared in scope by the generated code; by is forgec, or the C type
+// the generated members belong to.
+func (s *nameSet) reserve(scope, by string, names ...string) {
+	for _, n := range names {
+		s.owner[s.key(scope, n)] = by
+	}
+}
+
+// declare records name in scope, or reports that it is declared already.
+func (s *nameSet) declare(scope, name, by string) error {
+	k := s.key(scope, name)
+	if prev, ok := s.owner[k]; ok {
+		return fmt.Errorf("%s: duplicate name %s: declared by %s and %s", s.lang, name, prev, by)
+	}
+	s.owner[k] = by
+	return nil
+}
+
+// memberName escapes a handle method named like a member the generated handle class declares
+// itself with a trailing underscore, as keywords are, so the Go API needs no renaming. The C
+// symbol keeps its name.
+func memberName(name string, members []string) string {
+	if slices.Contains(members, name) {
+		return name + "_"
+	}
+	return name
+}
+
+// nameWords splits a Go or C identifier into words: AddInts, add_ints and ADD_INTS all give
+// add/ints; an upper-case run is one word (HTTPServer gives http/server).
+func nameWords(s string) []string {
+	var words []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '_' }) {
+		rs := []rune(part)
+		start := 0
+		for i := 1; i < len(rs); i++ {
+			lowerToUpper := unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1])
+			acronymEnd := i+1 < len(rs) && unicode.IsUpper(rs[i-1]) && unicode.IsLower(rs[i+1])
+			if unicode.IsUpper(rs[i]) && (lowerToUpper || acronymEnd) {
+				words = append(words, strings.ToLower(string(rs[start:i])))
+				start = i
+			}
+		}
+		words = append(words, strings.ToLower(string(rs[start:])))
+	}
+	return words
+}
+
+// snakeName spells an identifier as add_ints.
+func snakeName(s string) string {
+	return strings.Join(nameWords(s), "_")
+}
+
+// pascalName spells an identifier as AddInts.
+func pascalName(s string) string {
+	var b strings.Builder
+	for _, w := range nameWords(s) {
+		rs := []rune(w)
+		b.WriteString(strings.ToUpper(string(rs[:1])) + string(rs[1:]))
+	}
+	return b.String()
+}
+
+// camelName spells an identifier as addInts.
+func camelName(s string) string {
+	p := []rune(pascalName(s))
+	if len(p) == 0 {
+		return ""
+	}
+	// keep a leading acronym lower-cased as a whole: HTTPGet -> httpGet
+	words := nameWords(s)
+	n := len([]rune(words[0]))
+	return strings.ToLower(string(p[:n])) + string(p[n:])
+}
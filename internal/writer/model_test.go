@@ -0,0 +1,210 @@
+package writer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+func TestCPrototype(t *testing.T) {
+	m, err := newModel("PM_", scanSample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, f := range m.Funcs {
+		got[f.Symbol] = f.cPrototype()
+	}
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{"PM_Add", "int32_t PM_Add(int32_t a, int32_t b, int32_t* out);"},
+		{"PM_AddOld", `FORGEC_DEPRECATED("use Add") int32_t PM_AddOld(int32_t a, int32_t b, int32_t* out);`},
+		{"PM_Divide", "int32_t PM_Divide(int32_t a, int32_t b, int32_t* out);"},
+		{"PM_Echo", "int32_t PM_Echo(const uint8_t* data, size_t data_len, uint8_t** out, size_t* out_len);"},
+		{"PM_Greet", "int32_t PM_Greet(const User* u, char** out);"},
+		{"PM_Older", "int32_t PM_Older(const User* u, User* out);"},
+		{"PM_NewStore", "int32_t PM_NewStore(PM_StoreHandle* out);"},
+		{"PM_Store_Lookup", "int32_t PM_Store_Lookup(PM_StoreHandle h, const char* key, int64_t* out);"},
+		{"PM_Store_Put", "int32_t PM_Store_Put(PM_StoreHandle h, const char* key, int64_t v);"},
+		{"PM_SetMode", "int32_t PM_SetMode(PM_Mode m, PM_Mode* out);"},
+		{"PM_Scale", "int32_t PM_Scale(double x, bool neg, uint16_t n, double* out);"},
+		{"PM_Walk", "int32_t PM_Walk(int32_t n, PM_Walk_visit_fn visit, void* visit_user_data);"},
+		{"PM_Reset", "int32_t PM_Reset(void);"},
+	}
+	for _, tt := range tests {
+		if got[tt.symbol] != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.symbol, got[tt.symbol], tt.want)
+		}
+	}
+	if len(got) != len(tests) {
+		t.Errorf("got %d exports, want %d", len(got), len(tests))
+	}
+}
+
+func TestModelSample(t *testing.T) {
+	m, err := newModel("PM_", scanSample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Handles) != 1 || m.Handles[0].Type != "PM_StoreHandle" || m.Handles[0].Release != "PM_Store_release" {
+		t.Fatalf("handles = %+v", m.Handles)
+	}
+	var methods []string
+	for _, f := range m.Handles[0].Methods {
+		methods = append(methods, f.Method)
+	}
+	if got := strings.Join(methods, ","); got != "Lookup,Put" {
+		t.Errorf("Store methods = %s, want Lookup,Put", got)
+	}
+	if len(m.Callbacks) != 1 || m.Callbacks[0].Type != "PM_Walk_visit_fn" || m.Callbacks[0].Ret != "bool" {
+		t.Errorf("callbacks = %+v", m.Callbacks)
+	}
+	var status []string
+	for _, v := range m.Status.Values {
+		status = append(status, v.Name)
+	}
+	if got := strings.Join(status, ","); got != "OK,ERROR,PANIC,INVALID_ARGUMENT,NOT_FOUND" {
+		t.Errorf("status values = %s", got)
+	}
+}
+
+func TestNameSpelling(t *testing.T) {
+	tests := []struct {
+		in                   string
+		snake, pascal, camel string
+	}{
+		{"AddInts", "add_ints", "AddInts", "addInts"},
+		{"add_ints", "add_ints", "AddInts", "addInts"},
+		{"ADD_INTS", "add_ints", "AddInts", "addInts"},
+		{"HTTPServer", "http_server", "HttpServer", "httpServer"},
+		{"Store_Get", "store_get", "StoreGet", "storeGet"},
+		{"AUD_Play2", "aud_play2", "AudPlay2", "audPlay2"},
+	}
+	for _, tt := range tests {
+		if got := snakeName(tt.in); got != tt.snake {
+			t.Errorf("snakeName(%s) = %s, want %s", tt.in, got, tt.snake)
+		}
+		if got := pascalName(tt.in); got != tt.pascal {
+			t.Errorf("pascalName(%s) = %s, want %s", tt.in, got, tt.pascal)
+		}
+		if got := camelName(tt.in); got != tt.camel {
+			t.Errorf("camelName(%s) = %s, want %s", tt.in, got, tt.camel)
+		}
+	}
+}
+
+func TestNameSet(t *testing.T) {
+	names := newNameSet("java", true)
+	names.reserve("", "forgec", "ForgecException")
+	if err := names.declare("Store.", "get", "PM_Store_Get"); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.declare("", "get", "PM_Get"); err != nil {
+		t.Errorf("scopes are separate: %v", err)
+	}
+	err := names.declare("", "FORGECEXCEPTION", "PM_FORGECEXCEPTION")
+	if err == nil || err.Error() != "java: duplicate name FORGECEXCEPTION: declared by forgec and PM_FORGECEXCEPTION" {
+		t.Errorf("folded duplicate: err = %v", err)
+	}
+	names = newNameSet("c++", false)
+	names.reserve("", "forgec", "store")
+	if err := names.declare("", "Store", "PM_StoreHandle"); err != nil {
+		t.Errorf("case-sensitive set: %v", err)
+	}
+}
+
+func TestGeneratorsRejectDuplicateNames(t *testing.T) {
+	// AddInts and add_ints are spelled alike in every language.
+	apis := []*scanner.API{{PkgPath: "example.com/dup", Name: "dup", Funcs: []scanner.Func{
+		{Name: "AddInts", CName: "AddInts"},
+		{Name: "AddInts2", CName: "add_ints"},
+	}}}
+	want := map[string]string{
+		"python": "python: duplicate name add_ints: declared by PM_AddInts and PM_add_ints",
+		"csharp": "csharp: duplicate name AddInts: declared by PM_AddInts and PM_add_ints",
+		"rust":   "rust: duplicate name add_ints: declared by PM_AddInts and PM_add_ints",
+		"node":   "node: duplicate name addInts: declared by PM_AddInts and PM_add_ints",
+		"java":   "java: duplicate name addInts: declared by PM_AddInts and PM_add_ints",
+		"dart":   "dart: duplicate name addInts: declared by PM_AddInts and PM_add_ints",
+		"lua":    "lua: duplicate name add_ints: declared by PM_AddInts and PM_add_ints",
+		"swift":  "swift: duplicate name addInts: declared by PM_AddInts and PM_add_ints",
+		"c++":    "c++: duplicate name add_ints: declared by PM_AddInts and PM_add_ints",
+	}
+	for _, g := range generators {
+		t.Run(g.lang, func(t *testing.T) {
+			err := g.write(t.TempDir(), apis)
+			if err == nil || err.Error() != want[g.lang] {
+				t.Errorf("err = %v, want %s", err, want[g.lang])
+			}
+		})
+	}
+}
+
+// helperAPI has functions named like the helpers every binding declares next to them.
+func helperAPI() []*scanner.API {
+	var funcs []scanner.Func
+	for _, n := range []string{"Flush", "Check", "Json", "Load", "Detail"} {
+		funcs = append(funcs, scanner.Func{Name: n, CName: n})
+	}
+	return []*scanner.API{{PkgPath: "example.com/helpers", Name: "helpers", Funcs: funcs}}
+}
+
+func TestGeneratorsEscapeHelpers(t *testing.T) {
+	want := map[string][]string{
+		"python": {"def flush_():", "def json_():", "def check():", "def flush(timeout_ms=2000):"},
+		"csharp": {"public static void Flush_()", "public static void Check_()", "public static void Load()"},
+		"rust":   {"pub fn flush_() -> Result<(), ForgecError>", "pub fn check() -> Result<(), ForgecError>"},
+		"node":   {"function flush_() {", "function check_() {", "function load_() {", "function json() {"},
+		"java":   {"public static void flush_() throws ForgecException", "public static void check_() throws ForgecException", "public static void load() throws ForgecException"},
+		"dart":   {"void flush_() {", "void check() {"},
+		"lua":    {"function M.flush_()", "function M.check()"},
+		"swift":  {"public func flush_() throws", "public func check_() throws", "public func load() throws"},
+		"c++":    {"inline void flush_() {", "inline void detail_() {", "inline void check() {"},
+	}
+	for _, g := range generators {
+		t.Run(g.lang, func(t *testing.T) {
+			_, out := generate(t, g.lang, helperAPI())
+			for _, s := range want[g.lang] {
+				if !strings.Contains(out, s) {
+					t.Errorf("%s does not contain %q", g.out, s)
+				}
+			}
+		})
+	}
+}
+
+// memberAPI has a handle whose methods are named like the members of generated handle classes.
+func memberAPI() []*scanner.API {
+	var funcs []scanner.Func
+	for _, n := range []string{"Release", "Get", "Close", "Handle", "Dispose", "New"} {
+		funcs = append(funcs, scanner.Func{Name: n, CName: "Store_" + n, Recv: "Store"})
+	}
+	return []*scanner.API{{PkgPath: "example.com/members", Name: "members", Handles: []scanner.Handle{{Name: "Store"}}, Funcs: funcs}}
+}
+
+func TestGeneratorsEscapeHandleMembers(t *testing.T) {
+	want := map[string][]string{
+		"python": {"    def release_(self):", "    def get(self):"},
+		"csharp": {"public void Handle_()", "public void Dispose_()", "public void Release()"},
+		"rust":   {"pub fn release_(&self)", "pub fn get(&self)"},
+		"node":   {"  release_() {", "  handle_() {", "  get() {"},
+		"java":   {"public void close_() throws ForgecException", "public void handle_() throws ForgecException", "public void release() throws ForgecException"},
+		"dart":   {"void release_() {", "void handle_() {", "void get() {"},
+		"lua":    {"function Store:release_()", "function Store:new_()", "function Store:get()"},
+		"swift":  {"public func release_() throws", "public func handle_() throws", "public func get() throws"},
+		"c++":    {"void release_() const;", "void get_() const;", "void close() const;"},
+	}
+	for _, g := range generators {
+		t.Run(g.lang, func(t *testing.T) {
+			_, out := generate(t, g.lang, memberAPI())
+			for _, s := range want[g.lang] {
+				if !strings.Contains(out, s) {
+					t.Errorf("%s does not contain %q", g.out, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,637 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WriteNode writes Node.js bindings of the scanned packages into dir: index.js, a CommonJS
+// module calling the library through koffi, and index.d.ts. libName is the base name of the
+// shared library built by the build scripts.
+func WriteNode(dir, libName, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	js := newJSNames(m)
+	if err := js.check(); err != nil {
+		return err
+	}
+	var b, dts bytes.Buffer
+	writeNodeModule(&b, m, js, libName)
+	writeNodeTypes(&dts, m, js)
+	for name, data := range map[string][]byte{"index.js": b.Bytes(), "index.d.ts": dts.Bytes()} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// jsNames spells the model in JavaScript: camelCase functions and methods, PascalCase enum and
+// handle classes; structs, enum members and struct fields keep their C names.
+type jsNames struct {
+	m    *cModel
+	name map[any]string // *cEnum, *cHandle, *cStruct -> name
+}
+
+func newJSNames(m *cModel) *jsNames {
+	js := &jsNames{m: m, name: map[any]string{m.Status: "Status"}}
+	for _, e := range m.Enums {
+		js.name[e] = pascalName(e.Name)
+	}
+	for _, h := range m.Handles {
+		js.name[h] = pascalName(h.Name)
+	}
+	for _, s := range m.Structs {
+		js.name[s] = s.Name
+	}
+	return js
+}
+
+// check reports exported names declared twice.
+func (js *jsNames) check() error {
+	names := newNameSet("node", false)
+	names.reserve("", "forgec", "ForgecError")
+	names.reserve("", "forgec", jsHelpers...)
+	for k, name := range js.name {
+		var by string
+		switch v := k.(type) {
+		case *cEnum:
+			by = v.Type
+		case *cHandle:
+			by = v.Type
+		case *cStruct:
+			// structs are only TypeScript interfaces, but share the export namespace
+			by = v.Name
+		}
+		if err := names.declare("", name, by); err != nil {
+			return err
+		}
+	}
+	for _, h := range js.m.Handles {
+		names.reserve(js.name[h]+".", "forgec", jsHandleMembers...)
+	}
+	for _, f := range js.m.Funcs {
+		scope := ""
+		if f.Recv != nil {
+			scope = js.name[f.Recv] + "."
+		}
+		if err := names.declare(scope, js.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsHelpers are the functions and variables of the generated module and the CommonJS names a
+// function declaration would shadow; functions of the same name are escaped.
+var jsHelpers = []string{"lastError", "clearLastError", "reporterConfigure", "flush", "check", "bytes", "takeString",
+	"takeBytes", "takeStruct", "deprecated", "warned", "libraryFile", "load", "lib", "c", "fs", "path", "koffi",
+	"require", "module", "exports"}
+
+// jsHandleMembers are declared by every handle class; methods of the same name are escaped.
+var jsHandleMembers = []string{"handle", "release"}
+
+func (js *jsNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(jsIdent(camelName(f.Method)), jsHandleMembers)
+	}
+	return memberName(jsIdent(camelName(f.Name)), jsHelpers)
+}
+
+var jsReserved = map[string]bool{
+	"arguments": true, "await": true, "break": true, "case": true, "catch": true, "class": true,
+	"const": true, "continue": true, "debugger": true, "default": true, "delete": true, "do": true,
+	"else": true, "enum": true, "eval": true, "export": true, "extends": true, "false": true,
+	"finally": true, "for": true, "function": true, "if": true, "implements": true, "import": true,
+	"in": true, "instanceof": true, "interface": true, "let": true, "new": true, "null": true,
+	"package": true, "private": true, "protected": true, "public": true, "return": true, "static": true,
+	"super": true, "switch": true, "this": true, "throw": true, "true": true, "try": true, "typeof": true,
+	"var": true, "void": true, "while": true, "with": true, "yield": true,
+}
+
+// jsIdent escapes reserved words with a trailing underscore.
+func jsIdent(name string) string {
+	if jsReserved[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// koffiType is the koffi type of a C scalar, enum or handle value.
+func koffiType(v cValue) string {
+	switch v.Kind {
+	case valEnum:
+		return "int"
+	case valHandle:
+		return "uintptr_t"
+	}
+	return v.C
+}
+
+// koffiParams lists the koffi types of the C params of f, including out-params.
+func koffiParams(f *cFunc) []string {
+	var ts []string
+	for _, p := range f.Params {
+		switch p.Kind {
+		case valString:
+			ts = append(ts, "'const char *'")
+		case valBytes:
+			ts = append(ts, "'const uint8_t *'", "'size_t'")
+		case valStruct:
+			ts = append(ts, "'const "+p.C+" *'")
+		case valCallback:
+			ts = append(ts, "koffi.pointer("+p.C+")", "'void *'")
+		default:
+			ts = append(ts, "'"+koffiType(p)+"'")
+		}
+	}
+	if r := f.Result; r != nil {
+		switch r.Kind {
+		case valString:
+			ts = append(ts, "koffi.out(koffi.pointer('void *'))")
+		case valBytes:
+			ts = append(ts, "koffi.out(koffi.pointer('void *'))", "koffi.out(koffi.pointer('size_t'))")
+		case valStruct:
+			ts = append(ts, "koffi.out(koffi.pointer("+r.C+"_out))")
+		default:
+			ts = append(ts, "koffi.out(koffi.pointer('"+koffiType(*r)+"'))")
+		}
+	}
+	return ts
+}
+
+// tsType is the TypeScript type of a param (result false) or result (result true).
+func (js *jsNames) tsType(v cValue, result bool) string {
+	switch v.Kind {
+	case valEnum:
+		return js.name[v.Enum]
+	case valHandle:
+		return js.name[v.Handle] + " | null"
+	case valString:
+		if result {
+			return "string"
+		}
+		return "string | null"
+	case valBytes:
+		if result {
+			return "Buffer"
+		}
+		return "Uint8Array | null"
+	case valStruct:
+		if result {
+			return v.C
+		}
+		return "Partial<" + v.C + "> | null"
+	case valCallback:
+		var ps []string
+		for _, p := range v.Callback.Params {
+			ps = append(ps, jsIdent(p.Name)+": "+js.tsType(p, true))
+		}
+		ret := "void"
+		if v.Callback.Ret != "" {
+			ret = tsScalar(v.Callback.Ret)
+		}
+		return fmt.Sprintf("(%s) => %s", strings.Join(ps, ", "), ret)
+	}
+	return tsScalar(v.C)
+}
+
+// tsScalar is the TypeScript type of a C scalar; koffi passes 64-bit integers beyond
+// Number.MAX_SAFE_INTEGER as BigInt.
+func tsScalar(c string) string {
+	switch c {
+	case "bool":
+		return "boolean"
+	case "int64_t", "uint64_t", "uintptr_t":
+		return "number | bigint"
+	}
+	return "number"
+}
+
+// jsZero is the zero value of a struct field, filling fields missing from struct params.
+func jsZero(f cField) string {
+	switch {
+	case f.String:
+		return "null"
+	case f.C == "bool":
+		return "false"
+	}
+	return "0"
+}
+
+func writeNodeModule(b *bytes.Buffer, m *cModel, js *jsNames, libName string) {
+	envVar := pyEnvName(libName) + "_LIBRARY"
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "// Node.js bindings of the %s library through koffi (npm install koffi). The library is\n", libName)
+	fmt.Fprintf(b, "// loaded from $%s if set, else %s next to this module or in the dist/\n", envVar, jsLibFile(libName))
+	b.WriteString("// directory next to it or its parents, else through the system search path. Exports throw\n")
+	b.WriteString("// ForgecError on a non-OK status and return their out-param; strings and buffers returned\n")
+	b.WriteString("// by the library are copied and released with capi_free.\n\n")
+	b.WriteString("'use strict';\n\n")
+	b.WriteString("const fs = require('fs');\n")
+	b.WriteString("const path = require('path');\n")
+	b.WriteString("const koffi = require('koffi');\n\n")
+
+	b.WriteString("function libraryFile() {\n")
+	fmt.Fprintf(b, "  if (process.platform === 'win32') return '%s.dll';\n", libName)
+	fmt.Fprintf(b, "  if (process.platform === 'darwin') return 'lib%s.dylib';\n", libName)
+	fmt.Fprintf(b, "  return 'lib%s.so';\n", libName)
+	b.WriteString("}\n\n")
+	b.WriteString("function load() {\n")
+	fmt.Fprintf(b, "  if (process.env.%s) return koffi.load(process.env.%s);\n", envVar, envVar)
+	b.WriteString("  const file = libraryFile();\n")
+	b.WriteString("  for (const dir of [__dirname, path.join(__dirname, 'dist'), path.join(__dirname, '..', 'dist'), path.join(__dirname, '..', '..', 'dist')]) {\n")
+	b.WriteString("    if (fs.existsSync(path.join(dir, file))) return koffi.load(path.join(dir, file));\n")
+	b.WriteString("  }\n")
+	b.WriteString("  return koffi.load(file);\n")
+	b.WriteString("}\n\n")
+	b.WriteString("const lib = load();\n\n")
+
+	for _, s := range m.Structs {
+		var in, out []string
+		for _, f := range s.Fields {
+			in = append(in, fmt.Sprintf("  %s: '%s',\n", f.Name, f.C))
+			t := f.C
+			if f.String {
+				t = "void *"
+			}
+			out = append(out, fmt.Sprintf("  %s: '%s',\n", f.Name, t))
+		}
+		fmt.Fprintf(b, "const %s = koffi.struct('%s', {\n%s});\n", s.Name, s.Name, strings.Join(in, ""))
+		b.WriteString("// as returned by the library, whose strings are released with the _free function\n")
+		fmt.Fprintf(b, "const %s_out = koffi.struct('%s_out', {\n%s});\n\n", s.Name, s.Name, strings.Join(out, ""))
+	}
+	for _, cb := range m.Callbacks {
+		var ts []string
+		for _, p := range cb.Params {
+			switch p.Kind {
+			case valString:
+				ts = append(ts, "'const char *'")
+			case valBytes:
+				ts = append(ts, "'const uint8_t *'", "'size_t'")
+			default:
+				ts = append(ts, "'"+p.C+"'")
+			}
+		}
+		ts = append(ts, "'void *'")
+		ret := "void"
+		if cb.Ret != "" {
+			ret = cb.Ret
+		}
+		fmt.Fprintf(b, "const %s = koffi.proto('%s', '%s', [%s]);\n", cb.Type, cb.Type, ret, strings.Join(ts, ", "))
+	}
+	if len(m.Callbacks) > 0 {
+		b.WriteString("\n")
+	}
+
+	b.WriteString("const c = {\n")
+	b.WriteString("  capi_free: lib.func('capi_free', 'void', ['void *']),\n")
+	b.WriteString("  capi_last_error_json: lib.func('capi_last_error_json', 'void *', []),\n")
+	b.WriteString("  capi_clear_last_error: lib.func('capi_clear_last_error', 'void', []),\n")
+	b.WriteString("  capi_reporter_configure: lib.func('capi_reporter_configure', 'int32_t', ['const char *', 'const char *']),\n")
+	b.WriteString("  capi_flush: lib.func('capi_flush', 'bool', ['uint32_t']),\n")
+	for _, s := range m.Structs {
+		fmt.Fprintf(b, "  %s: lib.func('%s', 'void', [koffi.inout(koffi.pointer(%s_out))]),\n", s.Free, s.Free, s.Name)
+	}
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "  %s: lib.func('%s', 'int32_t', ['uintptr_t']),\n", h.Release, h.Release)
+	}
+	for _, f := range m.Funcs {
+		fmt.Fprintf(b, "  %s: lib.func('%s', 'int32_t', [%s]),\n", f.Symbol, f.Symbol, strings.Join(koffiParams(f), ", "))
+	}
+	b.WriteString("};\n\n")
+
+	writeJSEnum(b, "Status", m.Status)
+	b.WriteString("class ForgecError extends Error {\n")
+	b.WriteString("  constructor(status, record) {\n")
+	b.WriteString("    super(`${record.function || ''}: ${record.error || ''} (${Status[status] || status})`);\n")
+	b.WriteString("    this.name = 'ForgecError';\n")
+	b.WriteString("    this.status = status;\n")
+	b.WriteString("    this.function = record.function || '';\n")
+	b.WriteString("    this.record = record;\n")
+	b.WriteString("  }\n")
+	b.WriteString("}\n\n")
+	b.WriteString("function check(status) {\n")
+	b.WriteString("  if (status !== 0) throw new ForgecError(status, lastError());\n")
+	b.WriteString("}\n\n")
+	b.WriteString("function bytes(p, n) {\n")
+	b.WriteString("  n = Number(n);\n")
+	b.WriteString("  return p && n ? Buffer.from(koffi.decode(p, koffi.array('uint8_t', n, 'Typed'))) : Buffer.alloc(0);\n")
+	b.WriteString("}\n\n")
+	b.WriteString("function takeString(p) {\n")
+	b.WriteString("  if (!p) return '';\n")
+	b.WriteString("  try {\n    return koffi.decode(p, 'char', -1);\n  } finally {\n    c.capi_free(p);\n  }\n")
+	b.WriteString("}\n\n")
+	b.WriteString("function takeBytes(p, n) {\n")
+	b.WriteString("  try {\n    return bytes(p, n);\n  } finally {\n    if (p) c.capi_free(p);\n  }\n")
+	b.WriteString("}\n\n")
+	b.WriteString("// takeStruct copies a struct returned by the library, then releases its strings.\n")
+	b.WriteString("function takeStruct(raw, free, strings) {\n")
+	b.WriteString("  const v = { ...raw };\n")
+	b.WriteString("  for (const f of strings) v[f] = raw[f] ? koffi.decode(raw[f], 'char', -1) : null;\n")
+	b.WriteString("  free(raw);\n")
+	b.WriteString("  return v;\n")
+	b.WriteString("}\n\n")
+	b.WriteString("const warned = new Set();\n\n")
+	b.WriteString("function deprecated(name, message) {\n")
+	b.WriteString("  if (warned.has(name)) return;\n")
+	b.WriteString("  warned.add(name);\n")
+	b.WriteString("  process.emitWarning(`${name} is deprecated: ${message}`, 'DeprecationWarning');\n")
+	b.WriteString("}\n\n")
+	b.WriteString("// lastError returns the last error recorded on the calling thread ({} if none).\n")
+	b.WriteString("function lastError() {\n")
+	b.WriteString("  const p = c.capi_last_error_json();\n")
+	b.WriteString("  return p ? JSON.parse(takeString(p)) : {};\n")
+	b.WriteString("}\n\n")
+	b.WriteString("function clearLastError() {\n")
+	b.WriteString("  c.capi_clear_last_error();\n")
+	b.WriteString("}\n\n")
+	b.WriteString("// reporterConfigure configures a registered reporter, e.g., 'jsonl' or 'sentry'.\n")
+	b.WriteString("function reporterConfigure(name, config) {\n")
+	b.WriteString("  check(c.capi_reporter_configure(name, typeof config === 'string' ? config : JSON.stringify(config)));\n")
+	b.WriteString("}\n\n")
+	b.WriteString("// flush waits up to timeoutMs for reporters to deliver queued reports.\n")
+	b.WriteString("function flush(timeoutMs = 2000) {\n")
+	b.WriteString("  return c.capi_flush(timeoutMs);\n")
+	b.WriteString("}\n\n")
+
+	for _, e := range m.Enums {
+		writeJSEnum(b, js.name[e], e)
+	}
+	for _, s := range m.Structs {
+		var zs []string
+		for _, f := range s.Fields {
+			zs = append(zs, f.Name+": "+jsZero(f))
+		}
+		fmt.Fprintf(b, "const %s_zero = Object.freeze({ %s });\n", s.Name, strings.Join(zs, ", "))
+	}
+	if len(m.Structs) > 0 {
+		b.WriteString("\n")
+	}
+
+	for _, h := range m.Handles {
+		name := js.name[h]
+		fmt.Fprintf(b, "// %s is a %s: an opaque reference to a Go object, released with release().\n", name, h.Type)
+		fmt.Fprintf(b, "class %s {\n", name)
+		b.WriteString("  constructor(handle) {\n    this.handle = handle;\n  }\n\n")
+		b.WriteString("  release() {\n")
+		b.WriteString("    const h = this.handle;\n")
+		b.WriteString("    this.handle = 0;\n")
+		fmt.Fprintf(b, "    check(c.%s(h));\n", h.Release)
+		b.WriteString("  }\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writeJSFunc(b, js, f, "  ")
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			writeJSFunc(b, js, f, "")
+			b.WriteString("\n")
+		}
+	}
+
+	exports := []string{"ForgecError", "Status", "lastError", "clearLastError", "reporterConfigure", "flush"}
+	for _, e := range m.Enums {
+		exports = append(exports, js.name[e])
+	}
+	for _, h := range m.Handles {
+		exports = append(exports, js.name[h])
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			exports = append(exports, js.funcName(f))
+		}
+	}
+	b.WriteString("module.exports = {\n")
+	for _, e := range exports {
+		fmt.Fprintf(b, "  %s,\n", e)
+	}
+	b.WriteString("};\n")
+}
+
+// jsString renders a single-quoted JavaScript string literal.
+func jsString(s string) string {
+	q := strconv.Quote(s)
+	q = strings.ReplaceAll(q[1:len(q)-1], `\"`, `"`)
+	return "'" + strings.ReplaceAll(q, "'", `\'`) + "'"
+}
+
+func jsLibFile(libName string) string {
+	return fmt.Sprintf("lib%s.so, lib%s.dylib or %s.dll", libName, libName, libName)
+}
+
+// writeJSEnum writes a frozen object mapping names to values and back, like a TypeScript enum.
+func writeJSEnum(b *bytes.Buffer, name string, e *cEnum) {
+	fmt.Fprintf(b, "const %s = Object.freeze({\n", name)
+	seen := map[int64]bool{}
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "  %s: %d,\n", v.Name, v.Value)
+	}
+	for _, v := range e.Values {
+		if !seen[v.Value] {
+			seen[v.Value] = true
+			fmt.Fprintf(b, "  %d: '%s',\n", v.Value, v.Name)
+		}
+	}
+	b.WriteString("});\n\n")
+}
+
+// writeJSFunc writes the wrapper of an export: a function, or a method of its handle class.
+func writeJSFunc(b *bytes.Buffer, js *jsNames, f *cFunc, indent string) {
+	in := indent + "  "
+	var ps, args []string
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "this.handle")
+			continue
+		}
+		n := jsIdent(camelName(p.Name))
+		ps = append(ps, n)
+		switch p.Kind {
+		case valHandle:
+			args = append(args, n+" ? "+n+".handle : 0")
+		case valBytes:
+			args = append(args, n, n+" ? "+n+".length : 0")
+		case valStruct:
+			args = append(args, fmt.Sprintf("%s == null ? null : { ...%s_zero, ...%s }", n, p.C, n))
+		case valCallback:
+			args = append(args, jsCallbackAdapter(p.Callback, n), "null")
+		default:
+			args = append(args, n)
+		}
+	}
+	r := f.Result
+	if r != nil {
+		args = append(args, "out")
+		if r.Kind == valBytes {
+			args = append(args, "outLen")
+		}
+	}
+	fmt.Fprintf(b, "%s// %s\n", indent, strings.TrimSuffix(f.cPrototype(), ";"))
+	if f.Recv != nil {
+		fmt.Fprintf(b, "%s%s(%s) {\n", indent, js.funcName(f), strings.Join(ps, ", "))
+	} else {
+		fmt.Fprintf(b, "%sfunction %s(%s) {\n", indent, js.funcName(f), strings.Join(ps, ", "))
+	}
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%sdeprecated('%s', %s);\n", in, f.Symbol, jsString(f.Deprecated))
+	}
+	if r != nil {
+		if r.Kind == valStruct {
+			fmt.Fprintf(b, "%sconst out = {};\n", in)
+		} else {
+			fmt.Fprintf(b, "%sconst out = [null];\n", in)
+		}
+		if r.Kind == valBytes {
+			fmt.Fprintf(b, "%sconst outLen = [0];\n", in)
+		}
+	}
+	fmt.Fprintf(b, "%scheck(c.%s(%s));\n", in, f.Symbol, strings.Join(args, ", "))
+	if r != nil {
+		switch r.Kind {
+		case valHandle:
+			fmt.Fprintf(b, "%sreturn out[0] ? new %s(out[0]) : null;\n", in, js.name[r.Handle])
+		case valString:
+			fmt.Fprintf(b, "%sreturn takeString(out[0]);\n", in)
+		case valBytes:
+			fmt.Fprintf(b, "%sreturn takeBytes(out[0], outLen[0]);\n", in)
+		case valStruct:
+			var strs []string
+			for _, fl := range r.Struct.Fields {
+				if fl.String {
+					strs = append(strs, "'"+fl.Name+"'")
+				}
+			}
+			fmt.Fprintf(b, "%sreturn takeStruct(out, c.%s, [%s]);\n", in, r.Struct.Free, strings.Join(strs, ", "))
+		default:
+			fmt.Fprintf(b, "%sreturn out[0];\n", in)
+		}
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// jsCallbackAdapter renders the function koffi calls for a callback param: the JS function
+// itself, or an adapter copying buffer params into Buffers (koffi decodes strings).
+func jsCallbackAdapter(cb *cCallback, fn string) string {
+	var ps, args []string
+	adapt := false
+	for _, p := range cb.Params {
+		n := jsIdent(p.Name)
+		switch p.Kind {
+		case valBytes:
+			adapt = true
+			ps = append(ps, n, n+"Len")
+			args = append(args, "bytes("+n+", "+n+"Len)")
+		default:
+			ps = append(ps, n)
+			args = append(args, n)
+		}
+	}
+	if !adapt {
+		return fn
+	}
+	return fmt.Sprintf("%s && ((%s) => %s(%s))", fn, strings.Join(ps, ", "), fn, strings.Join(args, ", "))
+}
+
+func writeNodeTypes(b *bytes.Buffer, m *cModel, js *jsNames) {
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n\n")
+	b.WriteString("/// <reference types=\"node\" />\n\n")
+	writeTSEnum(b, "Status", m.Status)
+	b.WriteString("/** The record returned by capi_last_error_json (see forgec.error.schema.json). */\n")
+	b.WriteString("export interface ErrorRecord {\n")
+	b.WriteString("  schema_version: number;\n")
+	b.WriteString("  function: string;\n")
+	b.WriteString("  status: number;\n")
+	b.WriteString("  error: string;\n")
+	b.WriteString("  type: string;\n")
+	b.WriteString("  wrapped?: { error: string; type: string; wrapped?: unknown[] }[];\n")
+	b.WriteString("  stack?: string;\n")
+	b.WriteString("  time: string;\n")
+	b.WriteString("}\n\n")
+	b.WriteString("/** Thrown when an export returns a non-OK status. */\n")
+	b.WriteString("export declare class ForgecError extends Error {\n")
+	b.WriteString("  constructor(status: number, record: ErrorRecord);\n")
+	b.WriteString("  readonly status: Status | number;\n")
+	b.WriteString("  readonly function: string;\n")
+	b.WriteString("  readonly record: ErrorRecord;\n")
+	b.WriteString("}\n\n")
+	b.WriteString("export declare function lastError(): ErrorRecord | Record<string, never>;\n")
+	b.WriteString("export declare function clearLastError(): void;\n")
+	b.WriteString("export declare function reporterConfigure(name: string, config: string | object): void;\n")
+	b.WriteString("export declare function flush(timeoutMs?: number): boolean;\n\n")
+	for _, e := range m.Enums {
+		writeTSEnum(b, js.name[e], e)
+	}
+	for _, s := range m.Structs {
+		fmt.Fprintf(b, "export interface %s {\n", s.Name)
+		for _, f := range s.Fields {
+			t := tsScalar(f.C)
+			if f.String {
+				t = "string | null"
+			}
+			fmt.Fprintf(b, "  %s: %s;\n", f.Name, t)
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "/** %s: an opaque reference to a Go object, released with release(). */\n", h.Type)
+		fmt.Fprintf(b, "export declare class %s {\n", js.name[h])
+		b.WriteString("  constructor(handle: number | bigint);\n")
+		b.WriteString("  readonly handle: number | bigint;\n")
+		b.WriteString("  release(): void;\n")
+		for _, f := range h.Methods {
+			writeTSDoc(b, f, "  ")
+			fmt.Fprintf(b, "  %s;\n", js.tsSignature(f))
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			writeTSDoc(b, f, "")
+			fmt.Fprintf(b, "export declare function %s;\n", js.tsSignature(f))
+		}
+	}
+}
+
+func writeTSEnum(b *bytes.Buffer, name string, e *cEnum) {
+	fmt.Fprintf(b, "export declare enum %s {\n", name)
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "  %s = %d,\n", v.Name, v.Value)
+	}
+	b.WriteString("}\n\n")
+}
+
+func writeTSDoc(b *bytes.Buffer, f *cFunc, indent string) {
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%s/** `%s`\n%s * @deprecated %s */\n", indent, strings.TrimSuffix(f.cPrototype(), ";"), indent, f.Deprecated)
+		return
+	}
+	fmt.Fprintf(b, "%s/** `%s` */\n", indent, strings.TrimSuffix(f.cPrototype(), ";"))
+}
+
+// tsSignature renders the declaration of a wrapper after `function` (or as a method).
+func (js *jsNames) tsSignature(f *cFunc) string {
+	var ps []string
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			continue
+		}
+		ps = append(ps, jsIdent(camelName(p.Name))+": "+js.tsType(p, false))
+	}
+	ret := "void"
+	if f.Result != nil {
+		ret = js.tsType(*f.Result, true)
+	}
+	return fmt.Sprintf("%s(%s): %s", js.funcName(f), strings.Join(ps, ", "), ret)
+}
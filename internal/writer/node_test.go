@@ -0,0 +1,42 @@
+package writer
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+func TestWriteNodeCompiles(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("no node")
+	}
+	tests := []struct {
+		name string
+		apis func(*testing.T) []*scanner.API
+	}{
+		{"sample", scanSample},
+		{"members", func(*testing.T) []*scanner.API { return memberAPI() }},
+		{"helpers", func(*testing.T) []*scanner.API { return helperAPI() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := generate(t, "node", tt.apis(t))
+			// The module requires koffi and loads the library, so it is only parsed.
+			out, err := exec.Command(node, "--check", filepath.Join(dir, "index.js")).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+			tsc, err := exec.LookPath("tsc")
+			if err != nil {
+				return
+			}
+			out, err = exec.Command(tsc, "--noEmit", "--strict", filepath.Join(dir, "index.d.ts")).CombinedOutput()
+			if err != nil {
+				t.Fatalf("tsc: %v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,579 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WritePython writes ctypes bindings of the scanned packages to path (e.g., sample.py) and a
+// type stub next to it (sample.pyi). libName is the base name of the shared library built by
+// the build scripts (lib<libName>.so, lib<libName>.dylib or <libName>.dll).
+func WritePython(path, libName, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	py := newPyNames(m)
+	if err := py.check(); err != nil {
+		return err
+	}
+	var b, stub bytes.Buffer
+	writePythonModule(&b, m, py, libName)
+	writePythonStub(&stub, m, py)
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	stubPath := strings.TrimSuffix(path, ".py") + ".pyi"
+	if err := os.WriteFile(stubPath, stub.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", stubPath, err)
+	}
+	return nil
+}
+
+// pyNames spells the model in Python: snake_case functions, methods and params, PascalCase
+// enum and handle classes; structs keep their C names.
+type pyNames struct {
+	m     *cModel
+	class map[any]string // *cEnum, *cHandle, *cStruct -> class name
+}
+
+func newPyNames(m *cModel) *pyNames {
+	py := &pyNames{m: m, class: map[any]string{m.Status: "Status"}}
+	for _, e := range m.Enums {
+		py.class[e] = pascalName(e.Name)
+	}
+	for _, h := range m.Handles {
+		py.class[h] = pascalName(h.Name)
+	}
+	for _, s := range m.Structs {
+		py.class[s] = s.Name
+	}
+	return py
+}
+
+// check reports Python names declared twice in the module or in a handle class, e.g., an enum
+// and a struct spelled alike.
+func (py *pyNames) check() error {
+	names := newNameSet("python", false)
+	names.reserve("", "forgec", "ForgecError")
+	names.reserve("", "forgec", pyHelpers...)
+	for k, name := range py.class {
+		var by string
+		switch v := k.(type) {
+		case *cEnum:
+			by = v.Type
+		case *cHandle:
+			by = v.Type
+		case *cStruct:
+			by = v.Name
+		}
+		if err := names.declare("", name, by); err != nil {
+			return err
+		}
+	}
+	for _, h := range py.m.Handles {
+		names.reserve(py.class[h]+".", h.Type, pyHandleMembers...)
+	}
+	for _, f := range py.m.Funcs {
+		scope := ""
+		if f.Recv != nil {
+			scope = py.class[f.Recv] + "."
+		}
+		if err := names.declare(scope, py.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pyHelpers are the functions and imported modules of the generated module; functions of the
+// same name are escaped.
+var pyHelpers = []string{"last_error", "clear_last_error", "reporter_configure", "flush", "ctypes", "enum", "json", "os", "sys", "warnings"}
+
+// pyHandleMembers are declared by every handle class; methods of the same name are escaped.
+var pyHandleMembers = []string{"release", "__init__", "__enter__", "__exit__", "__int__", "__del__"}
+
+func (py *pyNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(pyIdent(snakeName(f.Method)), pyHandleMembers)
+	}
+	return memberName(pyIdent(snakeName(f.Name)), pyHelpers)
+}
+
+var pyKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true, "async": true,
+	"await": true, "break": true, "class": true, "continue": true, "def": true, "del": true, "elif": true,
+	"else": true, "except": true, "finally": true, "for": true, "from": true, "global": true, "if": true,
+	"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true, "not": true, "or": true,
+	"pass": true, "raise": true, "return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// pyIdent escapes Python keywords with a trailing underscore.
+func pyIdent(name string) string {
+	if pyKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// pyCTypes maps C scalar types to ctypes.
+var pyCTypes = map[string]string{
+	"int8_t":      "ctypes.c_int8",
+	"int16_t":     "ctypes.c_int16",
+	"int32_t":     "ctypes.c_int32",
+	"int64_t":     "ctypes.c_int64",
+	"uint8_t":     "ctypes.c_uint8",
+	"uint16_t":    "ctypes.c_uint16",
+	"uint32_t":    "ctypes.c_uint32",
+	"uint64_t":    "ctypes.c_uint64",
+	"uintptr_t":   "ctypes.c_size_t",
+	"float":       "ctypes.c_float",
+	"double":      "ctypes.c_double",
+	"bool":        "ctypes.c_bool",
+	"const char*": "ctypes.c_char_p",
+}
+
+// pyScalarHint is the Python type of a C scalar.
+func pyScalarHint(c string) string {
+	switch c {
+	case "float", "double":
+		return "float"
+	case "bool":
+		return "bool"
+	}
+	return "int"
+}
+
+// ctype is the ctypes type of a param (in argtypes) or, with out, of a result variable.
+func (py *pyNames) ctype(v cValue) string {
+	switch v.Kind {
+	case valEnum:
+		return "ctypes.c_int"
+	case valHandle:
+		return "ctypes.c_size_t"
+	case valString, valBytes:
+		return "ctypes.c_char_p"
+	case valStruct:
+		return v.C
+	case valCallback:
+		return v.C
+	}
+	return pyCTypes[v.C]
+}
+
+// argtypes lists the ctypes of the C params of f, including out-params.
+func (py *pyNames) argtypes(f *cFunc) []string {
+	var ts []string
+	for _, p := range f.Params {
+		switch p.Kind {
+		case valBytes:
+			ts = append(ts, "ctypes.c_char_p", "ctypes.c_size_t")
+		case valStruct:
+			ts = append(ts, "ctypes.POINTER("+p.C+")")
+		case valCallback:
+			ts = append(ts, p.C, "ctypes.c_void_p")
+		default:
+			ts = append(ts, py.ctype(p))
+		}
+	}
+	if r := f.Result; r != nil {
+		switch r.Kind {
+		case valString:
+			ts = append(ts, "ctypes.POINTER(ctypes.c_void_p)")
+		case valBytes:
+			ts = append(ts, "ctypes.POINTER(ctypes.c_void_p)", "ctypes.POINTER(ctypes.c_size_t)")
+		default:
+			ts = append(ts, "ctypes.POINTER("+py.ctype(*r)+")")
+		}
+	}
+	return ts
+}
+
+// hint is the Python type of a param (result false) or result (result true).
+func (py *pyNames) hint(v cValue, result bool) string {
+	switch v.Kind {
+	case valEnum:
+		return py.class[v.Enum]
+	case valHandle:
+		return "Optional[" + py.class[v.Handle] + "]"
+	case valString:
+		if result {
+			return "str"
+		}
+		return "Optional[str]"
+	case valBytes:
+		return "bytes"
+	case valStruct:
+		if result {
+			return v.C
+		}
+		return "Optional[" + v.C + "]"
+	case valCallback:
+		var ps []string
+		for _, p := range v.Callback.Params {
+			ps = append(ps, py.hint(p, true))
+		}
+		ret := "None"
+		if v.Callback.Ret != "" {
+			ret = pyScalarHint(v.Callback.Ret)
+		}
+		return fmt.Sprintf("Optional[Callable[[%s], %s]]", strings.Join(ps, ", "), ret)
+	}
+	return pyScalarHint(v.C)
+}
+
+// params returns the Python params of a wrapper (without self) and the C call arguments.
+func (py *pyNames) params(f *cFunc) (names, args []string) {
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "self._h")
+			continue
+		}
+		n := pyIdent(snakeName(p.Name))
+		names = append(names, n)
+		switch p.Kind {
+		case valEnum:
+			args = append(args, "int("+n+")")
+		case valHandle:
+			args = append(args, "_handle("+n+")")
+		case valString:
+			args = append(args, "_str("+n+")")
+		case valBytes:
+			args = append(args, "_"+n, "len(_"+n+")")
+		case valStruct:
+			args = append(args, "_ref("+n+")")
+		case valCallback:
+			args = append(args, "_"+n, "None")
+		default:
+			args = append(args, n)
+		}
+	}
+	return names, args
+}
+
+func writePythonModule(b *bytes.Buffer, m *cModel, py *pyNames, libName string) {
+	envVar := pyEnvName(libName) + "_LIBRARY"
+	b.WriteString("# Code generated by forgec. DO NOT EDIT.\n")
+	fmt.Fprintf(b, "\"\"\"ctypes bindings of the %s library, generated by forgec from the API of forgec.h.\n\n", libName)
+	fmt.Fprintf(b, "The library is loaded from $%s if set, else lib%s.so, lib%s.dylib or %s.dll\n", envVar, libName, libName, libName)
+	b.WriteString("next to this module or in the dist/ directory next to it or its parent, else through the\n")
+	b.WriteString("system search path.\n")
+	b.WriteString("Exports raise ForgecError when they return a non-OK status and return their out-param;\n")
+	b.WriteString("strings and buffers returned by the library are copied and released with capi_free.\n")
+	b.WriteString("\"\"\"\n\n")
+	b.WriteString("import ctypes\nimport enum\nimport json\nimport os\nimport sys\nimport warnings\n\n\n")
+
+	b.WriteString("def _load():\n")
+	fmt.Fprintf(b, "    path = os.environ.get(%q)\n", envVar)
+	b.WriteString("    if path:\n        return ctypes.CDLL(path)\n")
+	b.WriteString("    if sys.platform == \"win32\":\n")
+	fmt.Fprintf(b, "        name = %q\n", libName+".dll")
+	b.WriteString("    elif sys.platform == \"darwin\":\n")
+	fmt.Fprintf(b, "        name = %q\n", "lib"+libName+".dylib")
+	b.WriteString("    else:\n")
+	fmt.Fprintf(b, "        name = %q\n", "lib"+libName+".so")
+	b.WriteString("    here = os.path.dirname(os.path.abspath(__file__))\n")
+	b.WriteString("    for d in (here, os.path.join(here, \"dist\"), os.path.join(here, os.pardir, \"dist\")):\n")
+	b.WriteString("        if os.path.exists(os.path.join(d, name)):\n")
+	b.WriteString("            return ctypes.CDLL(os.path.join(d, name))\n")
+	b.WriteString("    return ctypes.CDLL(name)\n\n\n")
+	b.WriteString("_lib = _load()\n\n\n")
+	b.WriteString("def _declare(name, restype, argtypes):\n")
+	b.WriteString("    fn = getattr(_lib, name)\n")
+	b.WriteString("    fn.restype = restype\n")
+	b.WriteString("    fn.argtypes = argtypes\n")
+	b.WriteString("    return fn\n\n\n")
+	b.WriteString("_capi_last_error_json = _declare(\"capi_last_error_json\", ctypes.c_void_p, [])\n")
+	b.WriteString("_capi_clear_last_error = _declare(\"capi_clear_last_error\", None, [])\n")
+	b.WriteString("_capi_free = _declare(\"capi_free\", None, [ctypes.c_void_p])\n")
+	b.WriteString("_capi_reporter_configure = _declare(\"capi_reporter_configure\", ctypes.c_int32, [ctypes.c_char_p, ctypes.c_char_p])\n")
+	b.WriteString("_capi_flush = _declare(\"capi_flush\", ctypes.c_bool, [ctypes.c_uint32])\n\n\n")
+
+	writePyEnum(b, "Status", m.Status)
+	b.WriteString("class ForgecError(Exception):\n")
+	b.WriteString("    \"\"\"Raised when an export returns a non-OK status.\n\n")
+	b.WriteString("    status is a Status (or the raw code), record the capi_last_error_json payload\n")
+	b.WriteString("    (function, status, error, type, wrapped, stack, time).\n")
+	b.WriteString("    \"\"\"\n\n")
+	b.WriteString("    def __init__(self, status, record):\n")
+	b.WriteString("        try:\n            status = Status(status)\n        except ValueError:\n            pass\n")
+	b.WriteString("        self.status = status\n")
+	b.WriteString("        self.record = record\n")
+	b.WriteString("        self.function = record.get(\"function\", \"\")\n")
+	b.WriteString("        super().__init__(\"%s: %s (%s)\" % (self.function, record.get(\"error\", \"\"), getattr(status, \"name\", status)))\n\n\n")
+	b.WriteString("def last_error():\n")
+	b.WriteString("    \"\"\"Returns the last error recorded on the calling thread as a dict ({} if none).\"\"\"\n")
+	b.WriteString("    p = _capi_last_error_json()\n")
+	b.WriteString("    if not p:\n        return {}\n")
+	b.WriteString("    try:\n        return json.loads(ctypes.string_at(p).decode(\"utf-8\"))\n")
+	b.WriteString("    finally:\n        _capi_free(p)\n\n\n")
+	b.WriteString("def clear_last_error():\n")
+	b.WriteString("    _capi_clear_last_error()\n\n\n")
+	b.WriteString("def reporter_configure(name, config):\n")
+	b.WriteString("    \"\"\"Configures a registered reporter (e.g., \"jsonl\" or \"sentry\"); config is a dict or JSON text.\"\"\"\n")
+	b.WriteString("    if not isinstance(config, (str, bytes)):\n        config = json.dumps(config)\n")
+	b.WriteString("    _check(_capi_reporter_configure(_str(name), _str(config)))\n\n\n")
+	b.WriteString("def flush(timeout_ms=2000):\n")
+	b.WriteString("    \"\"\"Waits up to timeout_ms for reporters to deliver queued reports.\"\"\"\n")
+	b.WriteString("    return bool(_capi_flush(timeout_ms))\n\n\n")
+	b.WriteString("def _check(status):\n")
+	b.WriteString("    if status != 0:\n        raise ForgecError(status, last_error())\n\n\n")
+	b.WriteString("def _str(s):\n")
+	b.WriteString("    return s.encode(\"utf-8\") if isinstance(s, str) else s\n\n\n")
+	b.WriteString("def _handle(h):\n")
+	b.WriteString("    if h is None:\n        return 0\n")
+	b.WriteString("    return h if isinstance(h, int) else h._h\n\n\n")
+	b.WriteString("def _ref(s):\n")
+	b.WriteString("    return None if s is None else ctypes.byref(s)\n\n\n")
+	b.WriteString("def _take_str(p):\n")
+	b.WriteString("    if not p.value:\n        return \"\"\n")
+	b.WriteString("    try:\n        return ctypes.string_at(p.value).decode(\"utf-8\")\n")
+	b.WriteString("    finally:\n        _capi_free(p.value)\n\n\n")
+	b.WriteString("def _take_bytes(p, n):\n")
+	b.WriteString("    if not p.value:\n        return b\"\"\n")
+	b.WriteString("    try:\n        return ctypes.string_at(p.value, n.value)\n")
+	b.WriteString("    finally:\n        _capi_free(p.value)\n\n\n")
+	b.WriteString("def _take_struct(s, free):\n")
+	b.WriteString("    # copy the library-owned strings into Python before releasing them\n")
+	b.WriteString("    strs = {name: getattr(s, name) for name, t in s._fields_ if t is ctypes.c_char_p}\n")
+	b.WriteString("    free(ctypes.byref(s))\n")
+	b.WriteString("    for name, v in strs.items():\n        setattr(s, name, v)\n")
+	b.WriteString("    return s\n\n\n")
+
+	for _, e := range m.Enums {
+		writePyEnum(b, py.class[e], e)
+	}
+	for _, s := range m.Structs {
+		fmt.Fprintf(b, "class %s(ctypes.Structure):\n", s.Name)
+		b.WriteString("    _fields_ = [\n")
+		for _, f := range s.Fields {
+			fmt.Fprintf(b, "        (%q, %s),\n", f.Name, pyCTypes[f.C])
+		}
+		b.WriteString("    ]\n\n\n")
+		fmt.Fprintf(b, "_%s = _declare(%q, None, [ctypes.POINTER(%s)])\n\n\n", s.Free, s.Free, s.Name)
+	}
+	for _, cb := range m.Callbacks {
+		ts := []string{"None"}
+		if cb.Ret != "" {
+			ts[0] = pyCTypes[cb.Ret]
+		}
+		var cps, conv []string
+		for _, p := range cb.Params {
+			switch p.Kind {
+			case valString:
+				ts = append(ts, "ctypes.c_char_p")
+				cps = append(cps, p.Name)
+				conv = append(conv, fmt.Sprintf("None if %s is None else %s.decode(\"utf-8\")", p.Name, p.Name))
+			case valBytes:
+				ts = append(ts, "ctypes.c_void_p", "ctypes.c_size_t")
+				cps = append(cps, p.Name, p.Name+"_len")
+				conv = append(conv, fmt.Sprintf("ctypes.string_at(%s, %s_len) if %s else b\"\"", p.Name, p.Name, p.Name))
+			default:
+				ts = append(ts, pyCTypes[p.C])
+				cps = append(cps, p.Name)
+				conv = append(conv, p.Name)
+			}
+		}
+		ts = append(ts, "ctypes.c_void_p")
+		cps = append(cps, "user_data")
+		fmt.Fprintf(b, "%s = ctypes.CFUNCTYPE(%s)\n\n\n", cb.Type, strings.Join(ts, ", "))
+		fmt.Fprintf(b, "def _wrap_%s(fn):\n", cb.Type)
+		fmt.Fprintf(b, "    if fn is None:\n        return %s()  # NULL\n\n", cb.Type)
+		fmt.Fprintf(b, "    def call(%s):\n", strings.Join(cps, ", "))
+		if cb.Ret != "" {
+			fmt.Fprintf(b, "        return fn(%s)\n\n", strings.Join(conv, ", "))
+		} else {
+			fmt.Fprintf(b, "        fn(%s)\n\n", strings.Join(conv, ", "))
+		}
+		fmt.Fprintf(b, "    return %s(call)\n\n\n", cb.Type)
+	}
+	for _, f := range m.Funcs {
+		fmt.Fprintf(b, "_%s = _declare(%q, ctypes.c_int32, [%s])\n", f.Symbol, f.Symbol, strings.Join(py.argtypes(f), ", "))
+	}
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "_%s = _declare(%q, ctypes.c_int32, [ctypes.c_size_t])\n", h.Release, h.Release)
+	}
+	b.WriteString("\n\n")
+
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "class %s:\n", py.class[h])
+		fmt.Fprintf(b, "    \"\"\"%s: an opaque reference to a Go object, released with release() or at the end of a with block.\"\"\"\n\n", h.Type)
+		b.WriteString("    def __init__(self, h):\n        self._h = h\n\n")
+		b.WriteString("    def __int__(self):\n        return self._h\n\n")
+		b.WriteString("    def __enter__(self):\n        return self\n\n")
+		b.WriteString("    def __exit__(self, *exc):\n        self.release()\n\n")
+		b.WriteString("    def release(self):\n")
+		b.WriteString("        h, self._h = self._h, 0\n")
+		fmt.Fprintf(b, "        _check(_%s(h))\n", h.Release)
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writePyFunc(b, py, f, "    ")
+		}
+		b.WriteString("\n\n")
+	}
+	for _, f := range m.Funcs {
+		if f.Recv != nil {
+			continue
+		}
+		writePyFunc(b, py, f, "")
+		b.WriteString("\n\n")
+	}
+}
+
+func writePyEnum(b *bytes.Buffer, name string, e *cEnum) {
+	fmt.Fprintf(b, "class %s(enum.IntEnum):\n", name)
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "    %s = %d\n", pyIdent(v.Name), v.Value)
+	}
+	b.WriteString("\n\n")
+}
+
+// writePyFunc writes the wrapper of an export: a function, or a method of its handle class.
+func writePyFunc(b *bytes.Buffer, py *pyNames, f *cFunc, indent string) {
+	names, args := py.params(f)
+	if f.Recv != nil {
+		names = append([]string{"self"}, names...)
+	}
+	fmt.Fprintf(b, "%sdef %s(%s):\n", indent, py.funcName(f), strings.Join(names, ", "))
+	in := indent + "    "
+	fmt.Fprintf(b, "%s\"\"\"%s\"\"\"\n", in, strings.TrimSuffix(f.cPrototype(), ";"))
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%swarnings.warn(%s, DeprecationWarning, stacklevel=2)\n", in, strconv.Quote(f.Symbol+" is deprecated: "+f.Deprecated))
+	}
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			continue
+		}
+		n := pyIdent(snakeName(p.Name))
+		switch p.Kind {
+		case valBytes:
+			fmt.Fprintf(b, "%s_%s = bytes(%s)\n", in, n, n)
+		case valCallback:
+			fmt.Fprintf(b, "%s_%s = _wrap_%s(%s)\n", in, n, p.C, n)
+		}
+	}
+	r := f.Result
+	if r != nil {
+		switch r.Kind {
+		case valString:
+			fmt.Fprintf(b, "%s_out = ctypes.c_void_p()\n", in)
+		case valBytes:
+			fmt.Fprintf(b, "%s_out = ctypes.c_void_p()\n", in)
+			fmt.Fprintf(b, "%s_out_len = ctypes.c_size_t()\n", in)
+		default:
+			fmt.Fprintf(b, "%s_out = %s()\n", in, py.ctype(*r))
+		}
+		args = append(args, "ctypes.byref(_out)")
+		if r.Kind == valBytes {
+			args = append(args, "ctypes.byref(_out_len)")
+		}
+	}
+	fmt.Fprintf(b, "%s_check(_%s(%s))\n", in, f.Symbol, strings.Join(args, ", "))
+	if r == nil {
+		return
+	}
+	switch r.Kind {
+	case valEnum:
+		fmt.Fprintf(b, "%sreturn %s(_out.value)\n", in, py.class[r.Enum])
+	case valHandle:
+		fmt.Fprintf(b, "%sreturn %s(_out.value) if _out.value else None\n", in, py.class[r.Handle])
+	case valString:
+		fmt.Fprintf(b, "%sreturn _take_str(_out)\n", in)
+	case valBytes:
+		fmt.Fprintf(b, "%sreturn _take_bytes(_out, _out_len)\n", in)
+	case valStruct:
+		fmt.Fprintf(b, "%sreturn _take_struct(_out, _%s)\n", in, r.Struct.Free)
+	default:
+		fmt.Fprintf(b, "%sreturn _out.value\n", in)
+	}
+}
+
+func writePythonStub(b *bytes.Buffer, m *cModel, py *pyNames) {
+	b.WriteString("# Code generated by forgec. DO NOT EDIT.\n")
+	b.WriteString("import ctypes\nimport enum\nfrom typing import Any, Callable, Dict, Optional, Union\n\n")
+	writePyEnum(b, "Status", m.Status)
+	b.WriteString("class ForgecError(Exception):\n")
+	b.WriteString("    status: Union[Status, int]\n")
+	b.WriteString("    record: Dict[str, Any]\n")
+	b.WriteString("    function: str\n")
+	b.WriteString("    def __init__(self, status: int, record: Dict[str, Any]) -> None: ...\n\n")
+	b.WriteString("def last_error() -> Dict[str, Any]: ...\n")
+	b.WriteString("def clear_last_error() -> None: ...\n")
+	b.WriteString("def reporter_configure(name: str, config: Union[str, bytes, Dict[str, Any]]) -> None: ...\n")
+	b.WriteString("def flush(timeout_ms: int = ...) -> bool: ...\n\n")
+	for _, e := range m.Enums {
+		writePyEnum(b, py.class[e], e)
+	}
+	for _, s := range m.Structs {
+		fmt.Fprintf(b, "class %s(ctypes.Structure):\n", s.Name)
+		var kw []string
+		for _, f := range s.Fields {
+			hint := pyScalarHint(f.C)
+			if f.String {
+				hint = "Optional[bytes]"
+			}
+			fmt.Fprintf(b, "    %s: %s\n", f.Name, hint)
+			kw = append(kw, fmt.Sprintf("%s: %s = ...", f.Name, hint))
+		}
+		fmt.Fprintf(b, "    def __init__(self, %s) -> None: ...\n\n", strings.Join(kw, ", "))
+	}
+	for _, cb := range m.Callbacks {
+		fmt.Fprintf(b, "%s: Any\n", cb.Type)
+	}
+	if len(m.Callbacks) > 0 {
+		b.WriteString("\n")
+	}
+	for _, h := range m.Handles {
+		name := py.class[h]
+		fmt.Fprintf(b, "class %s:\n", name)
+		b.WriteString("    def __init__(self, h: int) -> None: ...\n")
+		b.WriteString("    def __int__(self) -> int: ...\n")
+		fmt.Fprintf(b, "    def __enter__(self) -> %s: ...\n", name)
+		b.WriteString("    def __exit__(self, *exc: object) -> None: ...\n")
+		b.WriteString("    def release(self) -> None: ...\n")
+		for _, f := range h.Methods {
+			b.WriteString("    " + py.stubSignature(f) + "\n")
+		}
+		b.WriteString("\n")
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			b.WriteString(py.stubSignature(f) + "\n")
+		}
+	}
+}
+
+// stubSignature renders the .pyi declaration of a wrapper.
+func (py *pyNames) stubSignature(f *cFunc) string {
+	var ps []string
+	if f.Recv != nil {
+		ps = append(ps, "self")
+	}
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			continue
+		}
+		ps = append(ps, pyIdent(snakeName(p.Name))+": "+py.hint(p, false))
+	}
+	ret := "None"
+	if f.Result != nil {
+		ret = py.hint(*f.Result, true)
+	}
+	return fmt.Sprintf("def %s(%s) -> %s: ...", py.funcName(f), strings.Join(ps, ", "), ret)
+}
+
+// pyEnvName upper-cases a library name for an environment variable: my-lib -> MY_LIB.
+func pyEnvName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
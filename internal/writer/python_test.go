@@ -0,0 +1,35 @@
+package writer
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+func TestWritePythonCompiles(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("no python3")
+	}
+	tests := []struct {
+		name string
+		apis func(*testing.T) []*scanner.API
+	}{
+		{"sample", scanSample},
+		{"members", func(*testing.T) []*scanner.API { return memberAPI() }},
+		{"helpers", func(*testing.T) []*scanner.API { return helperAPI() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := generate(t, "python", tt.apis(t))
+			// The module loads the library on import, so it and its stub are only compiled.
+			script := "import sys\nfor p in sys.argv[1:]:\n    compile(open(p).read(), p, 'exec')\n"
+			out, err := exec.Command(python, "-c", script, filepath.Join(dir, "sample.py"), filepath.Join(dir, "sample.pyi")).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,762 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WriteRust writes Rust bindings of the scanned packages to path (e.g., sample.rs), to be
+// included as a module: a sys module with the extern "C" declarations and #[repr(C)] structs,
+// and safe wrappers returning Result<T, ForgecError>. libName is the base name of the shared
+// library built by the build scripts, linked with #[link(name = ...)].
+func WriteRust(path, libName, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	rs := newRustNames(m)
+	if err := rs.check(); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	writeRustFile(&b, m, rs, libName)
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// rustNames spells the model in Rust: PascalCase types, snake_case functions, methods and
+// fields, SCREAMING_SNAKE_CASE enum constants. The sys module keeps the C names.
+type rustNames struct {
+	m    *cModel
+	name map[any]string // *cEnum, *cHandle, *cStruct -> type name
+}
+
+func newRustNames(m *cModel) *rustNames {
+	rs := &rustNames{m: m, name: map[any]string{m.Status: "Status"}}
+	for _, e := range m.Enums {
+		rs.name[e] = pascalName(e.Name)
+	}
+	for _, h := range m.Handles {
+		rs.name[h] = pascalName(h.Name)
+	}
+	for _, s := range m.Structs {
+		rs.name[s] = pascalName(s.Name)
+	}
+	return rs
+}
+
+// check reports Rust type or function names declared twice.
+func (rs *rustNames) check() error {
+	names := newNameSet("rust", false)
+	names.reserve("", "forgec", "ForgecError")
+	names.reserve("", "forgec", rustHelpers...)
+	for k, name := range rs.name {
+		var by string
+		switch v := k.(type) {
+		case *cEnum:
+			by = v.Type
+		case *cHandle:
+			by = v.Type
+		case *cStruct:
+			by = v.Name
+		}
+		if err := names.declare("", name, by); err != nil {
+			return err
+		}
+	}
+	for _, h := range rs.m.Handles {
+		names.reserve(rs.name[h]+"::", "forgec", rustHandleMembers...)
+	}
+	for _, f := range rs.m.Funcs {
+		scope := ""
+		if f.Recv != nil {
+			scope = rs.name[f.Recv] + "::"
+		}
+		if err := names.declare(scope, rs.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rustHelpers are the functions and modules of the generated module; functions of the same name
+// are escaped.
+var rustHelpers = []string{"last_error_json", "clear_last_error", "reporter_configure", "flush", "sys", "rt"}
+
+// rustHandleMembers are declared by every handle type; methods of the same name are escaped.
+var rustHandleMembers = []string{"from_raw", "into_raw", "raw", "release"}
+
+func (rs *rustNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(rustIdent(snakeName(f.Method)), rustHandleMembers)
+	}
+	return memberName(rustIdent(snakeName(f.Name)), rustHelpers)
+}
+
+var rustKeywords = map[string]bool{
+	"as": true, "async": true, "await": true, "break": true, "const": true, "continue": true, "dyn": true,
+	"else": true, "enum": true, "extern": true, "false": true, "fn": true, "for": true, "if": true,
+	"impl": true, "in": true, "let": true, "loop": true, "match": true, "mod": true, "move": true,
+	"mut": true, "pub": true, "ref": true, "return": true, "static": true, "struct": true, "trait": true,
+	"true": true, "type": true, "unsafe": true, "use": true, "where": true, "while": true, "abstract": true,
+	"become": true, "box": true, "do": true, "final": true, "gen": true, "macro": true, "override": true,
+	"priv": true, "try": true, "typeof": true, "unsized": true, "virtual": true, "yield": true,
+}
+
+// rustIdent escapes Rust keywords as raw identifiers; self, super and crate cannot be raw.
+func rustIdent(name string) string {
+	switch {
+	case name == "self" || name == "super" || name == "crate" || name == "Self":
+		return name + "_"
+	case rustKeywords[name]:
+		return "r#" + name
+	}
+	return name
+}
+
+// rustTypes maps C scalar types to Rust.
+var rustTypes = map[string]string{
+	"int8_t":    "i8",
+	"int16_t":   "i16",
+	"int32_t":   "i32",
+	"int64_t":   "i64",
+	"uint8_t":   "u8",
+	"uint16_t":  "u16",
+	"uint32_t":  "u32",
+	"uint64_t":  "u64",
+	"uintptr_t": "usize",
+	"float":     "f32",
+	"double":    "f64",
+	"bool":      "bool",
+}
+
+// sysParams renders the extern "C" parameter list of an export.
+func (rs *rustNames) sysParams(f *cFunc) []string {
+	var ps []string
+	for _, p := range f.Params {
+		n := rustIdent(p.Name)
+		switch p.Kind {
+		case valString:
+			ps = append(ps, n+": *const c_char")
+		case valBytes:
+			ps = append(ps, n+": *const u8", n+"_len: usize")
+		case valStruct:
+			ps = append(ps, n+": *const "+p.C)
+		case valCallback:
+			ps = append(ps, n+": "+p.C, n+"_user_data: *mut c_void")
+		default:
+			ps = append(ps, n+": "+rs.sysType(p))
+		}
+	}
+	if r := f.Result; r != nil {
+		switch r.Kind {
+		case valString:
+			ps = append(ps, "out: *mut *mut c_char")
+		case valBytes:
+			ps = append(ps, "out: *mut *mut u8", "out_len: *mut usize")
+		default:
+			ps = append(ps, "out: *mut "+rs.sysType(*r))
+		}
+	}
+	return ps
+}
+
+// sysType is the sys type of a scalar, enum, handle or struct value.
+func (rs *rustNames) sysType(v cValue) string {
+	switch v.Kind {
+	case valEnum, valHandle, valStruct:
+		return v.C
+	}
+	return rustTypes[v.C]
+}
+
+func writeRustFile(b *bytes.Buffer, m *cModel, rs *rustNames, libName string) {
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n")
+	fmt.Fprintf(b, "//! Rust bindings of the %s library, generated by forgec from the API of forgec.h.\n", libName)
+	b.WriteString("//!\n")
+	b.WriteString("//! `sys` declares the C API as is; the functions and types of this module wrap it, returning\n")
+	b.WriteString("//! `Result<T, ForgecError>` and releasing strings and buffers returned by the library with\n")
+	fmt.Fprintf(b, "//! `capi_free`. The library is linked as `%s`: add its directory to the link search path\n", libName)
+	fmt.Fprintf(b, "//! (e.g., `println!(\"cargo:rustc-link-search=native=dist\")` in build.rs).\n")
+	// Helpers and imports are emitted whether or not this API uses strings, buffers or callbacks.
+	b.WriteString("#![allow(dead_code, unused_imports)]\n\n")
+	b.WriteString("use std::ffi::{c_char, c_void, CString};\n")
+	b.WriteString("use std::fmt;\n\n")
+
+	writeRustEnum(b, "Status", "Status codes returned by the exports; custom codes start at 100.", m.Status)
+	for _, e := range m.Enums {
+		writeRustEnum(b, rs.name[e], "`"+e.Type+"`.", e)
+	}
+
+	b.WriteString("/// The error of an export that returned a non-OK status, read from `capi_last_error_json`.\n")
+	b.WriteString("#[derive(Clone, Debug)]\n")
+	b.WriteString("pub struct ForgecError {\n")
+	b.WriteString("    /// The status returned by the export.\n")
+	b.WriteString("    pub status: Status,\n")
+	b.WriteString("    /// The C name of the failed export, e.g., `PM_Find`.\n")
+	b.WriteString("    pub function: String,\n")
+	b.WriteString("    /// The Go error message.\n")
+	b.WriteString("    pub message: String,\n")
+	b.WriteString("    /// The Go type of the error or panic value.\n")
+	b.WriteString("    pub error_type: String,\n")
+	b.WriteString("    /// The whole error record (see forgec.error.schema.json).\n")
+	b.WriteString("    pub json: String,\n")
+	b.WriteString("}\n\n")
+	b.WriteString("impl ForgecError {\n")
+	b.WriteString("    fn last(status: i32) -> ForgecError {\n")
+	b.WriteString("        let json = last_error_json();\n")
+	b.WriteString("        ForgecError {\n")
+	b.WriteString("            status: Status(status),\n")
+	b.WriteString("            function: rt::json_str(&json, \"function\").unwrap_or_default(),\n")
+	b.WriteString("            message: rt::json_str(&json, \"error\").unwrap_or_default(),\n")
+	b.WriteString("            error_type: rt::json_str(&json, \"type\").unwrap_or_default(),\n")
+	b.WriteString("            json,\n")
+	b.WriteString("        }\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n\n")
+	b.WriteString("impl fmt::Display for ForgecError {\n")
+	b.WriteString("    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {\n")
+	b.WriteString("        write!(f, \"{}: {} ({:?})\", self.function, self.message, self.status)\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n\n")
+	b.WriteString("impl std::error::Error for ForgecError {}\n\n")
+
+	b.WriteString("/// Returns the last error recorded on the calling thread as JSON (`{}` if none).\n")
+	b.WriteString("pub fn last_error_json() -> String {\n")
+	b.WriteString("    let p = unsafe { sys::capi_last_error_json() };\n")
+	b.WriteString("    if p.is_null() {\n        return \"{}\".to_string();\n    }\n")
+	b.WriteString("    unsafe { rt::take_string(p) }\n")
+	b.WriteString("}\n\n")
+	b.WriteString("/// Clears the last error of the calling thread.\n")
+	b.WriteString("pub fn clear_last_error() {\n")
+	b.WriteString("    unsafe { sys::capi_clear_last_error() }\n")
+	b.WriteString("}\n\n")
+	b.WriteString("/// Configures a registered reporter, e.g., `\"jsonl\"` or `\"sentry\"`, with a JSON config.\n")
+	b.WriteString("pub fn reporter_configure(name: &str, config_json: &str) -> Result<(), ForgecError> {\n")
+	b.WriteString("    let name = rt::cstring(\"capi_reporter_configure\", name)?;\n")
+	b.WriteString("    let config_json = rt::cstring(\"capi_reporter_configure\", config_json)?;\n")
+	b.WriteString("    rt::check(unsafe { sys::capi_reporter_configure(name.as_ptr(), config_json.as_ptr()) })\n")
+	b.WriteString("}\n\n")
+	b.WriteString("/// Waits up to `timeout_ms` for reporters to deliver queued reports.\n")
+	b.WriteString("pub fn flush(timeout_ms: u32) -> bool {\n")
+	b.WriteString("    unsafe { sys::capi_flush(timeout_ms) }\n")
+	b.WriteString("}\n\n")
+
+	for _, s := range m.Structs {
+		name := rs.name[s]
+		fmt.Fprintf(b, "/// Owned copy of `%s`.\n", s.Name)
+		b.WriteString("#[derive(Clone, Debug, Default, PartialEq)]\n")
+		fmt.Fprintf(b, "pub struct %s {\n", name)
+		for _, f := range s.Fields {
+			t := rustTypes[f.C]
+			if f.String {
+				t = "String"
+			}
+			fmt.Fprintf(b, "    pub %s: %s,\n", rustIdent(snakeName(f.Name)), t)
+		}
+		b.WriteString("}\n\n")
+		function, keep := "function", "keep"
+		if !structHasString(s) {
+			function, keep = "_function", "_keep"
+		}
+		fmt.Fprintf(b, "impl %s {\n", name)
+		b.WriteString("    // to_sys borrows the strings of the returned struct from keep.\n")
+		fmt.Fprintf(b, "    fn to_sys(&self, %s: &str, %s: &mut Vec<CString>) -> Result<sys::%s, ForgecError> {\n", function, keep, s.Name)
+		fmt.Fprintf(b, "        Ok(sys::%s {\n", s.Name)
+		for _, f := range s.Fields {
+			n := rustIdent(snakeName(f.Name))
+			if f.String {
+				fmt.Fprintf(b, "            %s: rt::keep_cstring(function, &self.%s, keep)?,\n", f.Name, n)
+			} else {
+				fmt.Fprintf(b, "            %s: self.%s,\n", f.Name, n)
+			}
+		}
+		b.WriteString("        })\n")
+		b.WriteString("    }\n\n")
+		b.WriteString("    // take copies a struct returned by the library and releases its strings.\n")
+		fmt.Fprintf(b, "    unsafe fn take(mut v: sys::%s) -> %s {\n", s.Name, name)
+		fmt.Fprintf(b, "        let owned = %s {\n", name)
+		for _, f := range s.Fields {
+			n := rustIdent(snakeName(f.Name))
+			if f.String {
+				fmt.Fprintf(b, "            %s: unsafe { rt::copy_string(v.%s) },\n", n, f.Name)
+			} else {
+				fmt.Fprintf(b, "            %s: v.%s,\n", n, f.Name)
+			}
+		}
+		b.WriteString("        };\n")
+		fmt.Fprintf(b, "        unsafe { sys::%s(&mut v) };\n", s.Free)
+		b.WriteString("        owned\n")
+		b.WriteString("    }\n")
+		b.WriteString("}\n\n")
+	}
+
+	for _, h := range m.Handles {
+		name := rs.name[h]
+		fmt.Fprintf(b, "/// `%s`: an opaque reference to a Go object, released when dropped.\n", h.Type)
+		b.WriteString("#[derive(Debug)]\n")
+		fmt.Fprintf(b, "pub struct %s(usize);\n\n", name)
+		fmt.Fprintf(b, "impl %s {\n", name)
+		b.WriteString("    /// Takes ownership of a raw handle.\n")
+		fmt.Fprintf(b, "    pub fn from_raw(h: usize) -> %s {\n        %s(h)\n    }\n\n", name, name)
+		b.WriteString("    /// Returns the raw handle, which stays owned by `self`.\n")
+		b.WriteString("    pub fn raw(&self) -> usize {\n        self.0\n    }\n\n")
+		b.WriteString("    /// Gives up ownership of the raw handle without releasing it.\n")
+		b.WriteString("    pub fn into_raw(self) -> usize {\n        let h = self.0;\n        std::mem::forget(self);\n        h\n    }\n\n")
+		b.WriteString("    /// Releases the handle, reporting an invalid one (dropping ignores the error).\n")
+		b.WriteString("    pub fn release(self) -> Result<(), ForgecError> {\n")
+		b.WriteString("        let h = self.into_raw();\n")
+		fmt.Fprintf(b, "        rt::check(unsafe { sys::%s(h) })\n", h.Release)
+		b.WriteString("    }\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writeRustFunc(b, rs, f, "    ")
+		}
+		b.WriteString("}\n\n")
+		fmt.Fprintf(b, "impl Drop for %s {\n", name)
+		b.WriteString("    fn drop(&mut self) {\n")
+		fmt.Fprintf(b, "        unsafe { sys::%s(self.0) };\n", h.Release)
+		b.WriteString("    }\n")
+		b.WriteString("}\n\n")
+	}
+
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			writeRustFunc(b, rs, f, "")
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("/// The C API of forgec.h.\n")
+	b.WriteString("#[allow(non_camel_case_types, non_snake_case)]\n")
+	b.WriteString("pub mod sys {\n")
+	b.WriteString("    use std::ffi::{c_char, c_void};\n\n")
+	for _, e := range m.Enums {
+		fmt.Fprintf(b, "    pub type %s = super::%s;\n", e.Type, rs.name[e])
+	}
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "    pub type %s = usize;\n", h.Type)
+	}
+	for _, s := range m.Structs {
+		b.WriteString("\n    #[repr(C)]\n    #[derive(Clone, Copy, Debug)]\n")
+		fmt.Fprintf(b, "    pub struct %s {\n", s.Name)
+		for _, f := range s.Fields {
+			t := rustTypes[f.C]
+			if f.String {
+				t = "*const c_char"
+			}
+			fmt.Fprintf(b, "        pub %s: %s,\n", f.Name, t)
+		}
+		b.WriteString("    }\n")
+	}
+	if len(m.Callbacks) > 0 {
+		b.WriteString("\n")
+	}
+	for _, cb := range m.Callbacks {
+		ps := rustCallbackParams(cb)
+		ret := ""
+		if cb.Ret != "" {
+			ret = " -> " + rustTypes[cb.Ret]
+		}
+		fmt.Fprintf(b, "    pub type %s = Option<unsafe extern \"C\" fn(%s)%s>;\n", cb.Type, strings.Join(ps, ", "), ret)
+	}
+	fmt.Fprintf(b, "\n    #[link(name = %s)]\n", strconv.Quote(libName))
+	b.WriteString("    unsafe extern \"C\" {\n")
+	b.WriteString("        pub fn capi_free(p: *mut c_void);\n")
+	b.WriteString("        pub fn capi_last_error_json() -> *mut c_char;\n")
+	b.WriteString("        pub fn capi_clear_last_error();\n")
+	b.WriteString("        pub fn capi_reporter_configure(name: *const c_char, config: *const c_char) -> i32;\n")
+	b.WriteString("        pub fn capi_flush(timeout_ms: u32) -> bool;\n")
+	for _, s := range m.Structs {
+		fmt.Fprintf(b, "        pub fn %s(v: *mut %s);\n", s.Free, s.Name)
+	}
+	for _, h := range m.Handles {
+		fmt.Fprintf(b, "        pub fn %s(h: %s) -> i32;\n", h.Release, h.Type)
+	}
+	for _, f := range m.Funcs {
+		fmt.Fprintf(b, "        pub fn %s(%s) -> i32;\n", f.Symbol, strings.Join(rs.sysParams(f), ", "))
+	}
+	b.WriteString("    }\n")
+	b.WriteString("}\n\n")
+	b.WriteString(rustRuntime)
+}
+
+func structHasString(s *cStruct) bool {
+	for _, f := range s.Fields {
+		if f.String {
+			return true
+		}
+	}
+	return false
+}
+
+// rustCallbackParams renders the C parameter list of a callback typedef.
+func rustCallbackParams(cb *cCallback) []string {
+	var ps []string
+	for _, p := range cb.Params {
+		n := rustIdent(p.Name)
+		switch p.Kind {
+		case valString:
+			ps = append(ps, n+": *const c_char")
+		case valBytes:
+			ps = append(ps, n+": *const u8", n+"_len: usize")
+		default:
+			ps = append(ps, n+": "+rustTypes[p.C])
+		}
+	}
+	return append(ps, "user_data: *mut c_void")
+}
+
+func writeRustEnum(b *bytes.Buffer, name, doc string, e *cEnum) {
+	fmt.Fprintf(b, "/// %s\n", doc)
+	b.WriteString("#[repr(transparent)]\n")
+	b.WriteString("#[derive(Clone, Copy, Default, PartialEq, Eq, Hash)]\n")
+	fmt.Fprintf(b, "pub struct %s(pub i32);\n\n", name)
+	fmt.Fprintf(b, "impl %s {\n", name)
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "    pub const %s: %s = %s(%d);\n", strings.ToUpper(snakeName(v.Name)), name, name, v.Value)
+	}
+	b.WriteString("}\n\n")
+	fmt.Fprintf(b, "impl fmt::Debug for %s {\n", name)
+	b.WriteString("    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {\n")
+	b.WriteString("        match self.0 {\n")
+	seen := map[int64]bool{}
+	for _, v := range e.Values {
+		if seen[v.Value] {
+			continue
+		}
+		seen[v.Value] = true
+		fmt.Fprintf(b, "            %d => f.write_str(%q),\n", v.Value, strings.ToUpper(snakeName(v.Name)))
+	}
+	fmt.Fprintf(b, "            n => write!(f, \"%s({})\", n),\n", name)
+	b.WriteString("        }\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n\n")
+}
+
+// rustParamType is the wrapper type of a param; callbacks are generic (see rustCallbackBound).
+func (rs *rustNames) paramType(p cValue) string {
+	switch p.Kind {
+	case valEnum:
+		return rs.name[p.Enum]
+	case valHandle:
+		return "&" + rs.name[p.Handle]
+	case valString:
+		return "&str"
+	case valBytes:
+		return "&[u8]"
+	case valStruct:
+		return "&" + rs.name[p.Struct]
+	case valCallback:
+		return pascalName(p.Name) + "Fn"
+	}
+	return rustTypes[p.C]
+}
+
+func (rs *rustNames) resultType(r *cValue) string {
+	if r == nil {
+		return "()"
+	}
+	switch r.Kind {
+	case valEnum:
+		return rs.name[r.Enum]
+	case valHandle:
+		return "Option<" + rs.name[r.Handle] + ">"
+	case valString:
+		return "String"
+	case valBytes:
+		return "Vec<u8>"
+	case valStruct:
+		return rs.name[r.Struct]
+	}
+	return rustTypes[r.C]
+}
+
+// rustCallbackBound renders the FnMut bound of a callback param.
+func rustCallbackBound(cb *cCallback) string {
+	var ts []string
+	for _, p := range cb.Params {
+		switch p.Kind {
+		case valString:
+			ts = append(ts, "&str")
+		case valBytes:
+			ts = append(ts, "&[u8]")
+		default:
+			ts = append(ts, rustTypes[p.C])
+		}
+	}
+	s := "FnMut(" + strings.Join(ts, ", ") + ")"
+	if cb.Ret != "" {
+		s += " -> " + rustTypes[cb.Ret]
+	}
+	return s
+}
+
+// writeRustFunc writes the wrapper of an export: a function, or a method of its handle type.
+func writeRustFunc(b *bytes.Buffer, rs *rustNames, f *cFunc, indent string) {
+	in := indent + "    "
+	var ps, generics, args, pre, tramps []string
+	var keep bool
+	if f.Recv != nil {
+		ps = append(ps, "&self")
+	}
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "self.0")
+			continue
+		}
+		n := rustIdent(snakeName(p.Name))
+		switch p.Kind {
+		case valCallback:
+			g := rs.paramType(p)
+			generics = append(generics, g+": "+rustCallbackBound(p.Callback))
+			ps = append(ps, "mut "+n+": "+g)
+			tramp := snakeName(p.Name) + "_trampoline"
+			tramps = append(tramps, rustTrampoline(p.Callback, tramp, g, in))
+			args = append(args, fmt.Sprintf("Some(%s::<%s>)", tramp, g), fmt.Sprintf("&mut %s as *mut %s as *mut c_void", n, g))
+			continue
+		}
+		ps = append(ps, n+": "+rs.paramType(p))
+		switch p.Kind {
+		case valHandle:
+			args = append(args, n+".0")
+		case valString:
+			pre = append(pre, fmt.Sprintf("let %s = rt::cstring(%q, %s)?;", n, f.Symbol, n))
+			args = append(args, n+".as_ptr()")
+		case valBytes:
+			args = append(args, n+".as_ptr()", n+".len()")
+		case valStruct:
+			keep = true
+			pre = append(pre, fmt.Sprintf("let %s = %s.to_sys(%q, &mut keep)?;", n, n, f.Symbol))
+			args = append(args, "&"+n)
+		default:
+			args = append(args, n)
+		}
+	}
+	r := f.Result
+	if r != nil {
+		switch r.Kind {
+		case valString:
+			pre = append(pre, "let mut out: *mut c_char = std::ptr::null_mut();")
+		case valBytes:
+			pre = append(pre, "let mut out: *mut u8 = std::ptr::null_mut();", "let mut out_len: usize = 0;")
+		case valStruct:
+			pre = append(pre, fmt.Sprintf("let mut out: sys::%s = unsafe { std::mem::zeroed() };", r.C))
+		case valHandle:
+			pre = append(pre, "let mut out: usize = 0;")
+		default:
+			pre = append(pre, fmt.Sprintf("let mut out: %s = Default::default();", rs.resultType(r)))
+		}
+		args = append(args, "&mut out")
+		if r.Kind == valBytes {
+			args = append(args, "&mut out_len")
+		}
+	}
+	if keep {
+		pre = append([]string{"let mut keep = Vec::new();"}, pre...)
+	}
+
+	fmt.Fprintf(b, "%s/// `%s`\n", indent, strings.TrimSuffix(f.cPrototype(), ";"))
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%s#[deprecated(note = %s)]\n", indent, strconv.Quote(f.Deprecated))
+	}
+	gen := ""
+	if len(generics) > 0 {
+		gen = "<" + strings.Join(generics, ", ") + ">"
+	}
+	fmt.Fprintf(b, "%spub fn %s%s(%s) -> Result<%s, ForgecError> {\n", indent, rs.funcName(f), gen, strings.Join(ps, ", "), rs.resultType(r))
+	for _, t := range tramps {
+		b.WriteString(t)
+	}
+	for _, s := range pre {
+		fmt.Fprintf(b, "%s%s\n", in, s)
+	}
+	call := fmt.Sprintf("rt::check(unsafe { sys::%s(%s) })", f.Symbol, strings.Join(args, ", "))
+	if r == nil {
+		fmt.Fprintf(b, "%s%s\n", in, call)
+		fmt.Fprintf(b, "%s}\n", indent)
+		return
+	}
+	fmt.Fprintf(b, "%s%s?;\n", in, call)
+	switch r.Kind {
+	case valHandle:
+		fmt.Fprintf(b, "%sOk(if out == 0 { None } else { Some(%s(out)) })\n", in, rs.name[r.Handle])
+	case valString:
+		fmt.Fprintf(b, "%sOk(unsafe { rt::take_string(out) })\n", in)
+	case valBytes:
+		fmt.Fprintf(b, "%sOk(unsafe { rt::take_bytes(out, out_len) })\n", in)
+	case valStruct:
+		fmt.Fprintf(b, "%sOk(unsafe { %s::take(out) })\n", in, rs.name[r.Struct])
+	default:
+		fmt.Fprintf(b, "%sOk(out)\n", in)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// rustTrampoline renders the extern "C" function calling the closure passed as user data.
+func rustTrampoline(cb *cCallback, name, g, in string) string {
+	var b strings.Builder
+	var args []string
+	for _, p := range cb.Params {
+		n := rustIdent(p.Name)
+		switch p.Kind {
+		case valString:
+			args = append(args, "&unsafe { rt::copy_string("+n+") }")
+		case valBytes:
+			args = append(args, "unsafe { rt::slice("+n+", "+n+"_len) }")
+		default:
+			args = append(args, n)
+		}
+	}
+	ret := ""
+	if cb.Ret != "" {
+		ret = " -> " + rustTypes[cb.Ret]
+	}
+	fmt.Fprintf(&b, "%sunsafe extern \"C\" fn %s<%s: %s>(%s)%s {\n", in, name, g, rustCallbackBound(cb), strings.Join(rustCallbackParams(cb), ", "), ret)
+	fmt.Fprintf(&b, "%s    let f = unsafe { &mut *(user_data as *mut %s) };\n", in, g)
+	fmt.Fprintf(&b, "%s    f(%s)\n", in, strings.Join(args, ", "))
+	fmt.Fprintf(&b, "%s}\n", in)
+	return b.String()
+}
+
+// rustRuntime is the private helper module of the generated bindings.
+const rustRuntime = `mod rt {
+    use super::{sys, ForgecError, Status};
+    use std::ffi::{c_char, c_void, CStr, CString};
+
+    pub fn check(status: i32) -> Result<(), ForgecError> {
+        if status == 0 {
+            Ok(())
+        } else {
+            Err(ForgecError::last(status))
+        }
+    }
+
+    fn nul_error(function: &str) -> ForgecError {
+        ForgecError {
+            status: Status::INVALID_ARGUMENT,
+            function: function.to_string(),
+            message: "string contains a NUL byte".to_string(),
+            error_type: String::new(),
+            json: String::new(),
+        }
+    }
+
+    pub fn cstring(function: &str, s: &str) -> Result<CString, ForgecError> {
+        CString::new(s).map_err(|_| nul_error(function))
+    }
+
+    // keep_cstring returns a pointer to a copy of s that lives as long as keep.
+    pub fn keep_cstring(function: &str, s: &str, keep: &mut Vec<CString>) -> Result<*const c_char, ForgecError> {
+        let c = cstring(function, s)?;
+        let p = c.as_ptr();
+        keep.push(c);
+        Ok(p)
+    }
+
+    pub unsafe fn copy_string(p: *const c_char) -> String {
+        if p.is_null() {
+            return String::new();
+        }
+        unsafe { CStr::from_ptr(p) }.to_string_lossy().into_owned()
+    }
+
+    pub unsafe fn slice<'a>(p: *const u8, n: usize) -> &'a [u8] {
+        if p.is_null() {
+            return &[];
+        }
+        unsafe { std::slice::from_raw_parts(p, n) }
+    }
+
+    pub unsafe fn take_string(p: *mut c_char) -> String {
+        let s = unsafe { copy_string(p) };
+        unsafe { sys::capi_free(p as *mut c_void) };
+        s
+    }
+
+    pub unsafe fn take_bytes(p: *mut u8, n: usize) -> Vec<u8> {
+        let v = unsafe { slice(p, n) }.to_vec();
+        unsafe { sys::capi_free(p as *mut c_void) };
+        v
+    }
+
+    // json_str returns a top-level string field of a JSON object, such as the "function" and
+    // "error" of an error record, without depending on a JSON crate.
+    pub fn json_str(json: &str, key: &str) -> Option<String> {
+        let b = json.as_bytes();
+        let mut depth = 0;
+        let mut i = 0;
+        while i < b.len() {
+            match b[i] {
+                b'{' | b'[' => depth += 1,
+                b'}' | b']' => depth -= 1,
+                b'"' => {
+                    let (s, next) = json_string(json, i)?;
+                    let rest = json[next..].trim_start();
+                    if depth == 1 && s == key && rest.starts_with(':') {
+                        let value = rest[1..].trim_start();
+                        return if value.starts_with('"') {
+                            json_string(value, 0).map(|(v, _)| v)
+                        } else {
+                            None
+                        };
+                    }
+                    i = next;
+                    continue;
+                }
+                _ => {}
+            }
+            i += 1;
+        }
+        None
+    }
+
+    // json_string decodes the JSON string starting at the quote at start and returns it with
+    // the offset after its closing quote.
+    fn json_string(json: &str, start: usize) -> Option<(String, usize)> {
+        let mut out = String::new();
+        let mut chars = json[start + 1..].char_indices();
+        while let Some((i, c)) = chars.next() {
+            match c {
+                '"' => return Some((out, start + 1 + i + 1)),
+                '\\' => match chars.next()?.1 {
+                    'b' => out.push('\u{8}'),
+                    'f' => out.push('\u{c}'),
+                    'n' => out.push('\n'),
+                    'r' => out.push('\r'),
+                    't' => out.push('\t'),
+                    'u' => {
+                        let mut cp = hex4(&mut chars)?;
+                        if (0xD800..0xDC00).contains(&cp) {
+                            if chars.next()?.1 != '\\' || chars.next()?.1 != 'u' {
+                                return None;
+                            }
+                            let lo = hex4(&mut chars)?;
+                            cp = 0x10000 + ((cp - 0xD800) << 10) + lo.wrapping_sub(0xDC00);
+                        }
+                        out.push(char::from_u32(cp).unwrap_or('\u{fffd}'));
+                    }
+                    e => out.push(e),
+                },
+                c => out.push(c),
+            }
+        }
+        None
+    }
+
+    fn hex4(chars: &mut std::str::CharIndices<'_>) -> Option<u32> {
+        let mut v = 0;
+        for _ in 0..4 {
+            v = v * 16 + chars.next()?.1.to_digit(16)?;
+        }
+        Some(v)
+    }
+}
+`
@@ -0,0 +1,602 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+// WriteSwift writes a Swift package wrapping the scanned packages into dir:
+//
+//	Package.swift
+//	Sources/C<Name>/module.modulemap  system library module of forgec.h, linking lib<name>
+//	Sources/C<Name>/forgec.h
+//	Sources/<Name>/<Name>.swift       throwing wrappers and Swift structs
+//
+// libName is the base name of the shared library built by the build scripts.
+func WriteSwift(dir, libName, cPrefix string, apis []*scanner.API) error {
+	m, err := newModel(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+	s := newSwiftNames(m)
+	if err := s.check(); err != nil {
+		return err
+	}
+	header, err := renderHeader(cPrefix, apis, nil)
+	if err != nil {
+		return err
+	}
+	name := swiftModuleName(libName)
+	cModule := "C" + name
+	var pkg, modulemap, src bytes.Buffer
+	writeSwiftPackage(&pkg, name, cModule)
+	fmt.Fprintf(&modulemap, "module %s [system] {\n    header \"forgec.h\"\n    link %q\n    export *\n}\n", cModule, libName)
+	writeSwiftSource(&src, m, s, libName, cModule)
+	files := []struct {
+		path string
+		data []byte
+	}{
+		{"Package.swift", pkg.Bytes()},
+		{filepath.Join("Sources", cModule, "module.modulemap"), modulemap.Bytes()},
+		{filepath.Join("Sources", cModule, "forgec.h"), header},
+		{filepath.Join("Sources", name, name+".swift"), src.Bytes()},
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, f.path)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return fmt.Errorf("mkdir %s: %w", filepath.Dir(p), err)
+		}
+		if err := os.WriteFile(p, f.data, 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// swiftModuleName derives a module name from a library name: my-lib -> MyLib.
+func swiftModuleName(libName string) string {
+	n := pascalName(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, libName))
+	if n == "" || unicode.IsDigit(rune(n[0])) {
+		n = "Lib" + n
+	}
+	return n
+}
+
+func writeSwiftPackage(b *bytes.Buffer, name, cModule string) {
+	b.WriteString("// swift-tools-version:5.9\n")
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n\n")
+	b.WriteString("import PackageDescription\n\n")
+	b.WriteString("let package = Package(\n")
+	fmt.Fprintf(b, "    name: %q,\n", name)
+	fmt.Fprintf(b, "    products: [.library(name: %q, targets: [%q])],\n", name, name)
+	b.WriteString("    targets: [\n")
+	fmt.Fprintf(b, "        .systemLibrary(name: %q, path: %q),\n", cModule, "Sources/"+cModule)
+	fmt.Fprintf(b, "        .target(name: %q, dependencies: [%q]),\n", name, cModule)
+	b.WriteString("    ]\n")
+	b.WriteString(")\n")
+}
+
+// swiftNames spells the model in Swift: PascalCase types, camelCase functions, methods, labels,
+// properties and constants. The C declarations keep their names, qualified by the C module
+// where a Swift type has the same name.
+type swiftNames struct {
+	m    *cModel
+	name map[any]string // *cEnum, *cHandle, *cStruct, *cCallback -> type name
+}
+
+func newSwiftNames(m *cModel) *swiftNames {
+	s := &swiftNames{m: m, name: map[any]string{m.Status: "Status"}}
+	for _, e := range m.Enums {
+		s.name[e] = pascalName(e.Name)
+	}
+	for _, h := range m.Handles {
+		s.name[h] = pascalName(h.Name)
+	}
+	for _, st := range m.Structs {
+		s.name[st] = pascalName(st.Name)
+	}
+	for _, cb := range m.Callbacks {
+		s.name[cb] = pascalName(strings.TrimPrefix(cb.Type, m.Prefix))
+	}
+	return s
+}
+
+// check reports Swift names declared twice in the module or in a type.
+func (s *swiftNames) check() error {
+	names := newNameSet("swift", false)
+	names.reserve("", "forgec", "ForgecError")
+	names.reserve("", "forgec", swiftModuleHelpers...)
+	for k, name := range s.name {
+		switch v := k.(type) {
+		case *cEnum:
+			if err := names.declare("", name, v.Type); err != nil {
+				return err
+			}
+			names.reserve(name+".", v.Type, "rawValue", "description")
+			for _, ev := range v.Values {
+				if err := names.declare(name+".", camelName(ev.Name), ev.C); err != nil {
+					return err
+				}
+			}
+		case *cHandle:
+			if err := names.declare("", name, v.Type); err != nil {
+				return err
+			}
+			names.reserve(name+".", v.Type, swiftHandleMembers...)
+		case *cStruct:
+			if err := names.declare("", name, v.Name); err != nil {
+				return err
+			}
+			names.reserve(name+".", "forgec", append([]string{"c"}, swiftHelpers...)...)
+			for _, f := range v.Fields {
+				if err := names.declare(name+".", camelName(f.Name), v.Name+"."+f.Name); err != nil {
+					return err
+				}
+			}
+		case *cCallback:
+			if err := names.declare("", name, v.Type); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range s.m.Funcs {
+		scope := ""
+		if f.Recv != nil {
+			scope = s.name[f.Recv] + "."
+		}
+		if err := names.declare(scope, s.funcName(f), f.Symbol); err != nil {
+			return err
+		}
+		// Parameters share the wrapper body with its locals.
+		local := f.Symbol + "."
+		names.reserve(local, "forgec", "out", "outLen", "strings", "handle")
+		for i, p := range f.Params {
+			if i == 0 && f.Recv != nil {
+				continue
+			}
+			ns := []string{camelName(p.Name)}
+			switch p.Kind {
+			case valStruct:
+				ns = append(ns, "c"+pascalName(p.Name))
+			case valCallback:
+				ns = append(ns, camelName(p.Name)+"Box")
+			}
+			for _, n := range ns {
+				if err := names.declare(local, n, f.Symbol+" parameter "+p.Name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// swiftHelpers are the private helpers of the generated file, which a member of the same
+// name would shadow.
+var swiftHelpers = []string{"check", "string", "bytes", "takeString", "takeBytes", "CStrings", "CallbackBox"}
+
+// swiftModuleHelpers are the public functions and private helpers of the generated file;
+// functions of the same name are escaped.
+var swiftModuleHelpers = append([]string{"lastErrorJSON", "clearLastError", "reporterConfigure", "flush"}, swiftHelpers...)
+
+// swiftHandleMembers are declared by every handle class or shadowed by its methods; methods of
+// the same name are escaped.
+var swiftHandleMembers = append([]string{"handle", "release"}, swiftHelpers...)
+
+func (s *swiftNames) funcName(f *cFunc) string {
+	if f.Recv != nil {
+		return memberName(camelName(f.Method), swiftHandleMembers)
+	}
+	return memberName(camelName(f.Name), swiftModuleHelpers)
+}
+
+// swiftKeywords are the Swift keywords that must be escaped with backticks to name a value.
+var swiftKeywords = map[string]bool{
+	"associatedtype": true, "class": true, "deinit": true, "enum": true, "extension": true, "fileprivate": true,
+	"func": true, "import": true, "init": true, "inout": true, "internal": true, "let": true, "open": true,
+	"operator": true, "private": true, "protocol": true, "public": true, "rethrows": true, "static": true,
+	"struct": true, "subscript": true, "typealias": true, "var": true, "break": true, "case": true,
+	"continue": true, "default": true, "defer": true, "do": true, "else": true, "fallthrough": true,
+	"for": true, "guard": true, "if": true, "in": true, "repeat": true, "return": true, "switch": true,
+	"where": true, "while": true, "as": true, "catch": true, "false": true, "is": true, "nil": true,
+	"self": true, "Self": true, "super": true, "throw": true, "throws": true, "true": true, "try": true,
+	"Any": true, "Type": true,
+}
+
+// swiftIdent escapes Swift keywords with backticks.
+func swiftIdent(name string) string {
+	if swiftKeywords[name] {
+		return "`" + name + "`"
+	}
+	return name
+}
+
+// swiftTypes maps C scalar types to the Swift types the C importer gives them.
+var swiftTypes = map[string]string{
+	"int8_t":    "Int8",
+	"int16_t":   "Int16",
+	"int32_t":   "Int32",
+	"int64_t":   "Int64",
+	"uint8_t":   "UInt8",
+	"uint16_t":  "UInt16",
+	"uint32_t":  "UInt32",
+	"uint64_t":  "UInt64",
+	"uintptr_t": "UInt",
+	"float":     "Float",
+	"double":    "Double",
+	"bool":      "Bool",
+}
+
+// swiftType is the type of a value in the Swift API.
+func (s *swiftNames) swiftType(v cValue) string {
+	switch v.Kind {
+	case valEnum:
+		return s.name[v.Enum]
+	case valHandle:
+		return s.name[v.Handle]
+	case valString:
+		return "String"
+	case valBytes:
+		return "[UInt8]"
+	case valStruct:
+		return s.name[v.Struct]
+	case valCallback:
+		return s.name[v.Callback]
+	}
+	return swiftTypes[v.C]
+}
+
+// swiftZero is the default value of a struct field.
+func swiftZero(t string) string {
+	switch t {
+	case "String":
+		return `""`
+	case "Bool":
+		return "false"
+	}
+	return "0"
+}
+
+func writeSwiftSource(b *bytes.Buffer, m *cModel, s *swiftNames, libName, cModule string) {
+	b.WriteString("// Code generated by forgec. DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "// Swift wrappers of the %s library. %s declares forgec.h; the functions here return the\n", libName, cModule)
+	b.WriteString("// out-param and throw ForgecError on a non-OK status.\n\n")
+	fmt.Fprintf(b, "import %s\n", cModule)
+	b.WriteString("import Foundation\n\n")
+
+	writeSwiftConstants(b, "Status", "Status codes returned by the exports; custom codes start at 100.", m.Status)
+	for _, e := range m.Enums {
+		writeSwiftConstants(b, s.name[e], "`"+e.Type+"` values.", e)
+	}
+
+	b.WriteString(`/// Thrown when an export returns a non-OK status. ` + "`record`" + ` is the decoded
+/// ` + "`capi_last_error_json`" + ` record (see forgec.error.schema.json).
+public struct ForgecError: Error, CustomStringConvertible {
+    /// The status returned by the export.
+    public let status: Status
+    /// The error record as JSON.
+    public let json: String
+    /// The decoded error record, including wrapped errors and panic stacks.
+    public let record: [String: Any]
+
+    public init(status: Status, json: String) {
+        self.status = status
+        self.json = json
+        let object = try? JSONSerialization.jsonObject(with: Data(json.utf8))
+        self.record = object as? [String: Any] ?? [:]
+    }
+
+    /// The C name of the failed export, e.g., PM_Find.
+    public var function: String { record["function"] as? String ?? "" }
+
+    /// The Go error message.
+    public var message: String { record["error"] as? String ?? "" }
+
+    /// The Go type of the error or panic value.
+    public var errorType: String { record["type"] as? String ?? "" }
+
+    public var description: String { "\(function): \(message) (\(status))" }
+}
+
+/// Returns the last error recorded on the calling thread as JSON ("{}" if none).
+public func lastErrorJSON() -> String {
+    guard let p = capi_last_error_json() else {
+        return "{}"
+    }
+    defer { capi_free(UnsafeMutableRawPointer(mutating: p)) }
+    return String(cString: p)
+}
+
+public func clearLastError() {
+    capi_clear_last_error()
+}
+
+/// Configures a registered reporter, e.g., "jsonl" or "sentry".
+public func reporterConfigure(name: String, config: String) throws {
+    try check(capi_reporter_configure(name, config))
+}
+
+/// Waits up to timeoutMs for reporters to deliver queued reports.
+@discardableResult
+public func flush(timeoutMs: UInt32) -> Bool {
+    capi_flush(timeoutMs)
+}
+
+`)
+
+	for _, st := range m.Structs {
+		name := s.name[st]
+		fmt.Fprintf(b, "/// A copy of the C struct `%s`.\n", st.Name)
+		fmt.Fprintf(b, "public struct %s: Equatable {\n", name)
+		var ps, as []string
+		for _, f := range st.Fields {
+			t := swiftTypes[f.C]
+			if f.String {
+				t = "String"
+			}
+			n := swiftIdent(camelName(f.Name))
+			fmt.Fprintf(b, "    public var %s: %s\n", n, t)
+			ps = append(ps, fmt.Sprintf("%s: %s = %s", n, t, swiftZero(t)))
+			as = append(as, fmt.Sprintf("        self.%s = %s\n", n, n))
+		}
+		fmt.Fprintf(b, "\n    public init(%s) {\n%s    }\n", strings.Join(ps, ", "), strings.Join(as, ""))
+		b.WriteString("\n    // init(taking:) copies a struct returned by the library and releases its strings.\n")
+		fmt.Fprintf(b, "    fileprivate init(taking c: inout %s.%s) {\n", cModule, st.Name)
+		for _, f := range st.Fields {
+			v := "c." + f.Name
+			if f.String {
+				v = "string(" + v + ")"
+			}
+			fmt.Fprintf(b, "        self.%s = %s\n", swiftIdent(camelName(f.Name)), v)
+		}
+		fmt.Fprintf(b, "        %s(&c)\n", st.Free)
+		b.WriteString("    }\n\n")
+		fmt.Fprintf(b, "    fileprivate func c(_ strings: CStrings) -> %s.%s {\n", cModule, st.Name)
+		fmt.Fprintf(b, "        var c = %s.%s()\n", cModule, st.Name)
+		for _, f := range st.Fields {
+			v := "self." + swiftIdent(camelName(f.Name))
+			if f.String {
+				v = "strings.dup(" + v + ")"
+			}
+			fmt.Fprintf(b, "        c.%s = %s\n", f.Name, v)
+		}
+		b.WriteString("        return c\n")
+		b.WriteString("    }\n")
+		b.WriteString("}\n\n")
+	}
+
+	for _, cb := range m.Callbacks {
+		var ts []string
+		for _, p := range cb.Params {
+			switch p.Kind {
+			case valString:
+				ts = append(ts, "String")
+			case valBytes:
+				ts = append(ts, "[UInt8]")
+			default:
+				ts = append(ts, swiftTypes[p.C])
+			}
+		}
+		ret := "Void"
+		if cb.Ret != "" {
+			ret = swiftTypes[cb.Ret]
+		}
+		fmt.Fprintf(b, "/// The Swift side of `%s`, called while the export runs.\n", cb.Type)
+		fmt.Fprintf(b, "public typealias %s = (%s) -> %s\n\n", s.name[cb], strings.Join(ts, ", "), ret)
+	}
+
+	for _, h := range m.Handles {
+		name := s.name[h]
+		fmt.Fprintf(b, "/// `%s`: an opaque reference to a Go object, released by `release()` or when the\n", h.Type)
+		b.WriteString("/// object is deinitialized.\n")
+		fmt.Fprintf(b, "public final class %s {\n", name)
+		b.WriteString("    /// The raw handle; 0 once released.\n")
+		fmt.Fprintf(b, "    public private(set) var handle: %s\n\n", h.Type)
+		fmt.Fprintf(b, "    public init(handle: %s) {\n        self.handle = handle\n    }\n\n", h.Type)
+		b.WriteString("    deinit {\n")
+		fmt.Fprintf(b, "        if handle != 0 {\n            _ = %s(handle)\n        }\n", h.Release)
+		b.WriteString("    }\n\n")
+		b.WriteString("    public func release() throws {\n")
+		b.WriteString("        guard handle != 0 else {\n            return\n        }\n")
+		b.WriteString("        let h = handle\n")
+		b.WriteString("        handle = 0\n")
+		fmt.Fprintf(b, "        try check(%s(h))\n", h.Release)
+		b.WriteString("    }\n")
+		for _, f := range h.Methods {
+			b.WriteString("\n")
+			writeSwiftFunc(b, s, f, cModule, "    ")
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, f := range m.Funcs {
+		if f.Recv == nil {
+			writeSwiftFunc(b, s, f, cModule, "")
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString(`private func check(_ status: Int32) throws {
+    if status != 0 {
+        throw ForgecError(status: Status(rawValue: status), json: lastErrorJSON())
+    }
+}
+
+private func string(_ p: UnsafePointer<CChar>?) -> String {
+    p.map { String(cString: $0) } ?? ""
+}
+
+private func bytes(_ p: UnsafePointer<UInt8>?, _ n: Int) -> [UInt8] {
+    p.map { Array(UnsafeBufferPointer(start: $0, count: n)) } ?? []
+}
+
+private func takeString(_ p: UnsafeMutablePointer<CChar>?) -> String {
+    defer { capi_free(p) }
+    return string(p)
+}
+
+private func takeBytes(_ p: UnsafeMutablePointer<UInt8>?, _ n: Int) -> [UInt8] {
+    defer { capi_free(p) }
+    return bytes(p, n)
+}
+
+/// CStrings keeps C copies of the strings of struct arguments until the call returns.
+private final class CStrings {
+    private var copies: [UnsafeMutablePointer<CChar>] = []
+
+    func dup(_ s: String) -> UnsafePointer<CChar> {
+        let p = strdup(s)!
+        copies.append(p)
+        return UnsafePointer(p)
+    }
+
+    deinit {
+        copies.forEach { free($0) }
+    }
+}
+
+/// CallbackBox passes a Swift closure to a C callback through its user_data.
+private final class CallbackBox<F> {
+    let fn: F
+
+    init(_ fn: F) {
+        self.fn = fn
+    }
+}
+`)
+}
+
+// writeSwiftConstants writes a C enum as a RawRepresentable struct of static constants, so
+// values unknown to the bindings (e.g., combined flags or new status codes) stay representable.
+func writeSwiftConstants(b *bytes.Buffer, name, doc string, e *cEnum) {
+	fmt.Fprintf(b, "/// %s\n", doc)
+	fmt.Fprintf(b, "public struct %s: RawRepresentable, Hashable, CustomStringConvertible {\n", name)
+	b.WriteString("    public var rawValue: Int32\n\n")
+	b.WriteString("    public init(rawValue: Int32) {\n        self.rawValue = rawValue\n    }\n\n")
+	for _, v := range e.Values {
+		fmt.Fprintf(b, "    public static let %s = %s(rawValue: %d)\n", swiftIdent(camelName(v.Name)), name, v.Value)
+	}
+	b.WriteString("\n    public var description: String {\n")
+	b.WriteString("        switch rawValue {\n")
+	seen := map[int64]bool{}
+	for _, v := range e.Values {
+		if !seen[v.Value] {
+			seen[v.Value] = true
+			fmt.Fprintf(b, "        case %d: return %q\n", v.Value, v.Name)
+		}
+	}
+	b.WriteString("        default: return String(rawValue)\n")
+	b.WriteString("        }\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n\n")
+}
+
+func writeSwiftFunc(b *bytes.Buffer, s *swiftNames, f *cFunc, cModule, indent string) {
+	in := indent + "    "
+	var ps, args, pre []string
+	for i, p := range f.Params {
+		if i == 0 && f.Recv != nil {
+			args = append(args, "handle")
+			continue
+		}
+		label := camelName(p.Name)
+		n := swiftIdent(label)
+		ps = append(ps, fmt.Sprintf("%s: %s", label, s.swiftType(p)))
+		switch p.Kind {
+		case valEnum:
+			args = append(args, fmt.Sprintf("%s(rawValue: .init(truncatingIfNeeded: %s.rawValue))", p.C, n))
+		case valHandle:
+			args = append(args, n+".handle")
+		case valBytes:
+			args = append(args, n, n+".count")
+		case valStruct:
+			if len(pre) == 0 || pre[0] != "let strings = CStrings()" {
+				pre = append([]string{"let strings = CStrings()", "defer { withExtendedLifetime(strings) {} }"}, pre...)
+			}
+			c := "c" + pascalName(p.Name)
+			pre = append(pre, fmt.Sprintf("var %s = %s.c(strings)", c, n))
+			args = append(args, "&"+c)
+		case valCallback:
+			box := camelName(p.Name) + "Box"
+			pre = append(pre, fmt.Sprintf("let %s = CallbackBox(%s)", box, n), fmt.Sprintf("defer { withExtendedLifetime(%s) {} }", box))
+			ps[len(ps)-1] = fmt.Sprintf("%s: @escaping %s", label, s.swiftType(p))
+			args = append(args, swiftCallback(s, p.Callback), fmt.Sprintf("Unmanaged.passUnretained(%s).toOpaque()", box))
+		default:
+			args = append(args, n)
+		}
+	}
+	ret, result := "", ""
+	if r := f.Result; r != nil {
+		ret = " -> " + s.swiftType(*r)
+		switch r.Kind {
+		case valEnum:
+			pre = append(pre, fmt.Sprintf("var out = %s(rawValue: 0)", r.C))
+			result = fmt.Sprintf("%s(rawValue: Int32(truncatingIfNeeded: out.rawValue))", s.name[r.Enum])
+		case valHandle:
+			pre = append(pre, fmt.Sprintf("var out: %s = 0", r.C))
+			result = fmt.Sprintf("%s(handle: out)", s.name[r.Handle])
+		case valString:
+			pre = append(pre, "var out: UnsafeMutablePointer<CChar>? = nil")
+			result = "takeString(out)"
+		case valBytes:
+			pre = append(pre, "var out: UnsafeMutablePointer<UInt8>? = nil", "var outLen = 0")
+			result = "takeBytes(out, outLen)"
+		case valStruct:
+			pre = append(pre, fmt.Sprintf("var out = %s.%s()", cModule, r.C))
+			result = fmt.Sprintf("%s(taking: &out)", s.name[r.Struct])
+		default:
+			pre = append(pre, fmt.Sprintf("var out: %s = %s", swiftTypes[r.C], swiftZero(swiftTypes[r.C])))
+			result = "out"
+		}
+		args = append(args, "&out")
+		if r.Kind == valBytes {
+			args = append(args, "&outLen")
+		}
+	}
+	fmt.Fprintf(b, "%s/// `%s`\n", indent, strings.TrimSuffix(f.cPrototype(), ";"))
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "%s@available(*, deprecated, message: %q)\n", indent, f.Deprecated)
+	}
+	fmt.Fprintf(b, "%spublic func %s(%s) throws%s {\n", indent, swiftIdent(s.funcName(f)), strings.Join(ps, ", "), ret)
+	for _, p := range pre {
+		fmt.Fprintf(b, "%s%s\n", in, p)
+	}
+	fmt.Fprintf(b, "%stry check(%s(%s))\n", in, f.Symbol, strings.Join(args, ", "))
+	if result != "" {
+		fmt.Fprintf(b, "%sreturn %s\n", in, result)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// swiftCallback renders the C function literal calling the closure boxed in user_data; it
+// captures nothing, so it converts to the C function pointer.
+func swiftCallback(s *swiftNames, cb *cCallback) string {
+	var ps, args []string
+	for _, p := range cb.Params {
+		n := swiftIdent(p.Name)
+		switch p.Kind {
+		case valString:
+			ps = append(ps, n)
+			args = append(args, "string("+n+")")
+		case valBytes:
+			ps = append(ps, n, p.Name+"Len")
+			args = append(args, "bytes("+n+", "+p.Name+"Len)")
+		default:
+			ps = append(ps, n)
+			args = append(args, n)
+		}
+	}
+	ps = append(ps, "userData")
+	return fmt.Sprintf("{ %s in Unmanaged<CallbackBox<%s>>.fromOpaque(userData!).takeUnretainedValue().fn(%s) }",
+		strings.Join(ps, ", "), s.name[cb], strings.Join(args, ", "))
+}
@@ -0,0 +1,72 @@
+package writer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSwiftLayout(t *testing.T) {
+	apis := scanSample(t)
+	dir := t.TempDir()
+	if err := WriteSwift(dir, "my-lib", "PM_", apis); err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	pkg := read("Package.swift")
+	for _, s := range []string{
+		"// swift-tools-version:5.9\n",
+		`name: "MyLib",`,
+		`products: [.library(name: "MyLib", targets: ["MyLib"])],`,
+		`.systemLibrary(name: "CMyLib", path: "Sources/CMyLib"),`,
+		`.target(name: "MyLib", dependencies: ["CMyLib"]),`,
+	} {
+		if !strings.Contains(pkg, s) {
+			t.Errorf("Package.swift does not contain %q:\n%s", s, pkg)
+		}
+	}
+
+	want := "module CMyLib [system] {\n    header \"forgec.h\"\n    link \"my-lib\"\n    export *\n}\n"
+	if got := read("Sources/CMyLib/module.modulemap"); got != want {
+		t.Errorf("module.modulemap = %q, want %q", got, want)
+	}
+
+	hdr := filepath.Join(t.TempDir(), "forgec.h")
+	if err := WriteHeader(hdr, "PM_", apis, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read("Sources/CMyLib/forgec.h") != string(data) {
+		t.Error("Sources/CMyLib/forgec.h differs from WriteHeader")
+	}
+
+	if src := read("Sources/MyLib/MyLib.swift"); !strings.Contains(src, "import CMyLib\n") {
+		t.Error("MyLib.swift does not import CMyLib")
+	}
+}
+
+func TestSwiftModuleName(t *testing.T) {
+	tests := []struct{ lib, want string }{
+		{"sample", "Sample"},
+		{"my-lib", "MyLib"},
+		{"audio_engine", "AudioEngine"},
+		{"3d", "Lib3d"},
+	}
+	for _, tt := range tests {
+		if got := swiftModuleName(tt.lib); got != tt.want {
+			t.Errorf("swiftModuleName(%s) = %s, want %s", tt.lib, got, tt.want)
+		}
+	}
+}
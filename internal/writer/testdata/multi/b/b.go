@@ -0,0 +1,6 @@
+package b
+
+// Add is exported as B_Add next to A_Add; p and p2 are only reserved when b is scanned alone.
+//
+// capi:export
+func Add(p, p2 int32) (int32, error) { return p + p2, nil }
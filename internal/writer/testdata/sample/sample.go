@@ -0,0 +1,80 @@
+// Package sample is a small API using every kind of value the writers support.
+package sample
+
+import "errors"
+
+// capi:errcode code=100
+var ErrNotFound = errors.New("not found")
+
+// capi:export
+type Mode int32
+
+const (
+	ModeFast Mode = 1
+	ModeSafe Mode = 2
+)
+
+// capi:export
+type User struct {
+	Name string
+	Age  int32
+}
+
+// capi:handle
+type Store struct{ items map[string]int64 }
+
+// capi:export
+func NewStore() (*Store, error) { return &Store{items: map[string]int64{}}, nil }
+
+// capi:export
+func (s *Store) Put(key string, v int64) error { s.items[key] = v; return nil }
+
+// capi:export
+func (s *Store) Lookup(key string) (int64, error) {
+	v, ok := s.items[key]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return v, nil
+}
+
+// capi:export
+func Add(a, b int32) (int32, error) { return a + b, nil }
+
+// capi:export deprecated="use Add"
+func AddOld(a, b int32) (int32, error) { return a + b, nil }
+
+// Divide panics when b is 0.
+//
+// capi:export
+func Divide(a, b int32) (int32, error) { return a / b, nil }
+
+// capi:export
+func Greet(u *User) (string, error) { return "hello " + u.Name, nil }
+
+// capi:export
+func Older(u User) (User, error) { u.Age++; return u, nil }
+
+// capi:export
+func Echo(data []byte) ([]byte, error) { return data, nil }
+
+// capi:export
+func Walk(n int32, visit func(i int32) bool) error {
+	for i := int32(0); i < n && visit(i); i++ {
+	}
+	return nil
+}
+
+// capi:export
+func SetMode(m Mode) (Mode, error) { return m, nil }
+
+// capi:export
+func Scale(x float64, neg bool, n uint16) (float64, error) {
+	if neg {
+		x = -x
+	}
+	return x * float64(n), nil
+}
+
+// capi:export
+func Reset() error { return nil }
@@ -2,9 +2,12 @@ package writer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/format"
+	"go/types"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -26,142 +29,225 @@ func renderTemplate(name string, data any) (string, error) {
 	return b.String(), nil
 }
 
-// WriteExportsGo generates exports.go with cgo exports, panic recovery, errno, and helpers.
-func WriteExportsGo(path, modPath, cPrefix string, funcs []scanner.Func, withSentry bool) error {
-	// Sort for stability
-	sort.Slice(funcs, func(i, j int) bool { return funcs[i].Name < funcs[j].Name })
+// unit is one scanned package as the writers see it: its API with sorted declarations,
+// the C prefix of its symbols and lookup sets for its annotated types.
+type unit struct {
+	api      *scanner.API
+	prefix   string
+	status   string // C name of the shared status enum, <cPrefix>Status
+	byName   map[string]scanner.Struct
+	isHandle map[string]bool
+	isEnum   map[string]bool
+}
 
-	var b bytes.Buffer
-	b.WriteString("package main\n\n")
-	b.WriteString("/*\n#include <stdlib.h>\n#include <stdint.h>\n*/\n")
-	b.WriteString("import \"C\"\n\n")
-	b.WriteString("import (\n")
-	fmt.Fprintf(&b, "    p \"%s/internal\"\n", modPath)
-	if withSentry {
-		fmt.Fprintf(&b, "    \"%s/sentrywrap\"\n", modPath)
-	} else {
-		b.WriteString("    \"encoding/json\"\n")
-		b.WriteString("    \"sync\"\n")
+// newUnits sorts the scanned packages and their declarations for stable output, and checks
+// that no two declarations map to the same C symbol.
+func newUnits(cPrefix string, apis []*scanner.API) ([]*unit, error) {
+	units := make([]*unit, 0, len(apis))
+	for _, api := range apis {
+		funcs, structs, handles, enums := api.Funcs, api.Structs, api.Handles, api.Enums
+		sort.Slice(funcs, func(i, j int) bool { return funcs[i].CName < funcs[j].CName })
+		sort.Slice(structs, func(i, j int) bool { return structs[i].Name < structs[j].Name })
+		sort.Slice(handles, func(i, j int) bool { return handles[i].Name < handles[j].Name })
+		sort.Slice(enums, func(i, j int) bool { return enums[i].Name < enums[j].Name })
+		u := &unit{api: api, prefix: cPrefix, status: cPrefix + "Status", byName: make(map[string]scanner.Struct, len(structs)), isHandle: handleSet(handles), isEnum: enumSet(enums)}
+		if api.Prefix != "" {
+			u.prefix = api.Prefix
+		}
+		for _, s := range structs {
+			u.byName[s.Name] = s
+		}
+		units = append(units, u)
 	}
-	b.WriteString("    \"unsafe\"\n")
-	b.WriteString(")\n\n")
+	sort.Slice(units, func(i, j int) bool { return units[i].api.PkgPath < units[j].api.PkgPath })
+	return units, checkSymbols(cPrefix, units)
+}
 
-	// Helpers
-	b.WriteString("//export capi_free\n")
-	b.WriteString("func capi_free(p unsafe.Pointer) { C.free(p) }\n\n")
+// Built-in status codes, shared by all exports; capi:errcode adds codes from scanner.MinErrCode up.
+var builtinStatus = []scanner.EnumValue{
+	{Name: "OK", CName: "OK", Value: 0},
+	{Name: "ERROR", CName: "ERROR", Value: 1},
+	{Name: "PANIC", CName: "PANIC", Value: 2},
+	{Name: "INVALID_ARGUMENT", CName: "INVALID_ARGUMENT", Value: 3},
+}
 
-	if withSentry {
-		b.WriteString("//export capi_last_error_json\n")
-		b.WriteString("func capi_last_error_json() *C.char {\n")
-		b.WriteString("    s := sentrywrap.LastErrorJSON()\n")
-		b.WriteString("    return C.CString(s)\n")
-		b.WriteString("}\n\n")
-	} else {
-		b.WriteString("var (\n")
-		b.WriteString("    lastErrMu sync.Mutex\n")
-		b.WriteString("    lastErr   string\n")
-		b.WriteString(")\n\n")
-		b.WriteString("func setLastError(err error) {\n")
-		b.WriteString("    lastErrMu.Lock()\n")
-		b.WriteString("    defer lastErrMu.Unlock()\n")
-		b.WriteString("    if err == nil { lastErr = \"\"; return }\n")
-		b.WriteString("    b, _ := json.Marshal(map[string]any{\"error\": err.Error()})\n")
-		b.WriteString("    lastErr = string(b)\n")
-		b.WriteString("}\n\n")
-		b.WriteString("func lastErrorJSON() string {\n")
-		b.WriteString("    lastErrMu.Lock()\n")
-		b.WriteString("    defer lastErrMu.Unlock()\n")
-		b.WriteString("    if lastErr == \"\" { return \"{}\" }\n")
-		b.WriteString("    return lastErr\n")
-		b.WriteString("}\n\n")
-		b.WriteString("type simpleError string\n")
-		b.WriteString("func (e simpleError) Error() string { return string(e) }\n")
-		b.WriteString("func errFromRecover(r any) error {\n")
-		b.WriteString("    switch x := r.(type) {\n")
-		b.WriteString("    case error:\n        return x\n")
-		b.WriteString("    case string:\n        return simpleError(x)\n")
-		b.WriteString("    default:\n        return simpleError(\"panic\")\n")
-		b.WriteString("    }\n")
-		b.WriteString("}\n\n")
-		b.WriteString("//export capi_last_error_json\n")
-		b.WriteString("func capi_last_error_json() *C.char {\n")
-		b.WriteString("    s := lastErrorJSON()\n")
-		b.WriteString("    return C.CString(s)\n")
-		b.WriteString("}\n\n")
+// statusEnum is the <cPrefix>Status enum returned by every export: the built-in codes followed
+// by the capi:errcode codes of all packages, sorted by code.
+func statusEnum(units []*unit) scanner.Enum {
+	e := scanner.Enum{Name: "Status", GoType: "int32", Values: append([]scanner.EnumValue(nil), builtinStatus...)}
+	var user []scanner.EnumValue
+	for _, u := range units {
+		for _, ec := range u.api.ErrCodes {
+			user = append(user, scanner.EnumValue{Name: u.api.PkgPath + "." + ec.Name, CName: ec.CName, Value: int64(ec.Code)})
+		}
 	}
+	sort.SliceStable(user, func(i, j int) bool { return user[i].Value < user[j].Value })
+	e.Values = append(e.Values, user...)
+	return e
+}
 
-	for _, f := range funcs {
-		cname := cPrefix + f.CName
-		// C param list includes all params + out pointer
-		b.WriteString("//export " + cname + "\n")
-		fmt.Fprintf(&b, "func %s(", cname)
-		// params as C.int32_t or C.int64_t
-		var goArgs []string
-		for i, pn := range f.Params {
-			if i > 0 {
-				b.WriteString(", ")
-			}
-			cpt := "C.int32_t"
-			gCast := "int32"
-			if i < len(f.ParamTypes) && f.ParamTypes[i] == "int64" {
-				cpt = "C.int64_t"
-				gCast = "int64"
+// checkSymbols reports C symbols (functions, typedefs and enumerators) declared more than once,
+// e.g., the same function name exported from two packages sharing a prefix.
+func checkSymbols(cPrefix string, units []*unit) error {
+	owner := map[string]string{
+		"capi_free":               "forgec",
+		"capi_last_error_json":    "forgec",
+		"capi_clear_last_error":   "forgec",
+		"capi_flush":              "forgec",
+		"capi_reporter_configure": "forgec",
+		"capi_sentry_init":        "forgec",
+		"capi_sentry_flush":       "forgec",
+	}
+	var errs []error
+	declare := func(sym, by string) {
+		if prev, ok := owner[sym]; ok {
+			errs = append(errs, fmt.Errorf("duplicate C symbol %s: declared by %s and %s", sym, prev, by))
+			return
+		}
+		owner[sym] = by
+	}
+	status := statusEnum(units)
+	declare(cPrefix+status.Name, "forgec")
+	codes := map[int64]string{}
+	for _, v := range status.Values {
+		by := v.Name
+		if !strings.Contains(by, ".") {
+			by = "forgec"
+		}
+		declare(cPrefix+status.Name+"_"+v.CName, by)
+		if prev, ok := codes[v.Value]; ok {
+			errs = append(errs, fmt.Errorf("duplicate status code %d: declared by %s and %s", v.Value, prev, by))
+		}
+		codes[v.Value] = by
+	}
+	for _, u := range units {
+		qual := func(name string) string { return u.api.PkgPath + "." + name }
+		for _, e := range u.api.Enums {
+			declare(u.prefix+e.Name, qual(e.Name))
+			for _, v := range e.Values {
+				declare(u.prefix+e.Name+"_"+v.CName, qual(v.Name))
 			}
-			fmt.Fprintf(&b, "%s %s", pn, cpt)
-			goArgs = append(goArgs, fmt.Sprintf("%s(%s)", gCast, pn))
 		}
-		if f.HasValue {
-			if len(f.Params) > 0 {
-				b.WriteString(", ")
+		for _, h := range u.api.Handles {
+			declare(u.prefix+h.Name+"Handle", qual(h.Name))
+			declare(u.prefix+h.Name+"_release", qual(h.Name))
+		}
+		for _, s := range u.api.Structs {
+			declare(s.Name, qual(s.Name))
+			declare(u.prefix+s.Name+"_free", qual(s.Name))
+		}
+		for _, f := range u.api.Funcs {
+			name := f.Name
+			if f.Recv != "" {
+				name = f.Recv + "." + f.Name
 			}
-			outType := "*C.int32_t"
-			if f.RetType == "int64" {
-				outType = "*C.int64_t"
+			declare(funcSymbol(u.prefix, f), qual(name))
+			for _, cb := range f.Callbacks {
+				declare(callbackTypeName(u.prefix, f, cb), qual(name))
 			}
-			b.WriteString("out " + outType)
-		}
-		b.WriteString(") C.int32_t {\n")
-		b.WriteString("    var errno C.int32_t = 0\n")
-		if withSentry {
-			b.WriteString("    sentrywrap.RecoverAndReport(func() {\n")
-		} else {
-			b.WriteString("    func() {\n")
-			b.WriteString("        defer func() { if r := recover(); r != nil { setLastError(errFromRecover(r)) } }()\n")
 		}
-		if f.HasValue {
-			fmt.Fprintf(&b, "        res, err := p.%s(%s)\n", f.Name, strings.Join(goArgs, ", "))
-		} else {
-			fmt.Fprintf(&b, "        err := p.%s(%s)\n", f.Name, strings.Join(goArgs, ", "))
+	}
+	return errors.Join(errs...)
+}
+
+// WriteExportsGo generates exports.go with cgo exports, panic recovery, errno, and helpers.
+// Each scanned package is imported under its own alias; see newGoImports. Errors and panics
+// are passed to the reporters registered with the capi runtime package; reporters lists
+// import paths of packages that register one, imported for their side effect.
+func WriteExportsGo(path, cPrefix string, apis []*scanner.API, reporters []string) error {
+	units, err := newUnits(cPrefix, apis)
+	if err != nil {
+		return err
+	}
+
+	var needTime, needJSON bool
+	for _, u := range units {
+		for _, s := range u.api.Structs {
+			for _, f := range s.Fields {
+				switch f.GoType {
+				case "time.Time":
+					needTime = true
+				case "map[string]int64":
+					needJSON = true
+				}
+			}
 		}
-		b.WriteString("        if err != nil {\n")
-		b.WriteString("            errno = 1\n")
-		if withSentry {
-			b.WriteString("            sentrywrap.SetLastError(err)\n")
-		} else {
-			b.WriteString("            setLastError(err)\n")
+	}
+
+	var head bytes.Buffer
+	head.WriteString("package main\n\n")
+	// Enum, struct, handle and callback typedefs must be visible to cgo, so they are repeated in the preamble.
+	// Callbacks also get a static trampoline, since Go cannot call a C function pointer directly.
+	head.WriteString("/*\n#include <stdlib.h>\n#include <stdint.h>\n#include <stdbool.h>\n\n")
+	writeEnumTypedefs(&head, cPrefix, []scanner.Enum{statusEnum(units)})
+	for _, u := range units {
+		if len(u.api.Structs) > 0 || len(u.api.Handles) > 0 || len(u.api.Enums) > 0 {
+			head.WriteString("\n")
+			writeEnumTypedefs(&head, u.prefix, u.api.Enums)
+			writeHandleTypedefs(&head, u.prefix, u.api.Handles)
+			writeStructTypedefs(&head, u.api.Structs)
 		}
-		b.WriteString("            return\n")
-		b.WriteString("        }\n")
-		if f.HasValue {
-			if f.RetType == "int64" {
-				b.WriteString("        if out != nil { *out = C.int64_t(res) }\n")
-			} else {
-				b.WriteString("        if out != nil { *out = C.int32_t(res) }\n")
+		for _, f := range u.api.Funcs {
+			for _, cb := range f.Callbacks {
+				head.WriteString("\n")
+				if err := writeCallbackTypedef(&head, u.prefix, f, cb); err != nil {
+					return err
+				}
+				writeCallbackTrampoline(&head, u.prefix, f, cb)
 			}
 		}
-		if withSentry {
-			b.WriteString("    })\n")
-		} else {
-			b.WriteString("    }()\n")
+	}
+	head.WriteString("*/\n")
+	head.WriteString("import \"C\"\n\n")
+
+	// The body is generated first; imports are written last so they cover exactly
+	// the packages of the Go types spelled in it (e.g., time.Duration params).
+	imps := newGoImports(units)
+	imps.add(CapiImportPath)
+	if needJSON {
+		imps.add("encoding/json")
+		imps.add("fmt")
+	}
+	if needTime {
+		imps.add("time")
+	}
+	status := statusEnum(units)
+	if len(status.Values) > len(builtinStatus) {
+		imps.add("errors")
+	}
+
+	var b bytes.Buffer
+
+	// Status codes, error recording, panic recovery and handles live in the capi runtime
+	// package, which also exports the capi_* helpers of forgec.h.
+	b.WriteString("// Generated code is compatible with this version of the capi runtime package.\n")
+	b.WriteString("const _ = capi.SupportPackageIsVersion1\n\n")
+	writeErrorStatus(&b, imps, cPrefix, units)
+
+	for _, u := range units {
+		for _, s := range u.api.Structs {
+			writeStructConverters(&b, imps, u, s)
+		}
+		writeHandleHelpers(&b, imps, u)
+		for _, f := range u.api.Funcs {
+			if err := writeExportFunc(&b, imps, u, f); err != nil {
+				return err
+			}
 		}
-		b.WriteString("    return errno\n")
-		b.WriteString("}\n\n")
 	}
 
 	// Provide a dummy main to satisfy c-shared build requirements.
 	b.WriteString("func main() {}\n")
 
-	src := b.Bytes()
+	head.WriteString("import (\n")
+	imps.write(&head)
+	for _, r := range reporters {
+		fmt.Fprintf(&head, "    _ %q\n", r)
+	}
+	head.WriteString(")\n\n")
+	head.Write(b.Bytes())
+
+	src := head.Bytes()
 	fmted, err := format.Source(src)
 	if err != nil {
 		// write raw to help debugging
@@ -176,20 +262,589 @@ func WriteExportsGo(path, modPath, cPrefix string, funcs []scanner.Func, withSen
 	return nil
 }
 
-// WriteSentryWrap generates the sentrywrap package under the provided module root directory.
-// It writes to <modRoot>/sentrywrap/sentrywrap.go, overwriting if it exists.
-func WriteSentryWrap(modRoot string) error {
-	dir := filepath.Join(modRoot, "sentrywrap")
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("mkdir sentrywrap: %w", err)
+// writeErrorStatus emits errorStatus, which maps an error returned by a Go function to its status
+// code: ERROR, or the code of the first capi:errcode sentinel it matches with errors.Is.
+func writeErrorStatus(b *bytes.Buffer, imps *goImports, cPrefix string, units []*unit) {
+	b.WriteString("func errorStatus(err error) C.int32_t {\n")
+	for _, u := range units {
+		for _, ec := range u.api.ErrCodes {
+			fmt.Fprintf(b, "    if errors.Is(err, %s.%s) { return C.%sStatus_%s }\n", imps.local(u.api), ec.Name, cPrefix, ec.CName)
+		}
 	}
-	content, err := renderTemplate("sentrywrap.go.tmpl", nil)
+	fmt.Fprintf(b, "    return C.%sStatus_ERROR\n", cPrefix)
+	b.WriteString("}\n\n")
+}
+
+// CapiImportPath is the import path of the runtime package used by the generated code.
+const CapiImportPath = "github.com/aarondu-sudo/forgec/capi"
+
+// SentryReporterPath is the import path of the Sentry reporter added by -sentry.
+const SentryReporterPath = CapiImportPath + "/sentryreporter"
+
+// callArgs renders the args of an export passed to reporters: scalars, enums and handles
+// as is, strings copied, buffers by length; structs and callbacks are left out.
+func callArgs(u *unit, f scanner.Func) string {
+	var kv []string
+	if f.Recv != "" {
+		kv = append(kv, `"h": h`)
+	}
+	for i, pn := range f.Params {
+		t := f.ParamTypes[i]
+		if _, ok := f.CallbackFor(pn); ok {
+			continue
+		}
+		if _, _, ok := structRef(u.byName, t); ok {
+			continue
+		}
+		switch ct, _ := scanner.LookupType(t); ct.Kind {
+		case scanner.KindString:
+			kv = append(kv, fmt.Sprintf("%q: C.GoString(%s)", pn, pn))
+		case scanner.KindBytes:
+			kv = append(kv, fmt.Sprintf("%q: %s_len", pn+"_len", pn))
+		default:
+			kv = append(kv, fmt.Sprintf("%q: %s", pn, pn))
+		}
+	}
+	return "map[string]any{" + strings.Join(kv, ", ") + "}"
+}
+
+// writeExportFunc emits the //export wrapper of one scanned function or method.
+func writeExportFunc(b *bytes.Buffer, imps *goImports, u *unit, f scanner.Func) error {
+	// errors are recorded and reported with a capi.Call naming the export and carrying its args
+	setErr, recoverFn, call := "capi.SetLastError", "capi.Recover", "capiCall"
+	cname := funcSymbol(u.prefix, f)
+	// C param list includes all params + out pointer
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "// Deprecated: %s\n", f.Deprecated)
+	}
+	b.WriteString("//export " + cname + "\n")
+	fmt.Fprintf(b, "func %s(", cname)
+	// params use the cgo spelling from scanner.LookupType; strings and bytes are copied into Go.
+	// Struct params arrive as const pointers and handles as PM_<Type>Handle; both are
+	// resolved before the call (pre).
+	var goArgs, pre []string
+	callee := imps.local(u.api) + "." + f.Name
+	if f.Recv != "" {
+		fmt.Fprintf(b, "h C.%s%sHandle", u.prefix, f.Recv)
+		if len(f.Params) > 0 {
+			b.WriteString(", ")
+		}
+		pre = append(pre,
+			fmt.Sprintf("hGo, cerr := capi.HandleValue[%s.%s](uintptr(h))\n", imps.local(u.api), f.Recv),
+			fmt.Sprintf("if cerr != nil { errno = C.%s_INVALID_ARGUMENT; %s(%s, int32(errno), cerr); return }\n", u.status, setErr, call))
+		callee = "hGo." + f.Name
+	}
+	for i, pn := range f.Params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if cb, ok := f.CallbackFor(pn); ok {
+			imps.add("unsafe")
+			fmt.Fprintf(b, "%s C.%s, %s_user_data unsafe.Pointer", pn, callbackTypeName(u.prefix, f, cb), pn)
+			pre = append(pre, callbackClosure(imps, u.prefix, f, cb))
+			goArgs = append(goArgs, pn+"Go")
+			continue
+		}
+		goType := imps.typeString(f.ParamGoTypes[i])
+		if u.isEnum[f.ParamTypes[i]] {
+			fmt.Fprintf(b, "%s C.%s%s", pn, u.prefix, f.ParamTypes[i])
+			goArgs = append(goArgs, fmt.Sprintf("%s(%s)", goType, pn))
+			continue
+		}
+		if hn, ok := handleRef(u.isHandle, f.ParamTypes[i]); ok {
+			fmt.Fprintf(b, "%s C.%s%sHandle", pn, u.prefix, hn)
+			pre = append(pre,
+				fmt.Sprintf("%sGo, cerr := capi.HandleValue[%s.%s](uintptr(%s))\n", pn, imps.local(u.api), hn, pn),
+				fmt.Sprintf("if cerr != nil { errno = C.%s_INVALID_ARGUMENT; %s(%s, int32(errno), cerr); return }\n", u.status, setErr, call))
+			goArgs = append(goArgs, pn+"Go")
+			continue
+		}
+		if st, ptr, ok := structRef(u.byName, f.ParamTypes[i]); ok {
+			fmt.Fprintf(b, "%s *C.%s", pn, st.Name)
+			imps.add("errors")
+			pre = append(pre,
+				fmt.Sprintf("if %s == nil { errno = C.%s_INVALID_ARGUMENT; %s(%s, int32(errno), errors.New(%q)); return }\n", pn, u.status, setErr, call, pn+": NULL "+st.Name),
+				fmt.Sprintf("var %sGo %s.%s\n", pn, imps.local(u.api), st.Name),
+				fmt.Sprintf("if cerr := fromC%s(%s, &%sGo); cerr != nil { errno = C.%s_INVALID_ARGUMENT; %s(%s, int32(errno), cerr); return }\n", st.Name, pn, pn, u.status, setErr, call))
+			if ptr {
+				goArgs = append(goArgs, "&"+pn+"Go")
+			} else {
+				goArgs = append(goArgs, pn+"Go")
+			}
+			continue
+		}
+		ct, ok := scanner.LookupType(f.ParamTypes[i])
+		if !ok {
+			return fmt.Errorf("%s: unsupported param type %s", f.Name, f.ParamTypes[i])
+		}
+		switch ct.Kind {
+		case scanner.KindString:
+			fmt.Fprintf(b, "%s %s", pn, ct.Cgo)
+			goArgs = append(goArgs, convert(goType, "string", fmt.Sprintf("C.GoString(%s)", pn)))
+		case scanner.KindBytes:
+			// []byte is assignable to named byte slice types, no conversion needed
+			fmt.Fprintf(b, "%s %s, %s_len C.size_t", pn, ct.Cgo, pn)
+			imps.add("unsafe")
+			imps.add("errors")
+			// C.GoBytes takes a C.int length, so larger buffers are rejected rather than truncated.
+			pre = append(pre,
+				fmt.Sprintf("if %s == nil && %s_len > 0 { errno = C.%s_INVALID_ARGUMENT; %s(%s, int32(errno), errors.New(%q)); return }\n", pn, pn, u.status, setErr, call, pn+": NULL with "+pn+"_len > 0"),
+				fmt.Sprintf("if %s_len > %s.MaxInt32 { errno = C.%s_INVALID_ARGUMENT; %s(%s, int32(errno), errors.New(%q)); return }\n", pn, imps.add("math"), u.status, setErr, call, pn+"_len: larger than 2147483647 bytes"))
+			goArgs = append(goArgs, fmt.Sprintf("C.GoBytes(unsafe.Pointer(%s), C.int(%s_len))", pn, pn))
+		default:
+			fmt.Fprintf(b, "%s %s", pn, ct.Cgo)
+			goArgs = append(goArgs, fmt.Sprintf("%s(%s)", goType, pn))
+		}
+	}
+	var rt scanner.CType
+	rst, rptr, rIsStruct := structRef(u.byName, f.RetType)
+	rhn, rIsHandle := handleRef(u.isHandle, f.RetType)
+	if f.HasValue {
+		if len(f.Params) > 0 || f.Recv != "" {
+			b.WriteString(", ")
+		}
+		if u.isEnum[f.RetType] {
+			fmt.Fprintf(b, "out *C.%s%s", u.prefix, f.RetType)
+		} else if rIsHandle {
+			fmt.Fprintf(b, "out *C.%s%sHandle", u.prefix, rhn)
+		} else if rIsStruct {
+			fmt.Fprintf(b, "out *C.%s", rst.Name)
+		} else {
+			var ok bool
+			if rt, ok = scanner.LookupType(f.RetType); !ok {
+				return fmt.Errorf("%s: unsupported result type %s", f.Name, f.RetType)
+			}
+			fmt.Fprintf(b, "out *%s", rt.Cgo)
+			if rt.Kind == scanner.KindBytes {
+				b.WriteString(", out_len *C.size_t")
+			}
+		}
+	}
+	b.WriteString(") C.int32_t {\n")
+	fmt.Fprintf(b, "    var errno C.int32_t = C.%s_OK\n", u.status)
+	fmt.Fprintf(b, "    capiCall := capi.Call{Function: %q, Args: func() map[string]any { return %s }}\n", cname, callArgs(u, f))
+	fmt.Fprintf(b, "    recovered := %s(%s, func() {\n", recoverFn, call)
+	for _, line := range pre {
+		b.WriteString("        " + line)
+	}
+	if f.HasValue {
+		fmt.Fprintf(b, "        res, err := %s(%s)\n", callee, strings.Join(goArgs, ", "))
+	} else {
+		fmt.Fprintf(b, "        err := %s(%s)\n", callee, strings.Join(goArgs, ", "))
+	}
+	b.WriteString("        if err != nil {\n")
+	b.WriteString("            errno = errorStatus(err)\n")
+	fmt.Fprintf(b, "            %s(%s, int32(errno), err)\n", setErr, call)
+	b.WriteString("            return\n")
+	b.WriteString("        }\n")
+	if f.HasValue && u.isEnum[f.RetType] {
+		fmt.Fprintf(b, "        if out != nil { *out = C.%s%s(res) }\n", u.prefix, f.RetType)
+	} else if f.HasValue && rIsHandle {
+		// The handle keeps res alive until the caller releases it with <prefix><Type>_release.
+		b.WriteString("        if out != nil {\n            *out = 0\n")
+		fmt.Fprintf(b, "            if res != nil { *out = C.%s%sHandle(capi.NewHandle(res)) }\n", u.prefix, rhn)
+		b.WriteString("        }\n")
+	} else if f.HasValue && rIsStruct {
+		// Caller owns the struct's strings and releases them with <prefix><Struct>_free.
+		fmt.Fprintf(b, "        if out != nil {\n            *out = C.%s{}\n", rst.Name)
+		if rptr {
+			fmt.Fprintf(b, "            if res != nil { toC%s(res, out) }\n", rst.Name)
+		} else {
+			fmt.Fprintf(b, "            toC%s(&res, out)\n", rst.Name)
+		}
+		b.WriteString("        }\n")
+	} else if f.HasValue {
+		switch rt.Kind {
+		case scanner.KindString:
+			// Caller owns the copy and releases it with capi_free.
+			fmt.Fprintf(b, "        if out != nil { *out = C.CString(%s) }\n", convert("string", imps.typeString(f.RetGoType), "res"))
+		case scanner.KindBytes:
+			// Caller owns the copy and releases it with capi_free.
+			b.WriteString("        if out != nil { *out = (*C.uint8_t)(C.CBytes(res)) }\n")
+			b.WriteString("        if out_len != nil { *out_len = C.size_t(len(res)) }\n")
+		default:
+			fmt.Fprintf(b, "        if out != nil { *out = %s(res) }\n", rt.Cgo)
+		}
+	}
+	b.WriteString("    })\n")
+	b.WriteString("    if recovered != 0 { return C.int32_t(recovered) }\n")
+	b.WriteString("    return errno\n")
+	b.WriteString("}\n\n")
+	return nil
+}
+
+// structRef resolves a param/result type naming an exported struct ("User" or "*User").
+func structRef(byName map[string]scanner.Struct, goType string) (scanner.Struct, bool, bool) {
+	name := strings.TrimPrefix(goType, "*")
+	s, ok := byName[name]
+	return s, name != goType, ok
+}
+
+// funcSymbol is the exported C name of f: <prefix><CName>, where prefix= on capi:export
+// overrides the package prefix.
+func funcSymbol(cPrefix string, f scanner.Func) string {
+	if f.Prefix != nil {
+		cPrefix = *f.Prefix
+	}
+	return cPrefix + f.CName
+}
+
+// callbackTypeName is the C typedef of a callback param: <symbol>_<param>_fn.
+func callbackTypeName(cPrefix string, f scanner.Func, cb scanner.Callback) string {
+	return funcSymbol(cPrefix, f) + "_" + cb.Param + "_fn"
+}
+
+// callbackCParams renders the C parameter list of a callback (without user_data).
+func callbackCParams(cb scanner.Callback) ([]string, error) {
+	var ps []string
+	for i, pn := range cb.Params {
+		ct, ok := scanner.LookupType(cb.ParamTypes[i])
+		if !ok {
+			return nil, fmt.Errorf("callback %s: unsupported param type %s", cb.Param, cb.ParamTypes[i])
+		}
+		switch ct.Kind {
+		case scanner.KindString:
+			ps = append(ps, fmt.Sprintf("const %s %s", ct.C, pn))
+		case scanner.KindBytes:
+			ps = append(ps, fmt.Sprintf("const %s %s", ct.C, pn), fmt.Sprintf("size_t %s_len", pn))
+		default:
+			ps = append(ps, fmt.Sprintf("%s %s", ct.C, pn))
+		}
+	}
+	return ps, nil
+}
+
+// callbackCRet is the C result type of a callback, "void" when it returns nothing.
+func callbackCRet(cb scanner.Callback) string {
+	if ct, ok := scanner.LookupType(cb.RetType); ok {
+		return ct.C
+	}
+	return "void"
+}
+
+// writeCallbackTypedef writes the function pointer typedef of a callback; shared by forgec.h and the cgo preamble.
+func writeCallbackTypedef(b *bytes.Buffer, cPrefix string, f scanner.Func, cb scanner.Callback) error {
+	ps, err := callbackCParams(cb)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	ps = append(ps, "void* user_data")
+	fmt.Fprintf(b, "typedef %s (*%s)(%s);\n", callbackCRet(cb), callbackTypeName(cPrefix, f, cb), strings.Join(ps, ", "))
+	return nil
+}
+
+// writeCallbackTrampoline writes the static C helper that exports.go uses to invoke a callback pointer.
+func writeCallbackTrampoline(b *bytes.Buffer, cPrefix string, f scanner.Func, cb scanner.Callback) {
+	tn := callbackTypeName(cPrefix, f, cb)
+	ps, _ := callbackCParams(cb)
+	var args []string
+	for i, pn := range cb.Params {
+		args = append(args, pn)
+		if cb.ParamTypes[i] == "[]byte" {
+			args = append(args, pn+"_len")
+		}
+	}
+	args = append(args, "user_data")
+	ret := callbackCRet(cb)
+	fmt.Fprintf(b, "static inline %s forgec_call_%s(%s)", ret, tn, strings.Join(append(append([]string{tn + " forgec_fn"}, ps...), "void* user_data"), ", "))
+	if ret == "void" {
+		fmt.Fprintf(b, " { forgec_fn(%s); }\n", strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(b, " { return forgec_fn(%s); }\n", strings.Join(args, ", "))
+	}
+}
+
+// callbackClosure returns the Go statements that wrap a C callback pointer into <param>Go,
+// a Go func calling it through its trampoline; a NULL pointer becomes a nil func.
+func callbackClosure(imps *goImports, cPrefix string, f scanner.Func, cb scanner.Callback) string {
+	var b bytes.Buffer
+	var goParams, cArgs, setup []string
+	for i, t := range cb.ParamTypes {
+		an := fmt.Sprintf("a%d", i)
+		goType := imps.typeString(cb.ParamGoTypes[i])
+		goParams = append(goParams, an+" "+goType)
+		ct, _ := scanner.LookupType(t)
+		switch ct.Kind {
+		case scanner.KindString:
+			imps.add("unsafe")
+			setup = append(setup, fmt.Sprintf("%sC := C.CString(%s)\ndefer C.free(unsafe.Pointer(%sC))\n", an, convert("string", goType, an), an))
+			cArgs = append(cArgs, an+"C")
+		case scanner.KindBytes:
+			setup = append(setup, fmt.Sprintf("%sC := C.CBytes(%s)\ndefer C.free(%sC)\n", an, an, an))
+			cArgs = append(cArgs, fmt.Sprintf("(*C.uint8_t)(%sC)", an), fmt.Sprintf("C.size_t(len(%s))", an))
+		default:
+			cArgs = append(cArgs, fmt.Sprintf("%s(%s)", ct.Cgo, an))
+		}
+	}
+	cArgs = append([]string{cb.Param}, append(cArgs, cb.Param+"_user_data")...)
+	sig := "func(" + strings.Join(goParams, ", ") + ")"
+	retType := ""
+	if cb.RetGoType != nil {
+		retType = imps.typeString(cb.RetGoType)
+		sig += " " + retType
+	}
+	// the param may have a named func type, so the variable is declared with the declared type
+	fmt.Fprintf(&b, "var %sGo %s\n", cb.Param, imps.typeString(paramGoType(f, cb.Param)))
+	fmt.Fprintf(&b, "if %s != nil {\n", cb.Param)
+	fmt.Fprintf(&b, "%sGo = %s {\n", cb.Param, sig)
+	for _, st := range setup {
+		b.WriteString(st)
+	}
+	call := fmt.Sprintf("C.forgec_call_%s(%s)", callbackTypeName(cPrefix, f, cb), strings.Join(cArgs, ", "))
+	if retType != "" {
+		fmt.Fprintf(&b, "return %s(%s)\n", retType, call)
+	} else {
+		b.WriteString(call + "\n")
+	}
+	b.WriteString("}\n}\n")
+	return b.String()
+}
+
+func enumSet(enums []scanner.Enum) map[string]bool {
+	m := make(map[string]bool, len(enums))
+	for _, e := range enums {
+		m[e.Name] = true
+	}
+	return m
+}
+
+// writeEnumTypedefs writes `typedef enum { <prefix><Enum>_<Value> = N, ... } <prefix><Enum>;`;
+// shared by forgec.h and the cgo preamble.
+func writeEnumTypedefs(b *bytes.Buffer, cPrefix string, enums []scanner.Enum) {
+	for _, e := range enums {
+		b.WriteString("typedef enum {\n")
+		for _, v := range e.Values {
+			fmt.Fprintf(b, "    %s%s_%s = %d,\n", cPrefix, e.Name, v.CName, v.Value)
+		}
+		fmt.Fprintf(b, "} %s%s;\n\n", cPrefix, e.Name)
+	}
+}
+
+// paramGoType returns the declared Go type of the named param of f.
+func paramGoType(f scanner.Func, param string) types.Type {
+	for i, pn := range f.Params {
+		if pn == param {
+			return f.ParamGoTypes[i]
+		}
+	}
+	return nil
+}
+
+// convert wraps expr (of type from) in a conversion to type to, unless they are the same.
+func convert(to, from, expr string) string {
+	if to == from {
+		return expr
+	}
+	return to + "(" + expr + ")"
+}
+
+// goImports spells Go types for exports.go and records the imports they need.
+// Scanned packages are imported under scanner.API.Alias (p when a single package is scanned,
+// p_<name> otherwise), which the scanner checked params against; they are only imported once
+// something is spelled through them.
+type goImports struct {
+	aliases map[string]string // scanned package path -> alias
+	names   map[string]string // import path -> local name
+}
+
+func newGoImports(units []*unit) *goImports {
+	g := &goImports{aliases: map[string]string{}, names: map[string]string{}}
+	for _, u := range units {
+		g.aliases[u.api.PkgPath] = u.api.Alias
+	}
+	return g
+}
+
+// local returns the alias of a scanned package and records its import.
+func (g *goImports) local(api *scanner.API) string {
+	n := g.aliases[api.PkgPath]
+	g.names[api.PkgPath] = n
+	return n
+}
+
+// add records an import by path and returns its local name, renaming on collisions.
+func (g *goImports) add(importPath string) string {
+	return g.addNamed(importPath, path.Base(importPath))
+}
+
+func (g *goImports) addNamed(importPath, name string) string {
+	if n, ok := g.names[importPath]; ok {
+		return n
+	}
+	if n, ok := g.aliases[importPath]; ok {
+		g.names[importPath] = n
+		return n
+	}
+	name = g.unique(name)
+	g.names[importPath] = name
+	return name
+}
+
+// unique returns name, or name with a numeric suffix if it is already taken.
+func (g *goImports) unique(name string) string {
+	base := name
+	for i := 2; ; i++ {
+		taken := name == "C"
+		for _, n := range g.names {
+			taken = taken || n == name
+		}
+		for _, n := range g.aliases {
+			taken = taken || n == name
+		}
+		if !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+func (g *goImports) qualifier(pkg *types.Package) string {
+	return g.addNamed(pkg.Path(), pkg.Name())
+}
+
+func (g *goImports) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+// write emits the recorded imports, sorted by path.
+func (g *goImports) write(b *bytes.Buffer) {
+	paths := make([]string, 0, len(g.names))
+	for p := range g.names {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if g.names[p] == path.Base(p) {
+			fmt.Fprintf(b, "    %q\n", p)
+		} else {
+			fmt.Fprintf(b, "    %s %q\n", g.names[p], p)
+		}
+	}
+}
+
+func handleSet(handles []scanner.Handle) map[string]bool {
+	m := make(map[string]bool, len(handles))
+	for _, h := range handles {
+		m[h.Name] = true
+	}
+	return m
+}
+
+// handleRef resolves a param/result type naming a handle ("*Session").
+func handleRef(isHandle map[string]bool, goType string) (string, bool) {
+	name, ok := strings.CutPrefix(goType, "*")
+	return name, ok && isHandle[name]
+}
+
+// writeHandleTypedefs writes the opaque <prefix><Type>Handle typedefs; shared by forgec.h and the cgo preamble.
+func writeHandleTypedefs(b *bytes.Buffer, cPrefix string, handles []scanner.Handle) {
+	for _, h := range handles {
+		fmt.Fprintf(b, "typedef uintptr_t %s%sHandle;\n", cPrefix, h.Name)
+	}
+	if len(handles) > 0 {
+		b.WriteString("\n")
+	}
+}
+
+// writeHandleHelpers emits an exported <prefix><Type>_release per handle type of a package.
+func writeHandleHelpers(b *bytes.Buffer, imps *goImports, u *unit) {
+	for _, h := range u.api.Handles {
+		fname := u.prefix + h.Name + "_release"
+		b.WriteString("//export " + fname + "\n")
+		fmt.Fprintf(b, "func %s(h C.%s%sHandle) C.int32_t {\n", fname, u.prefix, h.Name)
+		fmt.Fprintf(b, "    if err := capi.ReleaseHandle[%s.%s](uintptr(h)); err != nil {\n", imps.local(u.api), h.Name)
+		fmt.Fprintf(b, "        capi.SetLastError(capi.Call{Function: %q}, C.%s_INVALID_ARGUMENT, err)\n", fname, u.status)
+		fmt.Fprintf(b, "        return C.%s_INVALID_ARGUMENT\n", u.status)
+		b.WriteString("    }\n")
+		fmt.Fprintf(b, "    return C.%s_OK\n", u.status)
+		b.WriteString("}\n\n")
+	}
+}
+
+// writeStructTypedefs writes C typedefs for exported structs; shared by forgec.h and the cgo preamble.
+func writeStructTypedefs(b *bytes.Buffer, structs []scanner.Struct) {
+	for _, s := range structs {
+		fmt.Fprintf(b, "typedef struct %s {\n", s.Name)
+		for _, f := range s.Fields {
+			fmt.Fprintf(b, "    %s %s;\n", f.CType, f.ExportName)
+		}
+		fmt.Fprintf(b, "} %s;\n\n", s.Name)
+	}
+}
+
+// writeStructConverters emits fromC<S>/toC<S> field-by-field converters and the exported <prefix><S>_free.
+func writeStructConverters(b *bytes.Buffer, imps *goImports, u *unit, s scanner.Struct) {
+	fmt.Fprintf(b, "func fromC%s(c *C.%s, v *%s.%s) error {\n", s.Name, s.Name, imps.local(u.api), s.Name)
+	b.WriteString("    if c == nil { return nil }\n")
+	for _, f := range s.Fields {
+		switch f.GoType {
+		case "string":
+			fmt.Fprintf(b, "    v.%s = %s\n", f.Name, convert(imps.typeString(f.Type), "string", "C.GoString(c."+f.ExportName+")"))
+		case "bool":
+			fmt.Fprintf(b, "    v.%s = c.%s != 0\n", f.Name, f.ExportName)
+		case "time.Time":
+			fmt.Fprintf(b, "    v.%s = time.Unix(int64(c.%s), 0)\n", f.Name, f.ExportName)
+		case "map[string]int64":
+			fmt.Fprintf(b, "    if c.%s != nil {\n", f.ExportName)
+			fmt.Fprintf(b, "        if err := json.Unmarshal([]byte(C.GoString(c.%s)), &v.%s); err != nil { return fmt.Errorf(\"%s.%s: %%w\", err) }\n", f.ExportName, f.Name, s.Name, f.ExportName)
+			b.WriteString("    }\n")
+		default:
+			fmt.Fprintf(b, "    v.%s = %s(c.%s)\n", f.Name, imps.typeString(f.Type), f.ExportName)
+		}
+	}
+	b.WriteString("    return nil\n")
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(b, "func toC%s(v *%s.%s, c *C.%s) {\n", s.Name, imps.local(u.api), s.Name, s.Name)
+	for _, f := range s.Fields {
+		switch f.GoType {
+		case "string":
+			fmt.Fprintf(b, "    c.%s = C.CString(%s)\n", f.ExportName, convert("string", imps.typeString(f.Type), "v."+f.Name))
+		case "bool":
+			fmt.Fprintf(b, "    c.%s = 0\n", f.ExportName)
+			fmt.Fprintf(b, "    if v.%s { c.%s = 1 }\n", f.Name, f.ExportName)
+		case "time.Time":
+			fmt.Fprintf(b, "    c.%s = C.int64_t(v.%s.Unix())\n", f.ExportName, f.Name)
+		case "map[string]int64":
+			fmt.Fprintf(b, "    if js, err := json.Marshal(v.%s); err == nil { c.%s = C.CString(string(js)) }\n", f.Name, f.ExportName)
+		default:
+			ct, _ := scanner.LookupType(f.GoType)
+			fmt.Fprintf(b, "    c.%s = %s(v.%s)\n", f.ExportName, ct.Cgo, f.Name)
+		}
+	}
+	b.WriteString("}\n\n")
+
+	// Frees the strings owned by a struct filled in by an export; the struct itself belongs to the caller.
+	fname := u.prefix + s.Name + "_free"
+	b.WriteString("//export " + fname + "\n")
+	fmt.Fprintf(b, "func %s(c *C.%s) {\n", fname, s.Name)
+	b.WriteString("    if c == nil { return }\n")
+	for _, f := range s.Fields {
+		if f.CType != "const char*" {
+			continue
+		}
+		imps.add("unsafe")
+		fmt.Fprintf(b, "    C.free(unsafe.Pointer(c.%s))\n", f.ExportName)
+		fmt.Fprintf(b, "    c.%s = nil\n", f.ExportName)
+	}
+	b.WriteString("}\n\n")
+}
+
+// ErrorSchemaVersion is the schema_version of the JSON returned by capi_last_error_json;
+// it follows capi.SchemaVersion, which is not imported here so the CLI builds without cgo.
+const ErrorSchemaVersion = 1
+
+// ErrorSchemaFile is the name of the JSON Schema of that record, written next to the header.
+const ErrorSchemaFile = "forgec.error.schema.json"
+
+// WriteErrorSchema writes the JSON Schema of the capi_last_error_json record to path.
+func WriteErrorSchema(path string) error {
+	content, err := renderTemplate("error.schema.json.tmpl", map[string]any{"Version": ErrorSchemaVersion})
 	if err != nil {
 		return err
 	}
-	out := filepath.Join(dir, "sentrywrap.go")
-	if err := os.WriteFile(out, []byte(content), 0o644); err != nil {
-		return fmt.Errorf("write sentrywrap.go: %w", err)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
 	}
 	return nil
 }
@@ -222,64 +877,181 @@ func WriteBuildScripts(modRoot, modName string) error {
 	return nil
 }
 
-// WriteHeader generates forgec.h with C prototypes.
-func WriteHeader(path, cPrefix string, funcs []scanner.Func, structs []scanner.Struct) error {
-	sort.Slice(funcs, func(i, j int) bool { return funcs[i].Name < funcs[j].Name })
+// WriteHeader writes forgec.h. reporters are the import paths passed to WriteExportsGo; with
+// SentryReporterPath, the header also declares its deprecated capi_sentry_* exports.
+func WriteHeader(path, cPrefix string, apis []*scanner.API, reporters []string) error {
+	b, err := renderHeader(cPrefix, apis, reporters)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// renderHeader renders forgec.h; the LuaJIT bindings embed its declarations.
+func renderHeader(cPrefix string, apis []*scanner.API, reporters []string) ([]byte, error) {
+	units, err := newUnits(cPrefix, apis)
+	if err != nil {
+		return nil, err
+	}
+	withSentry := false
+	for _, r := range reporters {
+		withSentry = withSentry || r == SentryReporterPath
+	}
+	hasDeprecated := withSentry
+	var hasHandles, hasStructs, hasCallbacks bool
+	for _, u := range units {
+		hasHandles = hasHandles || len(u.api.Handles) > 0
+		hasStructs = hasStructs || len(u.api.Structs) > 0
+		for _, f := range u.api.Funcs {
+			hasCallbacks = hasCallbacks || len(f.Callbacks) > 0
+			hasDeprecated = hasDeprecated || f.Deprecated != ""
+		}
+	}
 
 	var b bytes.Buffer
 	b.WriteString("#pragma once\n\n")
 	b.WriteString("#include <stdint.h>\n")
-	b.WriteString("#include <stddef.h>\n\n")
+	b.WriteString("#include <stddef.h>\n")
+	b.WriteString("#include <stdbool.h>\n\n")
 	b.WriteString("#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
 
-	for _, f := range funcs {
-		// int32_t PM_Name(int32_t a, ..., int32_t* out);
-		b.WriteString("int32_t ")
-		b.WriteString(cPrefix)
-		b.WriteString(f.CName)
-		b.WriteString("(")
-		for i := range f.Params {
-			if i > 0 {
-				b.WriteString(", ")
-			}
-			if i < len(f.ParamTypes) && f.ParamTypes[i] == "int64" {
-				b.WriteString("int64_t ")
-			} else {
-				b.WriteString("int32_t ")
-			}
-			b.WriteString(f.Params[i])
+	b.WriteString("/*\n")
+	b.WriteString(" * Memory ownership:\n")
+	b.WriteString(" * - `const char*` parameters are borrowed; they are copied into Go before use\n")
+	b.WriteString(" *   and may be freed by the caller as soon as the call returns.\n")
+	b.WriteString(" * - `const uint8_t*` + `size_t` buffer parameters are borrowed and copied the same way.\n")
+	b.WriteString(" * - Strings returned through `char** out` and buffers returned through\n")
+	b.WriteString(" *   `uint8_t** out` + `size_t* out_len` are allocated by the library; the\n")
+	b.WriteString(" *   caller owns them and must release them with capi_free.\n")
+	b.WriteString(" * - The string returned by capi_last_error_json must also be released with capi_free.\n")
+	b.WriteString(" */\n\n")
+
+	if hasDeprecated {
+		// Marks exports annotated with capi:export deprecated="..."; callers get a compiler warning.
+		b.WriteString("#ifndef FORGEC_DEPRECATED\n")
+		b.WriteString("#if defined(__GNUC__) || defined(__clang__)\n")
+		b.WriteString("#define FORGEC_DEPRECATED(msg) __attribute__((deprecated(msg)))\n")
+		b.WriteString("#elif defined(_MSC_VER)\n")
+		b.WriteString("#define FORGEC_DEPRECATED(msg) __declspec(deprecated(msg))\n")
+		b.WriteString("#else\n")
+		b.WriteString("#define FORGEC_DEPRECATED(msg)\n")
+		b.WriteString("#endif\n")
+		b.WriteString("#endif\n\n")
+	}
+
+	status := statusEnum(units)
+	b.WriteString("/*\n")
+	fmt.Fprintf(&b, " * Every export returns a %s code as int32_t: OK (0) on success, ERROR when the\n", cPrefix+status.Name)
+	b.WriteString(" * Go function returned an error, PANIC when it panicked and INVALID_ARGUMENT when an\n")
+	b.WriteString(" * argument was rejected before the call (e.g., an invalid handle). Codes from 100 up\n")
+	b.WriteString(" * are declared with capi:errcode. capi_last_error_json describes the failure.\n")
+	b.WriteString(" */\n")
+	writeEnumTypedefs(&b, cPrefix, []scanner.Enum{status})
+
+	for _, u := range units {
+		writeEnumTypedefs(&b, u.prefix, u.api.Enums)
+	}
+
+	if hasHandles {
+		b.WriteString("/*\n")
+		b.WriteString(" * Handles are opaque references to Go objects. A handle returned by an export\n")
+		fmt.Fprintf(&b, " * stays valid until it is passed to %s<Type>_release; using it afterwards fails\n", cPrefix)
+		b.WriteString(" * with an \"invalid handle\" error. Releasing 0 is a no-op.\n")
+		b.WriteString(" */\n")
+		for _, u := range units {
+			writeHandleTypedefs(&b, u.prefix, u.api.Handles)
 		}
-		if f.HasValue {
-			if len(f.Params) > 0 {
-				b.WriteString(", ")
-			}
-			if f.RetType == "int64" {
-				b.WriteString("int64_t* out")
-			} else {
-				b.WriteString("int32_t* out")
+		for _, u := range units {
+			for _, h := range u.api.Handles {
+				fmt.Fprintf(&b, "int32_t %s%s_release(%s%sHandle h);\n", u.prefix, h.Name, u.prefix, h.Name)
 			}
 		}
-		b.WriteString(");\n")
+		b.WriteString("\n")
 	}
 
-	b.WriteString("\nconst char* capi_last_error_json(void);\n")
-	b.WriteString("void capi_free(void* p);\n\n")
+	// Struct typedefs come first since prototypes may reference them.
+	if hasStructs {
+		b.WriteString("/*\n")
+		b.WriteString(" * Structs are passed as `const S*` and returned through caller-allocated `S* out`.\n")
+		b.WriteString(" * A NULL `const S*` is rejected with the INVALID_ARGUMENT status.\n")
+		b.WriteString(" * Strings inside a returned struct are owned by the caller; release them with\n")
+		fmt.Fprintf(&b, " * %s<Struct>_free, which frees the strings but not the struct itself.\n", cPrefix)
+		b.WriteString(" */\n")
+		for _, u := range units {
+			writeStructTypedefs(&b, u.api.Structs)
+		}
+		for _, u := range units {
+			for _, s := range u.api.Structs {
+				fmt.Fprintf(&b, "void %s%s_free(%s* s);\n", u.prefix, s.Name, s.Name)
+			}
+		}
+		b.WriteString("\n")
+	}
 
-	// Struct typedefs
-	sort.Slice(structs, func(i, j int) bool { return structs[i].Name < structs[j].Name })
-	for _, s := range structs {
-		fmt.Fprintf(&b, "typedef struct %s {\n", s.Name)
-		for _, f := range s.Fields {
-			fmt.Fprintf(&b, "    %s %s;\n", f.CType, f.ExportName)
+	if hasCallbacks {
+		b.WriteString("/*\n")
+		b.WriteString(" * Callbacks are C function pointers followed by a `void* user_data` that is\n")
+		b.WriteString(" * passed back unchanged. They are invoked synchronously on the calling thread\n")
+		b.WriteString(" * before the export returns; string and buffer arguments are only valid for\n")
+		b.WriteString(" * the duration of the callback. A NULL callback is passed to Go as nil.\n")
+		b.WriteString(" */\n")
+		for _, u := range units {
+			for _, f := range u.api.Funcs {
+				for _, cb := range f.Callbacks {
+					if err := writeCallbackTypedef(&b, u.prefix, f, cb); err != nil {
+						return nil, err
+					}
+				}
+			}
 		}
-		fmt.Fprintf(&b, "} %s;\n\n", s.Name)
+		b.WriteString("\n")
 	}
-	b.WriteString("#ifdef __cplusplus\n}\n#endif\n")
 
-	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
-		return fmt.Errorf("write %s: %w", path, err)
+	// Prototypes are rendered from the binding model, like the language bindings.
+	m, err := buildModel(cPrefix, units)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	for _, f := range m.Funcs {
+		b.WriteString(f.cPrototype() + "\n")
+	}
+
+	b.WriteString("\n/*\n")
+	b.WriteString(" * The last error is kept per calling thread, like errno: capi_last_error_json\n")
+	b.WriteString(" * returns the error of the last failed call made on the same thread (\"{}\" if none),\n")
+	b.WriteString(" * and successful calls leave it unchanged. capi_clear_last_error resets it.\n")
+	b.WriteString(" *\n")
+	fmt.Fprintf(&b, " * The record (schema_version %d, see %s) holds the export's name\n", ErrorSchemaVersion, ErrorSchemaFile)
+	b.WriteString(" * (\"function\"), its \"status\", the error message and Go \"type\", the errors it wraps\n")
+	b.WriteString(" * (\"wrapped\", recursively), the goroutine \"stack\" for panics and a UTC \"time\".\n")
+	b.WriteString(" */\n")
+	b.WriteString("const char* capi_last_error_json(void);\n")
+	b.WriteString("void capi_clear_last_error(void);\n")
+	b.WriteString("void capi_free(void* p);\n\n")
+	b.WriteString("/*\n")
+	b.WriteString(" * Reporters: errors and panics of exports are also passed to the reporters registered\n")
+	b.WriteString(" * with the Go runtime package github.com/aarondu-sudo/forgec/capi (e.g., \"jsonl\", or\n")
+	b.WriteString(" * \"sentry\" with -sentry). capi_reporter_configure passes a JSON config to the reporter\n")
+	b.WriteString(" * registered under name (\"jsonl\": {\"path\": \"errors.jsonl\"}) and returns\n")
+	b.WriteString(" * INVALID_ARGUMENT for an unknown reporter or a bad config. capi_flush waits up to\n")
+	b.WriteString(" * timeout_ms for reporters to deliver queued reports; call it before exiting.\n")
+	b.WriteString(" */\n")
+	b.WriteString("int32_t capi_reporter_configure(const char* name, const char* config);\n")
+	b.WriteString("bool capi_flush(uint32_t timeout_ms);\n\n")
+	if withSentry {
+		b.WriteString("/*\n")
+		b.WriteString(" * Exported by the sentry reporter for callers of earlier versions:\n")
+		b.WriteString(" * capi_sentry_init(config) is capi_reporter_configure(\"sentry\", config), and\n")
+		b.WriteString(" * capi_sentry_flush is capi_flush.\n")
+		b.WriteString(" */\n")
+		b.WriteString("FORGEC_DEPRECATED(\"use capi_reporter_configure(\\\"sentry\\\", config)\") int32_t capi_sentry_init(const char* config);\n")
+		b.WriteString("FORGEC_DEPRECATED(\"use capi_flush\") bool capi_sentry_flush(uint32_t timeout_ms);\n\n")
+	}
+	b.WriteString("#ifdef __cplusplus\n}\n#endif\n")
+	return b.Bytes(), nil
 }
 
 // InitProject scaffolds a new DLL project directory with standard layout and a sample calc.go.
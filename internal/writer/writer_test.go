@@ -0,0 +1,291 @@
+package writer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aarondu-sudo/forgec/internal/scanner"
+)
+
+var (
+	sampleOnce sync.Once
+	sampleAPIs []*scanner.API
+	sampleErr  error
+)
+
+// scanSample scans testdata/sample, a small API using every kind of value, once per test binary.
+func scanSample(t *testing.T) []*scanner.API {
+	t.Helper()
+	sampleOnce.Do(func() { sampleAPIs, sampleErr = scanner.ScanExported("testdata", "./sample") })
+	if sampleErr != nil {
+		t.Fatal(sampleErr)
+	}
+	return sampleAPIs
+}
+
+// generators write the bindings of apis for library "sample" into dir; out is the file holding
+// the wrappers, relative to dir.
+var generators = []struct {
+	lang  string
+	out   string
+	write func(dir string, apis []*scanner.API) error
+}{
+	{"python", "sample.py", func(dir string, apis []*scanner.API) error {
+		return WritePython(filepath.Join(dir, "sample.py"), "sample", "PM_", apis)
+	}},
+	{"csharp", "Sample.cs", func(dir string, apis []*scanner.API) error {
+		return WriteCSharp(filepath.Join(dir, "Sample.cs"), "sample", "PM_", apis)
+	}},
+	{"rust", "sample.rs", func(dir string, apis []*scanner.API) error {
+		return WriteRust(filepath.Join(dir, "sample.rs"), "sample", "PM_", apis)
+	}},
+	{"node", "index.js", func(dir string, apis []*scanner.API) error {
+		return WriteNode(dir, "sample", "PM_", apis)
+	}},
+	{"java", "sample/SampleJna.java", func(dir string, apis []*scanner.API) error {
+		return WriteJava(dir, "", "sample", "PM_", apis)
+	}},
+	{"dart", "sample.dart", func(dir string, apis []*scanner.API) error {
+		return WriteDart(filepath.Join(dir, "sample.dart"), "sample", "PM_", apis)
+	}},
+	{"lua", "sample.lua", func(dir string, apis []*scanner.API) error {
+		return WriteLua(filepath.Join(dir, "sample.lua"), "sample", "PM_", apis)
+	}},
+	{"swift", "Sources/Sample/Sample.swift", func(dir string, apis []*scanner.API) error {
+		return WriteSwift(dir, "sample", "PM_", apis)
+	}},
+	{"c++", "forgec.hpp", func(dir string, apis []*scanner.API) error {
+		if err := WriteHeader(filepath.Join(dir, "forgec.h"), "PM_", apis, nil); err != nil {
+			return err
+		}
+		return WriteCPP(filepath.Join(dir, "forgec.hpp"), filepath.Join(dir, "forgec.h"), "PM_", apis)
+	}},
+}
+
+// generate runs the generator of lang and returns its wrapper file.
+func generate(t *testing.T, lang string, apis []*scanner.API) (dir, out string) {
+	t.Helper()
+	for _, g := range generators {
+		if g.lang != lang {
+			continue
+		}
+		dir = t.TempDir()
+		if err := g.write(dir, apis); err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, g.out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir, string(data)
+	}
+	t.Fatalf("no generator for %s", lang)
+	return "", ""
+}
+
+func TestGeneratorsWriteSample(t *testing.T) {
+	want := map[string][]string{
+		"python": {"class Mode(enum.IntEnum):", "class Store:", "    def lookup(self, key):", "def add(a, b):", "def add_old(a, b):", "def walk(n, visit):"},
+		"csharp": {"public enum Mode : int", "public sealed class Store : IDisposable", "public long Lookup(string key)", "public static int Add(int a, int b)"},
+		"rust":   {"pub struct Store(usize);", "pub fn lookup(&self, key: &str) -> Result<i64, ForgecError>", "pub fn add(a: i32, b: i32) -> Result<i32, ForgecError>", "pub fn reset() -> Result<(), ForgecError>"},
+		"node":   {"class Store {", "  lookup(key) {", "function add(a, b) {", "function addOld(a, b) {"},
+		"java":   {"public static final class Store implements AutoCloseable {", "public long lookup(String key) throws ForgecException {", "public static int add(int a, int b) throws ForgecException {"},
+		"dart":   {"class Store {", "int lookup(String key) {", "int add(int a, int b) {", "int addOld(int a, int b) {"},
+		"lua":    {"function Store:lookup(key)", "function M.add(a, b)", "function M.add_old(a, b)"},
+		"swift":  {"public final class Store {", "public func lookup(key: String) throws -> Int64 {", "public func add(a: Int32, b: Int32) throws -> Int32 {"},
+		"c++":    {"class store {", "int64_t lookup(std::string_view key) const;", "inline int32_t add(int32_t a, int32_t b) {"},
+	}
+	apis := scanSample(t)
+	for _, g := range generators {
+		t.Run(g.lang, func(t *testing.T) {
+			_, out := generate(t, g.lang, apis)
+			for _, s := range want[g.lang] {
+				if !strings.Contains(out, s) {
+					t.Errorf("%s does not contain %q", g.out, s)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteHeaderCompiles(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	if err := WriteHeader(filepath.Join(dir, "forgec.h"), "PM_", scanSample(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "main.c")
+	if err := os.WriteFile(src, []byte("#include \"forgec.h\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(cc, "-std=c99", "-Wall", "-Wstrict-prototypes", "-Werror", "-fsyntax-only", src).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
+
+// buildShared writes exports.go and forgec.h for apis into a directory under testdata, so the
+// imports resolve in this module, and builds them with -buildmode=c-shared. It returns the
+// directory, which holds forgec.h and libforgec.so.
+func buildShared(t *testing.T, apis []*scanner.API) string {
+	t.Helper()
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	dir, err := os.MkdirTemp("testdata", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := WriteExportsGo(filepath.Join(dir, "exports.go"), "PM_", apis, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteHeader(filepath.Join(dir, "forgec.h"), "PM_", apis, nil); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", "libforgec.so", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return dir
+}
+
+func TestWriteExportsGoMultiBuilds(t *testing.T) {
+	apis, err := scanner.ScanEntries("testdata", []scanner.Entry{{Pattern: "./multi/a", Prefix: "A_"}, {Pattern: "./multi/b", Prefix: "B_"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := buildShared(t, apis)
+	data, err := os.ReadFile(filepath.Join(dir, "exports.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"p_a \"", "p_b \"", "func A_Add(", "func B_Add("} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("exports.go does not contain %q", s)
+		}
+	}
+}
+
+func TestCheckSymbols(t *testing.T) {
+	add := []scanner.Func{{Name: "Add", CName: "Add"}}
+	empty := ""
+	tests := []struct {
+		name string
+		apis []*scanner.API
+		want string // joined errors; empty for none
+	}{
+		{"same prefix", []*scanner.API{
+			{PkgPath: "example.com/a", Name: "a", Funcs: add},
+			{PkgPath: "example.com/b", Name: "b", Funcs: add},
+		}, "duplicate C symbol PM_Add: declared by example.com/a.Add and example.com/b.Add"},
+		{"own prefix", []*scanner.API{
+			{PkgPath: "example.com/a", Name: "a", Funcs: add},
+			{PkgPath: "example.com/b", Name: "b", Prefix: "B_", Funcs: add},
+		}, ""},
+		{"runtime symbol", []*scanner.API{
+			{PkgPath: "example.com/a", Name: "a", Funcs: []scanner.Func{{Name: "Free", CName: "capi_free", Prefix: &empty}}},
+		}, "duplicate C symbol capi_free: declared by forgec and example.com/a.Free"},
+		{"struct", []*scanner.API{
+			{PkgPath: "example.com/a", Name: "a", Structs: []scanner.Struct{{Name: "User"}}},
+			{PkgPath: "example.com/b", Name: "b", Prefix: "B_", Structs: []scanner.Struct{{Name: "User"}}},
+		}, "duplicate C symbol User: declared by example.com/a.User and example.com/b.User"},
+		{"status code", []*scanner.API{
+			{PkgPath: "example.com/a", Name: "a", ErrCodes: []scanner.ErrCode{{Name: "ErrGone", CName: "GONE", Code: 100}}},
+			{PkgPath: "example.com/b", Name: "b", ErrCodes: []scanner.ErrCode{{Name: "ErrLost", CName: "LOST", Code: 100}}},
+		}, "duplicate status code 100: declared by example.com/a.ErrGone and example.com/b.ErrLost"},
+		{"status name", []*scanner.API{
+			{PkgPath: "example.com/a", Name: "a", ErrCodes: []scanner.ErrCode{{Name: "ErrPanic", CName: "PANIC", Code: 100}}},
+		}, "duplicate C symbol PM_Status_PANIC: declared by forgec and example.com/a.ErrPanic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newUnits("PM_", tt.apis)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("err = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// exportsMain calls the sample exports built by buildShared and exits non-zero on the first
+// unexpected status.
+const exportsMain = `#include <stdio.h>
+#include <string.h>
+#include "forgec.h"
+
+static int failed;
+
+static void expect(const char* call, int32_t got, int32_t want) {
+    if (got != want) {
+        const char* js = capi_last_error_json();
+        printf("%s = %d, want %d (last error: %s)\n", call, got, want, js ? js : "none");
+        capi_free((void*)js);
+        failed = 1;
+    }
+}
+
+int main(void) {
+    int32_t sum = 0;
+    expect("PM_Add", PM_Add(2, 3, &sum), PM_Status_OK);
+    expect("PM_Add result", sum, 5);
+
+    uint8_t* out = NULL;
+    size_t out_len = 0;
+    expect("PM_Echo(NULL, 5)", PM_Echo(NULL, 5, &out, &out_len), PM_Status_INVALID_ARGUMENT);
+    expect("PM_Echo(\"abc\", 3)", PM_Echo((const uint8_t*)"abc", 3, &out, &out_len), PM_Status_OK);
+    expect("PM_Echo result", out_len == 3 && memcmp(out, "abc", 3) == 0, 1);
+    capi_free(out);
+
+    PM_StoreHandle h;
+    int64_t v = 0;
+    expect("PM_NewStore", PM_NewStore(&h), PM_Status_OK);
+    expect("PM_Store_Lookup(missing)", PM_Store_Lookup(h, "k", &v), PM_Status_NOT_FOUND);
+    expect("PM_Store_Put", PM_Store_Put(h, "k", 7), PM_Status_OK);
+    expect("PM_Store_Lookup", PM_Store_Lookup(h, "k", &v), PM_Status_OK);
+    expect("PM_Store_Lookup result", (int32_t)v, 7);
+    expect("PM_Store_release", PM_Store_release(h), PM_Status_OK);
+    expect("PM_Store_Put(released)", PM_Store_Put(h, "k", 8), PM_Status_INVALID_ARGUMENT);
+
+    int32_t q = 0;
+    expect("PM_Divide(1, 0)", PM_Divide(1, 0, &q), PM_Status_PANIC);
+    expect("PM_Divide(6, 3)", PM_Divide(6, 3, &q), PM_Status_OK);
+    expect("PM_Divide result", q, 2);
+
+    char* greeting = NULL;
+    expect("PM_Greet(NULL)", PM_Greet(NULL, &greeting), PM_Status_INVALID_ARGUMENT);
+    return failed;
+}
+`
+
+func TestExportsCalledFromC(t *testing.T) {
+	dir := buildShared(t, scanSample(t))
+	src := filepath.Join(dir, "main.c")
+	if err := os.WriteFile(src, []byte(exportsMain), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "main")
+	if out, err := exec.Command("cc", "-std=c99", "-Wall", "-Werror", "-o", bin, src, "-L"+abs, "-lforgec", "-Wl,-rpath,"+abs).CombinedOutput(); err != nil {
+		t.Fatalf("cc: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(bin).CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}